@@ -0,0 +1,135 @@
+package admin
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/samuelngs/universe/server"
+)
+
+// Admin serves a local HTTP API to inspect and control the server
+type Admin interface {
+	Run() error
+	Stop(context.Context) error
+	Option() *Options
+	Handler() http.Handler
+}
+
+// New create admin for the server
+func New(s server.Server, opts ...Option) Admin {
+	a := new(admin)
+	a.server = s
+	a.option = newOptions(opts...)
+	return a
+}
+
+// internal admin
+type admin struct {
+	sync.Mutex
+	option  *Options
+	server  server.Server
+	http    *http.Server
+	stopped bool
+}
+
+// listen only accepts loopback addresses and unix sockets, the socket is
+// created accessible to the owner only
+func listen(addr string) (net.Listener, error) {
+	if strings.HasPrefix(addr, "unix:") {
+		return listenUnix(strings.TrimPrefix(addr, "unix:"))
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if host != "localhost" {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			return nil, ErrNotLocal
+		}
+	}
+	return net.Listen("tcp", addr)
+}
+
+// listenUnix replaces a stale socket left by a previous run, and binds
+// under a umask that keeps other users from connecting before the socket
+// is chmodded
+func listenUnix(path string) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if c, err := net.Dial("unix", path); err == nil {
+			c.Close()
+			return nil, ErrSocketInUse
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	umask.Lock()
+	mask := syscall.Umask(0177)
+	listener, err := net.Listen("unix", path)
+	syscall.Umask(mask)
+	umask.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// umask is process wide, admins binding at once must not restore each
+// other's
+var umask sync.Mutex
+
+// Run serves the admin API until stopped
+func (v *admin) Run() error {
+	v.Lock()
+	if v.http != nil || v.stopped {
+		v.Unlock()
+		return ErrStarted
+	}
+	listener, err := listen(v.option.GetListenAddr())
+	if err != nil {
+		v.Unlock()
+		return err
+	}
+	v.http = &http.Server{
+		Handler:      v.Handler(),
+		ReadTimeout:  v.option.GetTimeout(),
+		WriteTimeout: v.option.GetTimeout(),
+	}
+	srv := v.http
+	v.Unlock()
+	if err := srv.Serve(listener); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Stop waits for pending requests to complete or the context to be done
+func (v *admin) Stop(ctx context.Context) error {
+	v.Lock()
+	defer v.Unlock()
+	if v.stopped {
+		return nil
+	}
+	v.stopped = true
+	if v.http == nil {
+		return nil
+	}
+	return v.http.Shutdown(ctx)
+}
+
+func (v *admin) Option() *Options {
+	return v.option
+}
+
+func (v *admin) Handler() http.Handler {
+	return http.HandlerFunc(v.route)
+}
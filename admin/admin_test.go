@@ -0,0 +1,41 @@
+package admin
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admin.sock")
+	// a socket left behind by a run that was killed
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	mask := syscall.Umask(0)
+	defer syscall.Umask(mask)
+	l, err := listen("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Fatalf("socket mode = %v", perm)
+	}
+	if _, err := listen("unix:" + path); err != ErrSocketInUse {
+		t.Fatalf("listen on a socket in use = %v", err)
+	}
+	if _, err := listen("192.0.2.1:0"); err != ErrNotLocal {
+		t.Fatalf("listen on a public address = %v", err)
+	}
+}
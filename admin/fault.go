@@ -0,0 +1,19 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/samuelngs/universe/errors"
+)
+
+const namespace string = "admin"
+
+// Error messages
+var (
+	ErrNotLocal         = errors.BadRequest(namespace, "admin must listen on localhost or a unix socket")
+	ErrStarted          = errors.BadRequest(namespace, "admin is already running")
+	ErrSocketInUse      = errors.BadRequest(namespace, "admin socket is in use")
+	ErrNotFound         = errors.NotFound(namespace, "route not found")
+	ErrMethodNotAllowed = errors.New(namespace, "method not allowed", http.StatusMethodNotAllowed)
+	ErrNotRunning       = errors.New(namespace, "server is not running", http.StatusServiceUnavailable)
+)
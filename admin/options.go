@@ -0,0 +1,78 @@
+package admin
+
+import (
+	"sync"
+	"time"
+)
+
+// Option func
+type Option func(*Options)
+
+// Options for admin
+type Options struct {
+	sync.RWMutex
+	// Admin listen addr, either a loopback <addr>:<port> or unix:<path>
+	ListenAddr string
+	// Request read and write timeout
+	Timeout time.Duration
+}
+
+// newOptions creates new option
+func newOptions(opts ...Option) *Options {
+	o := &Options{
+		ListenAddr: "127.0.0.1:2223",
+		Timeout:    30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// ListenAddr option
+func ListenAddr(s string) Option {
+	return func(o *Options) {
+		o.SetListenAddr(s)
+	}
+}
+
+// Timeout option
+func Timeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.SetTimeout(d)
+	}
+}
+
+// SetListenAddr to set listen address
+func (v *Options) SetListenAddr(addr string) *Options {
+	v.Lock()
+	defer v.Unlock()
+	if len(addr) > 0 {
+		v.ListenAddr = addr
+	}
+	return v
+}
+
+// SetTimeout to set request timeout
+func (v *Options) SetTimeout(d time.Duration) *Options {
+	v.Lock()
+	defer v.Unlock()
+	if d > 0 {
+		v.Timeout = d
+	}
+	return v
+}
+
+// GetListenAddr to return listen address
+func (v *Options) GetListenAddr() string {
+	v.RLock()
+	defer v.RUnlock()
+	return v.ListenAddr
+}
+
+// GetTimeout to return request timeout
+func (v *Options) GetTimeout() time.Duration {
+	v.RLock()
+	defer v.RUnlock()
+	return v.Timeout
+}
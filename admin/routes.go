@@ -0,0 +1,310 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/samuelngs/universe/errors"
+	"github.com/samuelngs/universe/pkg/audit"
+	"github.com/samuelngs/universe/server"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// route dispatches requests by path and method
+//
+//	GET    /health
+//	GET    /options
+//	GET    /connections
+//	GET    /connections/<id>
+//	DELETE /connections/<id>
+//	DELETE /sessions/<id>
+//	POST   /keys/reload
+//	GET    /bans
+//	DELETE /bans/<id>
+//	GET    /metrics
+func (v *admin) route(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	var id string
+	if len(parts) == 2 {
+		id = parts[1]
+	}
+	switch {
+	case len(parts) == 1 && parts[0] == "health":
+		v.method(w, r, "GET", v.health)
+	case len(parts) == 1 && parts[0] == "options":
+		v.method(w, r, "GET", v.options)
+	case len(parts) == 1 && parts[0] == "connections":
+		v.method(w, r, "GET", v.connections)
+	case len(parts) == 2 && parts[0] == "connections" && r.Method == "DELETE":
+		v.disconnect(w, r, id)
+	case len(parts) == 2 && parts[0] == "connections":
+		v.method(w, r, "GET", func(w http.ResponseWriter, r *http.Request) {
+			v.connection(w, id)
+		})
+	case len(parts) == 2 && parts[0] == "sessions":
+		v.method(w, r, "DELETE", func(w http.ResponseWriter, r *http.Request) {
+			v.kill(w, r, id)
+		})
+	case len(parts) == 2 && parts[0] == "keys" && parts[1] == "reload":
+		v.method(w, r, "POST", v.reload)
+	case len(parts) == 1 && parts[0] == "bans":
+		v.method(w, r, "GET", v.bans)
+	case len(parts) == 2 && parts[0] == "bans":
+		v.method(w, r, "DELETE", func(w http.ResponseWriter, r *http.Request) {
+			v.unban(w, r, id)
+		})
+	case len(parts) == 1 && parts[0] == "metrics":
+		v.method(w, r, "GET", v.metrics)
+	default:
+		fail(w, ErrNotFound)
+	}
+}
+
+// method only calls the handler for the expected request method
+func (v *admin) method(w http.ResponseWriter, r *http.Request, m string, f http.HandlerFunc) {
+	if r.Method != m {
+		w.Header().Set("Allow", m)
+		fail(w, ErrMethodNotAllowed)
+		return
+	}
+	f(w, r)
+}
+
+func (v *admin) health(w http.ResponseWriter, r *http.Request) {
+	if !v.server.Started() {
+		fail(w, ErrNotRunning)
+		return
+	}
+	reply(w, http.StatusOK, map[string]interface{}{
+		"status":    "ok",
+		"server_id": v.server.Option().GetServerID(),
+	})
+}
+
+func (v *admin) options(w http.ResponseWriter, r *http.Request) {
+	o := v.server.Option()
+	keys := make([]map[string]interface{}, 0)
+	for _, k := range o.GetHostKeys() {
+		signer, err := k.Signer()
+		if err != nil {
+			fail(w, err)
+			return
+		}
+		keys = append(keys, map[string]interface{}{
+			"type":        signer.PublicKey().Type(),
+			"fingerprint": ssh.FingerprintSHA256(signer.PublicKey()),
+			"path":        k.Path(),
+		})
+	}
+	listeners := make([]map[string]interface{}, 0)
+	for _, l := range o.GetListeners() {
+		auth := make([]string, 0, len(l.Auth))
+		for _, t := range l.Auth {
+			auth = append(auth, t.String())
+		}
+		listeners = append(listeners, map[string]interface{}{
+			"name":            l.Name,
+			"addr":            l.String(),
+			"auth":            auth,
+			"banner":          l.Banner,
+			"motd":            l.MOTD,
+			"trusted_proxies": l.TrustedProxies,
+		})
+	}
+	sinks := make([]map[string]interface{}, 0)
+	for _, s := range o.GetLogSinks() {
+		typ := s.Type
+		if s.Sink != nil {
+			typ = "custom"
+		}
+		sinks = append(sinks, map[string]interface{}{
+			"type":        typ,
+			"path":        s.Path,
+			"max_bytes":   s.MaxBytes,
+			"max_backups": s.MaxBackups,
+			"topics":      s.Topics,
+			"level":       s.Level.String(),
+		})
+	}
+	redact := make([]string, 0)
+	for _, re := range o.GetRedactions() {
+		redact = append(redact, re.String())
+	}
+	groups := make([]map[string]interface{}, 0)
+	for _, g := range o.GetGroups() {
+		groups = append(groups, map[string]interface{}{
+			"name":   g.Name,
+			"users":  g.Users,
+			"banner": g.Banner,
+			"motd":   g.MOTD,
+		})
+	}
+	algorithms := o.GetAlgorithms()
+	throttle := o.GetThrottle()
+	rules := o.GetAccess().Rules()
+	limits := o.GetLimits()
+	reply(w, http.StatusOK, map[string]interface{}{
+		"server_id":               o.GetServerID(),
+		"client_auth":             o.GetClientAuth(),
+		"password_authentication": o.GetPasswordAuthentication(),
+		"rsa_authentication":      o.GetRSAAuthentication(),
+		"listen_addr":             o.GetListenAddr(),
+		"listeners":               listeners,
+		"logs":                    sinks,
+		"redact":                  redact,
+		"protocol":                o.GetProtocol(),
+		"host_keys":               keys,
+		"metadata":                o.GetMetadataMap(),
+		"grace_period":            o.GetGracePeriod().String(),
+		"shutdown_message":        o.GetShutdownMessage(),
+		"config_file":             o.GetConfigFile(),
+		"audit_log":               o.GetAuditLog(),
+		"socket_activation":       o.GetSocketActivation(),
+		"max_auth_tries":          o.GetMaxAuthTries(),
+		"access": map[string]interface{}{
+			"allow":  rules.Allow,
+			"deny":   rules.Deny,
+			"users":  rules.Users,
+			"groups": rules.Groups,
+		},
+		"algorithms": map[string]interface{}{
+			"ciphers":       algorithms.Ciphers,
+			"key_exchanges": algorithms.KeyExchanges,
+			"macs":          algorithms.MACs,
+			"host_keys":     algorithms.HostKeys,
+		},
+		"banner": o.GetBanner(),
+		"motd":   o.GetMOTD(),
+		"groups": groups,
+		"limits": map[string]interface{}{
+			"max_connections":        limits.MaxConnections,
+			"max_connections_per_ip": limits.MaxConnectionsPerIP,
+			"max_startups":           limits.MaxStartups.String(),
+			"max_sessions":           limits.MaxSessions,
+			"max_ptys_per_user":      limits.MaxPTYsPerUser,
+			"handshake_timeout":      limits.HandshakeTimeout.String(),
+		},
+		"throttle": map[string]interface{}{
+			"max_failures": throttle.MaxFailures,
+			"ban_users":    throttle.BanUsers,
+			"ban_duration": throttle.BanDuration.String(),
+			"backoff":      throttle.Backoff.String(),
+			"max_backoff":  throttle.MaxBackoff.String(),
+			"window":       throttle.Window.String(),
+		},
+	})
+}
+
+func (v *admin) connections(w http.ResponseWriter, r *http.Request) {
+	list := make([]json.RawMessage, 0)
+	for _, c := range v.server.Connections() {
+		list = append(list, json.RawMessage(c.String()))
+	}
+	reply(w, http.StatusOK, list)
+}
+
+func (v *admin) connection(w http.ResponseWriter, id string) {
+	for _, c := range v.server.Connections() {
+		if c.ID == id {
+			reply(w, http.StatusOK, json.RawMessage(c.String()))
+			return
+		}
+	}
+	fail(w, server.ErrConnectionNotFound)
+}
+
+func (v *admin) disconnect(w http.ResponseWriter, r *http.Request, id string) {
+	err := v.server.Disconnect(id)
+	v.audit(r, "disconnect", id, err)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (v *admin) kill(w http.ResponseWriter, r *http.Request, id string) {
+	err := v.server.Kill(id)
+	v.audit(r, "kill", id, err)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (v *admin) reload(w http.ResponseWriter, r *http.Request) {
+	err := v.server.Option().ReloadHostKeys()
+	v.audit(r, "reload-host-keys", "", err)
+	if err != nil {
+		fail(w, errors.InternalServer(namespace, "could not reload host keys").Info(err))
+		return
+	}
+	v.options(w, r)
+}
+
+func (v *admin) bans(w http.ResponseWriter, r *http.Request) {
+	list := make([]json.RawMessage, 0)
+	for _, b := range v.server.Bans() {
+		list = append(list, json.RawMessage(b.String()))
+	}
+	reply(w, http.StatusOK, list)
+}
+
+func (v *admin) unban(w http.ResponseWriter, r *http.Request, id string) {
+	err := v.server.Unban(id)
+	v.audit(r, "unban", id, err)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (v *admin) metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	v.server.Metrics().WriteTo(w)
+}
+
+// audit records the admin action in the server audit log
+func (v *admin) audit(r *http.Request, action, target string, err error) {
+	fields := map[string]string{
+		"action":      action,
+		"remote_addr": r.RemoteAddr,
+		"result":      "success",
+	}
+	if target != "" {
+		fields["target"] = target
+	}
+	if err != nil {
+		fields["result"] = "failure"
+		fields["error"] = err.Error()
+	}
+	v.server.Audit(audit.TypeAdmin, fields)
+}
+
+// reply writes the object as JSON
+func reply(w http.ResponseWriter, code int, o interface{}) {
+	b, err := json.Marshal(o)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(b)
+}
+
+// fail writes the error in its JSON form with its status code, errors
+// without one are reported as internal errors
+func fail(w http.ResponseWriter, err error) {
+	e, ok := err.(*errors.Error)
+	if !ok {
+		e = errors.InternalServer(namespace, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Code)
+	w.Write([]byte(e.Error()))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/samuelngs/universe/pkg/audit"
+	"github.com/samuelngs/universe/pkg/crypto"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// auditlog inspects audit logs, usage:
+//
+//	universe audit verify -key <path> <file>
+//
+// The checkpoints carry the key they were signed with, so the trusted host
+// key is required. A log cut right after a checkpoint still verifies, the
+// last checkpoint is printed to be compared with the one the server logged.
+func auditlog(args []string) int {
+	if len(args) == 0 || args[0] != "verify" {
+		fmt.Fprintln(os.Stderr, "usage: universe audit verify -key <path> <file>")
+		return 2
+	}
+	fs := flag.NewFlagSet("audit verify", flag.ExitOnError)
+	keypath := fs.String("key", "", "host key, private or public, the checkpoints must be signed with (required)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: universe audit verify -key <path> <file>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args[1:])
+	if fs.NArg() != 1 || *keypath == "" {
+		fs.Usage()
+		return 2
+	}
+
+	key, err := readPublicKey(*keypath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer f.Close()
+	report, err := audit.Verify(f, key)
+	fmt.Printf("%d records, %d checkpoints\n", report.Records, report.Checkpoints)
+	for _, fingerprint := range report.Keys {
+		fmt.Printf("signed by %s\n", fingerprint)
+	}
+	if report.Checkpoints > 0 {
+		fmt.Printf("last checkpoint %d %s\n", report.LastSeq, report.LastHash)
+	}
+	if err != nil {
+		if err == audit.ErrUnsealed {
+			fmt.Printf("%d records after the last checkpoint\n", report.Unsealed)
+		}
+		fmt.Printf("FAILED: %v\n", err)
+		return 1
+	}
+	fmt.Println("OK, records cut after the last checkpoint are not detected, compare it with the last checkpoint logged by the server")
+	return 0
+}
+
+// readPublicKey reads an authorized_keys formatted public key, or the
+// public key of a private key file
+func readPublicKey(path string) (ssh.PublicKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if key, _, _, _, err := ssh.ParseAuthorizedKey(b); err == nil {
+		return key, nil
+	}
+	k, err := crypto.Import(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := k.Signer()
+	if err != nil {
+		return nil, err
+	}
+	return signer.PublicKey(), nil
+}
@@ -1 +1,228 @@
 package clientv1
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Client for Secure Shell
+type Client interface {
+	Dial() error
+	Close() error
+	Connected() bool
+	Option() *Options
+	Run(cmd string) (*Result, error)
+	Stream(cmd string, stdout, stderr io.Writer) (*Result, error)
+	Shell(stdin io.Reader, stdout, stderr io.Writer) (*Result, error)
+	Upload(local, remote string, opts ...TransferOption) error
+	Download(remote, local string, opts ...TransferOption) error
+}
+
+// New create secure shell client
+func New(opts ...Option) Client {
+	cli := new(client)
+	cli.option = newOptions(opts...)
+	return cli
+}
+
+// internal client
+type client struct {
+	sync.RWMutex
+	option  *Options
+	conn    *ssh.Client
+	release func()
+}
+
+// dial opens an authenticated connection with the given options
+func dial(o *Options) (*ssh.Client, func(), error) {
+	addr := o.GetAddr()
+	if addr == "" {
+		return nil, nil, ErrNoAddr
+	}
+	conf, release, err := o.config()
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := ssh.Dial("tcp", addr, conf)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return conn, release, nil
+}
+
+func (v *client) Dial() error {
+	v.Lock()
+	defer v.Unlock()
+	if v.conn != nil {
+		return nil
+	}
+	conn, release, err := dial(v.option)
+	if err != nil {
+		return err
+	}
+	v.conn, v.release = conn, release
+	return nil
+}
+
+func (v *client) Close() error {
+	v.Lock()
+	defer v.Unlock()
+	if v.conn == nil {
+		return nil
+	}
+	err := v.conn.Close()
+	v.release()
+	v.conn, v.release = nil, nil
+	return err
+}
+
+func (v *client) Connected() bool {
+	v.RLock()
+	defer v.RUnlock()
+	return v.conn != nil
+}
+
+func (v *client) Option() *Options {
+	return v.option
+}
+
+func (v *client) session() (*ssh.Session, error) {
+	v.RLock()
+	defer v.RUnlock()
+	if v.conn == nil {
+		return nil, ErrNotConnected
+	}
+	return v.conn.NewSession()
+}
+
+func (v *client) Run(cmd string) (*Result, error) {
+	return v.Stream(cmd, nil, nil)
+}
+
+func (v *client) Stream(cmd string, stdout, stderr io.Writer) (*Result, error) {
+	session, err := v.session()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	return execute(session, v.option.GetAddr(), cmd, stdout, stderr)
+}
+
+func (v *client) Shell(stdin io.Reader, stdout, stderr io.Writer) (*Result, error) {
+	session, err := v.session()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	return shell(session, v.option.GetAddr(), stdin, stdout, stderr)
+}
+
+// execute runs a command on the session, capturing its output into the
+// result while copying it to the optional writers as it arrives
+func execute(session *ssh.Session, host, cmd string, stdout, stderr io.Writer) (*Result, error) {
+	var outbuf, errbuf bytes.Buffer
+	session.Stdout = tee(&outbuf, stdout)
+	session.Stderr = tee(&errbuf, stderr)
+	r := &Result{
+		Host:    host,
+		Command: cmd,
+		Started: time.Now(),
+	}
+	err := session.Run(cmd)
+	r.Duration = time.Since(r.Started)
+	r.Stdout = outbuf.Bytes()
+	r.Stderr = errbuf.Bytes()
+	return r, status(r, err)
+}
+
+// shell starts an interactive login shell with a pseudo terminal, putting
+// the local terminal into raw mode when stdin is one
+func shell(session *ssh.Session, host string, stdin io.Reader, stdout, stderr io.Writer) (*Result, error) {
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = stderr
+	w, h := 80, 24
+	if f, ok := stdin.(*os.File); ok && terminal.IsTerminal(int(f.Fd())) {
+		fd := int(f.Fd())
+		state, err := terminal.MakeRaw(fd)
+		if err != nil {
+			return nil, err
+		}
+		defer terminal.Restore(fd, state)
+		if tw, th, err := terminal.GetSize(fd); err == nil {
+			w, h = tw, th
+		}
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGWINCH)
+		defer func() {
+			signal.Stop(ch)
+			close(ch)
+		}()
+		go func() {
+			for range ch {
+				if tw, th, err := terminal.GetSize(fd); err == nil {
+					session.WindowChange(th, tw)
+				}
+			}
+		}()
+	}
+	term := os.Getenv("TERM")
+	if term == "" {
+		term = "xterm"
+	}
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty(term, h, w, modes); err != nil {
+		return nil, err
+	}
+	r := &Result{
+		Host:    host,
+		Started: time.Now(),
+	}
+	if err := session.Shell(); err != nil {
+		return nil, err
+	}
+	err := session.Wait()
+	r.Duration = time.Since(r.Started)
+	return r, status(r, err)
+}
+
+// status translates session errors into result exit status, only transport
+// failures are returned as errors
+func status(r *Result, err error) error {
+	switch o := err.(type) {
+	case nil:
+		r.ExitStatus = 0
+		return nil
+	case *ssh.ExitError:
+		r.ExitStatus = o.ExitStatus()
+		r.Signal = o.Signal()
+		return nil
+	case *ssh.ExitMissingError:
+		r.ExitStatus = -1
+		return nil
+	default:
+		r.ExitStatus = -1
+		r.Err = err
+		return err
+	}
+}
+
+func tee(buf *bytes.Buffer, w io.Writer) io.Writer {
+	if w == nil {
+		return buf
+	}
+	return io.MultiWriter(buf, w)
+}
@@ -0,0 +1,121 @@
+package clientv1
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samuelngs/universe/server"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// serve starts an in-process server accepting any password and returns
+// its address
+func serve(t *testing.T, opts ...server.Option) string {
+	opts = append([]server.Option{server.ListenAddr("127.0.0.1:0"), server.PasswordAuthentication(true)}, opts...)
+	s := server.New(opts...)
+	addr := make(chan string, 1)
+	go func() {
+		for e := range s.Subscribe() {
+			if e.Topic() == server.EventServerStarted {
+				addr <- strings.TrimPrefix(e.Message(), "Listening on ")
+			}
+		}
+	}()
+	go func() {
+		for range s.Logging() {
+		}
+	}()
+	done := make(chan error, 1)
+	go func() { done <- s.Run() }()
+	t.Cleanup(func() {
+		s.Stop(context.Background())
+		<-done
+	})
+	select {
+	case a := <-addr:
+		return a
+	case err := <-done:
+		t.Fatal(err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("server did not start")
+	}
+	return ""
+}
+
+func dialTest(t *testing.T, addr string) Client {
+	c := New(
+		Addr(addr),
+		User("test"),
+		Password("test"),
+		HostKeyCallback(ssh.InsecureIgnoreHostKey()),
+	)
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestRun(t *testing.T) {
+	c := dialTest(t, serve(t))
+	r, err := c.Run("echo out; echo err >&2; exit 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(r.Stdout); got != "out\n" {
+		t.Errorf("stdout = %q", got)
+	}
+	if got := string(r.Stderr); got != "err\n" {
+		t.Errorf("stderr = %q", got)
+	}
+	if r.ExitStatus != 3 {
+		t.Errorf("exit status = %d", r.ExitStatus)
+	}
+}
+
+func TestRunSignal(t *testing.T) {
+	c := dialTest(t, serve(t))
+	r, err := c.Run("kill -TERM $$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Signal != "TERM" {
+		t.Errorf("signal = %q", r.Signal)
+	}
+}
+
+func TestStream(t *testing.T) {
+	c := dialTest(t, serve(t))
+	var out strings.Builder
+	r, err := c.Stream("printf 'a\\nb\\n'", &out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "a\nb\n" || string(r.Stdout) != "a\nb\n" || r.ExitStatus != 0 {
+		t.Errorf("stream = %q, result = %q, exit status = %d", out.String(), r.Stdout, r.ExitStatus)
+	}
+}
+
+func TestSubsystemRefused(t *testing.T) {
+	addr := serve(t)
+	conn, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            "test",
+		Auth:            []ssh.AuthMethod{ssh.Password("test")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	session, err := conn.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if err := session.RequestSubsystem("sftp"); err == nil {
+		t.Fatal("sftp subsystem accepted")
+	}
+}
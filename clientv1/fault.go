@@ -0,0 +1,18 @@
+package clientv1
+
+import (
+	"net/http"
+
+	"github.com/samuelngs/universe/errors"
+)
+
+const namespace string = "client"
+
+// Error messages
+var (
+	ErrNotConnected  = errors.BadRequest(namespace, "client is not connected")
+	ErrNoAddr        = errors.BadRequest(namespace, "remote address is not specified")
+	ErrNoAuthMethods = errors.Unauthorized(namespace, "no authentication methods configured")
+	ErrNoAgent       = errors.BadRequest(namespace, "SSH_AUTH_SOCK is not set")
+	ErrNoSFTP        = errors.New(namespace, "sftp subsystem is not available", http.StatusNotImplemented)
+)
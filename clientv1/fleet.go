@@ -0,0 +1,270 @@
+package clientv1
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samuelngs/universe/errors"
+)
+
+// ErrTimeout error
+var ErrTimeout = errors.New(namespace, "command timed out", http.StatusGatewayTimeout)
+
+// FleetOption func
+type FleetOption func(*Fleet)
+
+// Fleet runs the same command across many hosts
+type Fleet struct {
+	// Hosts in [user@]<addr>[:<port>] form
+	Hosts []string
+	// Maximum number of hosts running at once, every host when zero
+	Concurrency int
+	// Time allowed per host, including dial and handshake, unlimited when
+	// zero
+	Timeout time.Duration
+	// Writer receiving host prefixed output as it arrives, output is only
+	// captured when nil
+	Output io.Writer
+	// Client options applied to every host
+	Options []Option
+}
+
+// NewFleet creates fleet executor
+func NewFleet(hosts []string, opts ...FleetOption) *Fleet {
+	f := &Fleet{
+		Hosts:       hosts,
+		Concurrency: 10,
+		Timeout:     5 * time.Minute,
+		Options:     make([]Option, 0),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// Concurrency option
+func Concurrency(n int) FleetOption {
+	return func(f *Fleet) {
+		if n > 0 {
+			f.Concurrency = n
+		}
+	}
+}
+
+// HostTimeout option
+func HostTimeout(d time.Duration) FleetOption {
+	return func(f *Fleet) {
+		if d > 0 {
+			f.Timeout = d
+		}
+	}
+}
+
+// Output option
+func Output(w io.Writer) FleetOption {
+	return func(f *Fleet) {
+		f.Output = w
+	}
+}
+
+// ClientOptions option
+func ClientOptions(opts ...Option) FleetOption {
+	return func(f *Fleet) {
+		f.Options = append(f.Options, opts...)
+	}
+}
+
+// Summary of a fleet run
+type Summary struct {
+	// Command executed
+	Command string
+	// Results in host order
+	Results []*Result
+	// Hosts that exited with status 0
+	Successes []string
+	// Hosts that failed to connect or exited non-zero
+	Failures []string
+	// Hosts grouped by exit status, -1 for hosts without one
+	ExitCodes map[int][]string
+	// Wall time of the whole run
+	Duration time.Duration
+}
+
+// Failed returns true if any host failed
+func (v *Summary) Failed() bool {
+	return len(v.Failures) > 0
+}
+
+// String returns a human readable summary
+func (v *Summary) String() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%d succeeded, %d failed, %d total in %s\n", len(v.Successes), len(v.Failures), len(v.Results), v.Duration)
+	codes := make([]int, 0, len(v.ExitCodes))
+	for code := range v.ExitCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(&b, "  exit %d: %s\n", code, strings.Join(v.ExitCodes[code], ", "))
+	}
+	for _, r := range v.Results {
+		if r.Err != nil {
+			fmt.Fprintf(&b, "  %s: %v\n", r.Host, r.Err)
+		}
+	}
+	return b.String()
+}
+
+// Run executes the command on every host and waits for all of them
+func (v *Fleet) Run(cmd string) *Summary {
+	started := time.Now()
+	results := make([]*Result, len(v.Hosts))
+	concurrency := v.Concurrency
+	if concurrency <= 0 {
+		concurrency = len(v.Hosts)
+	}
+	limit := make(chan struct{}, concurrency)
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for i, host := range v.Hosts {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func(i int, host string) {
+			defer wg.Done()
+			defer func() { <-limit }()
+			results[i] = v.exec(host, cmd, &mu)
+		}(i, host)
+	}
+	wg.Wait()
+	s := &Summary{
+		Command:   cmd,
+		Results:   results,
+		Successes: make([]string, 0),
+		Failures:  make([]string, 0),
+		ExitCodes: make(map[int][]string),
+		Duration:  time.Since(started),
+	}
+	for _, r := range results {
+		if r.Success() {
+			s.Successes = append(s.Successes, r.Host)
+		} else {
+			s.Failures = append(s.Failures, r.Host)
+		}
+		s.ExitCodes[r.ExitStatus] = append(s.ExitCodes[r.ExitStatus], r.Host)
+	}
+	return s
+}
+
+// exec runs the command on a single host, the client is closed when the
+// host timeout expires which interrupts a pending dial or session
+func (v *Fleet) exec(host, cmd string, mu *sync.Mutex) *Result {
+	c := New(hostOptions(host, v.Options)...)
+	addr := c.Option().GetAddr()
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if v.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, v.Timeout)
+	}
+	defer cancel()
+	var stdout, stderr *prefixWriter
+	if v.Output != nil {
+		stdout = &prefixWriter{mu: mu, w: v.Output, prefix: host + " | "}
+		stderr = &prefixWriter{mu: mu, w: v.Output, prefix: host + " ! "}
+	}
+	done := make(chan *Result, 1)
+	go func() {
+		r := &Result{Host: addr, Command: cmd, Started: time.Now(), ExitStatus: -1}
+		if err := c.Dial(); err != nil {
+			r.Err = err
+			done <- r
+			return
+		}
+		var o, e io.Writer
+		if stdout != nil {
+			o, e = stdout, stderr
+		}
+		if res, err := c.Stream(cmd, o, e); res != nil {
+			r = res
+		} else {
+			r.Err = err
+		}
+		done <- r
+	}()
+	var r *Result
+	select {
+	case r = <-done:
+		c.Close()
+	case <-ctx.Done():
+		r = &Result{
+			Host:       addr,
+			Command:    cmd,
+			ExitStatus: -1,
+			Duration:   v.Timeout,
+			Err:        ErrTimeout,
+		}
+		// close waits for a pending handshake, do not hold the slot
+		go c.Close()
+	}
+	if stdout != nil {
+		// a timed out session may still be writing
+		stdout.Close()
+		stderr.Close()
+	}
+	return r
+}
+
+// prefixWriter writes whole lines prefixed with the host name, partial
+// lines are held until completed or closed. Output written once closed is
+// discarded.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+	closed bool
+}
+
+func (v *prefixWriter) Write(p []byte) (int, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.closed {
+		return len(p), nil
+	}
+	v.buf = append(v.buf, p...)
+	for {
+		i := bytes.IndexByte(v.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if _, err := fmt.Fprintf(v.w, "%s%s", v.prefix, v.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		v.buf = v.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Close writes the remaining partial line and stops forwarding output
+func (v *prefixWriter) Close() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.flush()
+	v.closed = true
+	return nil
+}
+
+func (v *prefixWriter) flush() {
+	if len(v.buf) > 0 && !v.closed {
+		fmt.Fprintf(v.w, "%s%s\n", v.prefix, v.buf)
+		v.buf = nil
+	}
+}
@@ -0,0 +1,111 @@
+package clientv1
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestFleetZeroValue(t *testing.T) {
+	addr := serve(t)
+	var out bytes.Buffer
+	// concurrency and timeout left at zero
+	f := &Fleet{
+		Hosts:  []string{addr, addr, addr},
+		Output: &out,
+		Options: []Option{
+			User("test"),
+			Password("test"),
+			HostKeyCallback(ssh.InsecureIgnoreHostKey()),
+		},
+	}
+	done := make(chan *Summary, 1)
+	go func() { done <- f.Run("echo hello") }()
+	var s *Summary
+	select {
+	case s = <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("fleet did not finish")
+	}
+	if s.Failed() || len(s.Successes) != 3 {
+		t.Fatalf("summary: %s", s)
+	}
+	if n := strings.Count(out.String(), addr+" | hello\n"); n != 3 {
+		t.Fatalf("output: %q", out.String())
+	}
+}
+
+func TestFleetTimeout(t *testing.T) {
+	addr := serve(t)
+	f := NewFleet([]string{addr}, HostTimeout(200*time.Millisecond), ClientOptions(
+		User("test"),
+		Password("test"),
+		HostKeyCallback(ssh.InsecureIgnoreHostKey()),
+	))
+	s := f.Run("sleep 5")
+	if !s.Failed() || s.Results[0].Err != ErrTimeout {
+		t.Fatalf("summary: %s", s)
+	}
+}
+
+func TestFleetTimeoutOutput(t *testing.T) {
+	addr := serve(t)
+	var (
+		mu  sync.Mutex
+		out bytes.Buffer
+	)
+	f := NewFleet([]string{addr}, HostTimeout(300*time.Millisecond), Output(&lockedWriter{mu: &mu, w: &out}), ClientOptions(
+		User("test"),
+		Password("test"),
+		HostKeyCallback(ssh.InsecureIgnoreHostKey()),
+	))
+	// a host still streaming output when it times out
+	s := f.Run("while :; do echo tick; done")
+	if s.Results[0].Err != ErrTimeout {
+		t.Fatalf("summary: %s", s)
+	}
+	mu.Lock()
+	n := out.Len()
+	mu.Unlock()
+	time.Sleep(500 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if n == 0 || out.Len() != n {
+		t.Fatalf("%d bytes written by the timeout, %d after", n, out.Len())
+	}
+	// every line is prefixed, the last one may have been cut by the timeout
+	for _, line := range strings.SplitAfter(out.String(), "\n") {
+		if line != "" && !strings.HasPrefix(line, addr+" | t") {
+			t.Fatalf("line %q", line)
+		}
+	}
+}
+
+func TestPrefixWriterClosed(t *testing.T) {
+	var out bytes.Buffer
+	w := &prefixWriter{mu: new(sync.Mutex), w: &out, prefix: "host | "}
+	w.Write([]byte("one\ntw"))
+	w.Close()
+	if n, err := w.Write([]byte("o\nthree\n")); n != 8 || err != nil {
+		t.Fatalf("write after close = %d, %v", n, err)
+	}
+	if got := out.String(); got != "host | one\nhost | tw\n" {
+		t.Fatalf("output: %q", got)
+	}
+}
+
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (v *lockedWriter) Write(p []byte) (int, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.w.Write(p)
+}
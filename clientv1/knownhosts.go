@@ -0,0 +1,457 @@
+package clientv1
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/samuelngs/universe/errors"
+)
+
+// HostKeyMode type
+type HostKeyMode int8
+
+// Host key verification modes
+const (
+	_ HostKeyMode = iota
+	// HostKeyStrict rejects hosts that are not already known
+	HostKeyStrict
+	// HostKeyTrustOnFirstUse asks the prompt whether an unknown host should
+	// be trusted and records it when accepted, unknown hosts are rejected
+	// without a prompt
+	HostKeyTrustOnFirstUse
+	// HostKeyAcceptNew records unknown hosts without asking, hosts known by
+	// keys of other types are rejected
+	HostKeyAcceptNew
+)
+
+func (v HostKeyMode) String() string {
+	switch {
+	case v == HostKeyStrict:
+		return "strict"
+	case v == HostKeyTrustOnFirstUse:
+		return "tofu"
+	case v == HostKeyAcceptNew:
+		return "accept-new"
+	default:
+		return "unknown"
+	}
+}
+
+// known_hosts line markers
+const (
+	markerCertAuthority string = "@cert-authority"
+	markerRevoked              = "@revoked"
+)
+
+// HostKeyPrompt is asked whether an unknown host key should be trusted
+type HostKeyPrompt func(hostname string, remote net.Addr, key ssh.PublicKey) bool
+
+// KnownHosts verifies host keys against OpenSSH known_hosts files. New
+// hosts are appended to the first file.
+type KnownHosts struct {
+	sync.Mutex
+	// Verification mode
+	Mode HostKeyMode
+	// Hash hostnames of newly recorded hosts
+	Hash bool
+	// Prompt used in trust on first use mode, unknown hosts are rejected
+	// when nil
+	Prompt HostKeyPrompt
+	files  []string
+	hosts  []*knownHost
+}
+
+// known_hosts entry
+type knownHost struct {
+	marker   string
+	patterns []string
+	key      ssh.PublicKey
+	file     string
+	line     int
+}
+
+// DefaultKnownHostsFile returns the user known_hosts path
+func DefaultKnownHostsFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
+
+// NewKnownHosts loads known_hosts files, missing files are treated as empty
+func NewKnownHosts(mode HostKeyMode, files ...string) (*KnownHosts, error) {
+	v := &KnownHosts{
+		Mode:  mode,
+		files: files,
+		hosts: make([]*knownHost, 0),
+	}
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		if err := v.load(file); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// KnownHostsFile option to verify host keys with known_hosts files, trust
+// on first use rejects unknown hosts without a prompt, see KnownHostsPrompt
+func KnownHostsFile(mode HostKeyMode, files ...string) Option {
+	return func(o *Options) {
+		o.setKnownHosts(mode, nil, files...)
+	}
+}
+
+// KnownHostsPrompt option to verify host keys with known_hosts files,
+// asking the prompt whether unknown hosts should be trusted
+func KnownHostsPrompt(prompt HostKeyPrompt, files ...string) Option {
+	return func(o *Options) {
+		o.setKnownHosts(HostKeyTrustOnFirstUse, prompt, files...)
+	}
+}
+
+// knownHosts returns the host key callback and algorithms of the files, the
+// callback fails every verification if the files cannot be loaded
+func knownHosts(mode HostKeyMode, prompt HostKeyPrompt, files ...string) (ssh.HostKeyCallback, func(string) []string) {
+	v, err := NewKnownHosts(mode, files...)
+	if err != nil {
+		return func(string, net.Addr, ssh.PublicKey) error {
+			return err
+		}, nil
+	}
+	v.Prompt = prompt
+	return v.Check, v.HostKeyAlgorithms
+}
+
+func (v *KnownHosts) load(file string) error {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		host, err := parseKnownHost(line)
+		if err != nil {
+			return errors.BadRequest(namespace, "invalid known_hosts entry").Info(fmt.Sprintf("%s:%d: %v", file, n, err))
+		}
+		if host == nil {
+			continue
+		}
+		host.file, host.line = file, n
+		v.hosts = append(v.hosts, host)
+	}
+	return scanner.Err()
+}
+
+func parseKnownHost(line []byte) (*knownHost, error) {
+	host := new(knownHost)
+	if line[0] == '@' {
+		i := bytes.IndexAny(line, " \t")
+		if i < 0 {
+			return nil, fmt.Errorf("missing host pattern")
+		}
+		host.marker = string(line[:i])
+		line = bytes.TrimSpace(line[i:])
+		switch host.marker {
+		case markerCertAuthority, markerRevoked:
+		default:
+			// unknown markers are ignored as OpenSSH does
+			return nil, nil
+		}
+	}
+	i := bytes.IndexAny(line, " \t")
+	if i < 0 {
+		return nil, fmt.Errorf("missing host key")
+	}
+	host.patterns = strings.Split(string(line[:i]), ",")
+	key, _, _, _, err := ssh.ParseAuthorizedKey(bytes.TrimSpace(line[i:]))
+	if err != nil {
+		return nil, err
+	}
+	host.key = key
+	return host, nil
+}
+
+// Check implements ssh.HostKeyCallback
+func (v *KnownHosts) Check(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	v.Lock()
+	defer v.Unlock()
+	addrs := []string{normalizeHost(hostname)}
+	if tcp, ok := remote.(*net.TCPAddr); ok {
+		if ip := normalizeHost(tcp.String()); ip != addrs[0] {
+			addrs = append(addrs, ip)
+		}
+	}
+	if cert, ok := key.(*ssh.Certificate); ok {
+		if v.checkCert(addrs, hostname, remote, cert) {
+			return nil
+		}
+		// fall back to the plain key as OpenSSH does
+		key = cert.Key
+	}
+	fingerprint := ssh.FingerprintSHA256(key)
+	if v.revoked(key) {
+		return errors.HostKeyRevoked(namespace, addrs[0], fingerprint)
+	}
+	// only keys of the same type conflict, a host may have several
+	known := make([]string, 0)
+	var others int
+	for _, addr := range addrs {
+		for _, host := range v.hosts {
+			if host.marker != "" || !host.match(addr) {
+				continue
+			}
+			if host.key.Type() != key.Type() {
+				others++
+				continue
+			}
+			if keyEqual(host.key, key) {
+				return nil
+			}
+			known = append(known, fmt.Sprintf("%s:%d", host.file, host.line))
+		}
+	}
+	if len(known) > 0 {
+		return errors.HostKeyMismatch(namespace, addrs[0], fingerprint, known...)
+	}
+	switch {
+	// a host known by keys of other types is not new
+	case v.Mode == HostKeyAcceptNew && others == 0:
+	case v.Mode == HostKeyTrustOnFirstUse && v.Prompt != nil && v.Prompt(hostname, remote, key):
+	default:
+		return errors.HostKeyUnknown(namespace, addrs[0], fingerprint)
+	}
+	return v.add(addrs[0], key)
+}
+
+// HostKeyAlgorithms returns the host key algorithms to offer the address,
+// those of the keys known for it first as OpenSSH orders them, nil when
+// the host is not known
+func (v *KnownHosts) HostKeyAlgorithms(addr string) []string {
+	v.Lock()
+	defer v.Unlock()
+	addr = normalizeHost(addr)
+	supported := ssh.SupportedAlgorithms().HostKeys
+	algorithms := make([]string, 0, len(supported))
+	add := func(algorithm string) {
+		if contains(supported, algorithm) && !contains(algorithms, algorithm) {
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+	for _, host := range v.hosts {
+		if host.marker == markerRevoked || !host.match(addr) {
+			continue
+		}
+		if host.marker == markerCertAuthority {
+			for _, algorithm := range supported {
+				if strings.Contains(algorithm, "-cert-") {
+					add(algorithm)
+				}
+			}
+			continue
+		}
+		switch typ := host.key.Type(); typ {
+		case ssh.KeyAlgoRSA:
+			add(ssh.KeyAlgoRSASHA512)
+			add(ssh.KeyAlgoRSASHA256)
+		default:
+			add(typ)
+		}
+	}
+	if len(algorithms) == 0 {
+		return nil
+	}
+	for _, algorithm := range supported {
+		add(algorithm)
+	}
+	return algorithms
+}
+
+// checkCert returns true if the certificate is signed by a trusted
+// @cert-authority and valid for the host
+func (v *KnownHosts) checkCert(addrs []string, hostname string, remote net.Addr, cert *ssh.Certificate) bool {
+	if v.revoked(cert.SignatureKey) {
+		return false
+	}
+	checker := &ssh.CertChecker{
+		IsHostAuthority: func(auth ssh.PublicKey, _ string) bool {
+			for _, addr := range addrs {
+				for _, host := range v.hosts {
+					if host.marker == markerCertAuthority && host.match(addr) && keyEqual(host.key, auth) {
+						return true
+					}
+				}
+			}
+			return false
+		},
+		IsRevoked: func(c *ssh.Certificate) bool {
+			return v.revoked(c.SignatureKey) || v.revoked(c.Key)
+		},
+	}
+	return checker.CheckHostKey(hostname, remote, cert) == nil
+}
+
+func (v *KnownHosts) revoked(key ssh.PublicKey) bool {
+	for _, host := range v.hosts {
+		if host.marker == markerRevoked && keyEqual(host.key, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// add records a new host in memory and in the first known_hosts file
+func (v *KnownHosts) add(addr string, key ssh.PublicKey) error {
+	host := &knownHost{
+		patterns: []string{addr},
+		key:      key,
+	}
+	if v.Hash {
+		host.patterns = []string{hashHost(addr)}
+	}
+	if len(v.files) > 0 && v.files[0] != "" {
+		file := v.files[0]
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		line := fmt.Sprintf("%s %s", host.patterns[0], ssh.MarshalAuthorizedKey(key))
+		if _, err := f.WriteString(line); err != nil {
+			return err
+		}
+		host.file = file
+	}
+	v.hosts = append(v.hosts, host)
+	return nil
+}
+
+// match returns true if the address matches the host patterns. A negated
+// pattern match rejects the entry even if other patterns match.
+func (v *knownHost) match(addr string) bool {
+	matched := false
+	for _, pattern := range v.patterns {
+		negate := strings.HasPrefix(pattern, "!")
+		if negate {
+			pattern = pattern[1:]
+		}
+		var ok bool
+		if strings.HasPrefix(pattern, "|1|") {
+			ok = matchHashed(pattern, addr)
+		} else {
+			ok = wildcard(pattern, addr)
+		}
+		switch {
+		case ok && negate:
+			return false
+		case ok:
+			matched = true
+		}
+	}
+	return matched
+}
+
+// normalizeHost converts <addr>:<port> to known_hosts notation, the port
+// is omitted when it is the default
+func normalizeHost(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return strings.Trim(addr, "[]")
+	}
+	if port == "22" {
+		return host
+	}
+	return "[" + host + "]:" + port
+}
+
+func hashHost(addr string) string {
+	salt := make([]byte, sha1.Size)
+	rand.Read(salt)
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(addr))
+	enc := base64.StdEncoding
+	return "|1|" + enc.EncodeToString(salt) + "|" + enc.EncodeToString(mac.Sum(nil))
+}
+
+func matchHashed(pattern, addr string) bool {
+	parts := strings.Split(pattern[3:], "|")
+	if len(parts) != 2 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+	sum, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(addr))
+	return hmac.Equal(mac.Sum(nil), sum)
+}
+
+// wildcard matches OpenSSH patterns where '*' matches any sequence and '?'
+// matches exactly one character
+func wildcard(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if wildcard(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || !strings.EqualFold(pattern[:1], s[:1]) {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
+
+func keyEqual(a, b ssh.PublicKey) bool {
+	return a.Type() == b.Type() && bytes.Equal(a.Marshal(), b.Marshal())
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
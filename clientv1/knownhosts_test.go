@@ -0,0 +1,129 @@
+package clientv1
+
+import (
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/samuelngs/universe/errors"
+	"github.com/samuelngs/universe/pkg/crypto"
+	"github.com/samuelngs/universe/server"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func testHostKey(t *testing.T) ssh.PublicKey {
+	k, err := crypto.GenerateKey(crypto.KeyEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := k.Signer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer.PublicKey()
+}
+
+func TestKnownHostsTrustOnFirstUse(t *testing.T) {
+	remote := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 22}
+	key := testHostKey(t)
+	for _, c := range []struct {
+		name   string
+		prompt HostKeyPrompt
+		trust  bool
+	}{
+		{"no prompt", nil, false},
+		{"declined", func(string, net.Addr, ssh.PublicKey) bool { return false }, false},
+		{"accepted", func(string, net.Addr, ssh.PublicKey) bool { return true }, true},
+	} {
+		file := filepath.Join(t.TempDir(), "known_hosts")
+		v, err := NewKnownHosts(HostKeyTrustOnFirstUse, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.Prompt = c.prompt
+		err = v.Check("example.com:22", remote, key)
+		if trusted := err == nil; trusted != c.trust {
+			t.Fatalf("%s: trusted = %v, %v", c.name, trusted, err)
+		}
+		if !c.trust {
+			continue
+		}
+		// recorded for the next connection, strict from now on
+		again, err := NewKnownHosts(HostKeyStrict, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := again.Check("example.com:22", remote, key); err != nil {
+			t.Fatalf("%s: not recorded: %v", c.name, err)
+		}
+		if err := again.Check("example.com:22", remote, testHostKey(t)); err == nil {
+			t.Fatalf("%s: changed key accepted", c.name)
+		}
+	}
+}
+
+func TestKnownHostsPromptOption(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	remote := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 22}
+	var asked int
+	o := newOptions(KnownHostsPrompt(func(string, net.Addr, ssh.PublicKey) bool {
+		asked++
+		return true
+	}, file))
+	key := testHostKey(t)
+	if err := o.HostKeyCallback("example.com:22", remote, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.HostKeyCallback("example.com:22", remote, key); err != nil || asked != 1 {
+		t.Fatalf("asked %d times, %v", asked, err)
+	}
+	o = newOptions(KnownHostsFile(HostKeyTrustOnFirstUse, filepath.Join(t.TempDir(), "known_hosts")))
+	if err := o.HostKeyCallback("example.com:22", remote, key); err == nil {
+		t.Fatal("unknown host trusted without a prompt")
+	}
+}
+
+func TestKnownHostsOtherKeyType(t *testing.T) {
+	ed, err := crypto.GenerateKey(crypto.KeyEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsa, err := crypto.GenerateKey(crypto.KeyRSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edSigner, _ := ed.Signer()
+	rsaSigner, _ := rsa.Signer()
+	addr := serve(t, server.HostKey(ed), server.HostKey(rsa))
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	host := normalizeHost(addr)
+	if err := ioutil.WriteFile(file, []byte(host+" "+string(ssh.MarshalAuthorizedKey(rsaSigner.PublicKey()))), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the ed25519 key is not a mismatch of the rsa one
+	remote, _ := net.ResolveTCPAddr("tcp", addr)
+	v, err := NewKnownHosts(HostKeyAcceptNew, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.Check(addr, remote, edSigner.PublicKey())
+	if e, ok := err.(*errors.HostKeyError); !ok || e.Mismatch() {
+		t.Fatalf("err = %v", err)
+	}
+	if algorithms := v.HostKeyAlgorithms(addr); len(algorithms) < 2 || algorithms[0] != ssh.KeyAlgoRSASHA512 || algorithms[1] != ssh.KeyAlgoRSASHA256 {
+		t.Fatalf("algorithms = %v", algorithms)
+	}
+	if algorithms := v.HostKeyAlgorithms("unknown.example.com:22"); algorithms != nil {
+		t.Fatalf("algorithms of an unknown host = %v", algorithms)
+	}
+
+	// the server offers ed25519 first, the known rsa key is asked for
+	c := New(Addr(addr), User("test"), Password("test"), KnownHostsFile(HostKeyStrict, file))
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+}
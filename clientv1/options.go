@@ -0,0 +1,293 @@
+package clientv1
+
+import (
+	"net"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/samuelngs/universe/pkg/crypto"
+)
+
+// Option func
+type Option func(*Options)
+
+// Options for Secure Shell client
+type Options struct {
+	sync.RWMutex
+	// Remote user name
+	User string
+	// Remote <addr>:<port>, port 22 is assumed when omitted
+	Addr string
+	// Private keys used for public key authentication
+	Keys []*crypto.PrivateKey
+	// Password used for password authentication
+	Password string
+	// Use keys held by the local ssh-agent
+	Agent bool
+	// Dial and handshake timeout
+	Timeout time.Duration
+	// Client version string sent to the server
+	ClientVersion string
+	// Host key verification, defaults to strict checking against the user
+	// known_hosts file
+	HostKeyCallback ssh.HostKeyCallback
+	// Host key algorithms offered for the <addr>:<port>, the defaults when
+	// nil or empty. Set along with the known_hosts files.
+	HostKeyAlgorithms func(addr string) []string
+}
+
+// newOptions creates new option
+func newOptions(opts ...Option) *Options {
+	o := &Options{
+		User:    currentUser(),
+		Keys:    make([]*crypto.PrivateKey, 0),
+		Timeout: 30 * time.Second,
+	}
+	o.HostKeyCallback, o.HostKeyAlgorithms = knownHosts(HostKeyStrict, nil, DefaultKnownHostsFile())
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// User option
+func User(s string) Option {
+	return func(o *Options) {
+		o.SetUser(s)
+	}
+}
+
+// Addr option
+func Addr(s string) Option {
+	return func(o *Options) {
+		o.SetAddr(s)
+	}
+}
+
+// Key option
+func Key(k *crypto.PrivateKey) Option {
+	return func(o *Options) {
+		o.AddKey(k)
+	}
+}
+
+// Password option
+func Password(s string) Option {
+	return func(o *Options) {
+		o.SetPassword(s)
+	}
+}
+
+// Agent option
+func Agent(b bool) Option {
+	return func(o *Options) {
+		o.SetAgent(b)
+	}
+}
+
+// Timeout option
+func Timeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.SetTimeout(d)
+	}
+}
+
+// ClientVersion option
+func ClientVersion(s string) Option {
+	return func(o *Options) {
+		o.Lock()
+		defer o.Unlock()
+		o.ClientVersion = s
+	}
+}
+
+// HostKeyCallback option
+func HostKeyCallback(f ssh.HostKeyCallback) Option {
+	return func(o *Options) {
+		o.SetHostKeyCallback(f)
+	}
+}
+
+// SetUser to set remote user
+func (v *Options) SetUser(s string) *Options {
+	v.Lock()
+	defer v.Unlock()
+	if len(s) > 0 {
+		v.User = s
+	}
+	return v
+}
+
+// SetAddr to set remote address
+func (v *Options) SetAddr(s string) *Options {
+	v.Lock()
+	defer v.Unlock()
+	if len(s) > 0 {
+		v.Addr = s
+	}
+	return v
+}
+
+// AddKey to add private key for public key authentication
+func (v *Options) AddKey(k *crypto.PrivateKey) *Options {
+	v.Lock()
+	defer v.Unlock()
+	if k != nil {
+		v.Keys = append(v.Keys, k)
+	}
+	return v
+}
+
+// SetPassword to set password for password authentication
+func (v *Options) SetPassword(s string) *Options {
+	v.Lock()
+	defer v.Unlock()
+	v.Password = s
+	return v
+}
+
+// SetAgent to enable or disable ssh-agent authentication
+func (v *Options) SetAgent(enable bool) *Options {
+	v.Lock()
+	defer v.Unlock()
+	v.Agent = enable
+	return v
+}
+
+// SetTimeout to set dial timeout
+func (v *Options) SetTimeout(d time.Duration) *Options {
+	v.Lock()
+	defer v.Unlock()
+	if d > 0 {
+		v.Timeout = d
+	}
+	return v
+}
+
+// SetHostKeyCallback to set host key verification, the default host key
+// algorithms are offered
+func (v *Options) SetHostKeyCallback(f ssh.HostKeyCallback) *Options {
+	v.Lock()
+	defer v.Unlock()
+	if f != nil {
+		v.HostKeyCallback = f
+		v.HostKeyAlgorithms = nil
+	}
+	return v
+}
+
+// setKnownHosts verifies host keys with known_hosts files, offering the
+// algorithms of the keys known first
+func (v *Options) setKnownHosts(mode HostKeyMode, prompt HostKeyPrompt, files ...string) *Options {
+	v.Lock()
+	defer v.Unlock()
+	v.HostKeyCallback, v.HostKeyAlgorithms = knownHosts(mode, prompt, files...)
+	return v
+}
+
+// GetUser to return remote user
+func (v *Options) GetUser() string {
+	v.RLock()
+	defer v.RUnlock()
+	return v.User
+}
+
+// GetAddr to return remote address with port
+func (v *Options) GetAddr() string {
+	v.RLock()
+	defer v.RUnlock()
+	return hostport(v.Addr)
+}
+
+// clone returns a copy of the options targeting a different address
+func (v *Options) clone(addr string) *Options {
+	v.RLock()
+	defer v.RUnlock()
+	return &Options{
+		User:              v.User,
+		Addr:              addr,
+		Keys:              append([]*crypto.PrivateKey(nil), v.Keys...),
+		Password:          v.Password,
+		Agent:             v.Agent,
+		Timeout:           v.Timeout,
+		ClientVersion:     v.ClientVersion,
+		HostKeyCallback:   v.HostKeyCallback,
+		HostKeyAlgorithms: v.HostKeyAlgorithms,
+	}
+}
+
+// config builds ssh client config, the returned closer releases the
+// ssh-agent connection if one was opened
+func (v *Options) config() (*ssh.ClientConfig, func(), error) {
+	v.RLock()
+	defer v.RUnlock()
+	release := func() {}
+	methods := make([]ssh.AuthMethod, 0)
+	if v.Agent {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if sock == "" {
+			return nil, release, ErrNoAgent
+		}
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			return nil, release, err
+		}
+		release = func() { conn.Close() }
+		methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+	if len(v.Keys) > 0 {
+		signers := make([]ssh.Signer, 0, len(v.Keys))
+		for _, key := range v.Keys {
+			signer, err := key.Signer()
+			if err != nil {
+				release()
+				return nil, func() {}, err
+			}
+			signers = append(signers, signer)
+		}
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	if v.Password != "" {
+		methods = append(methods, ssh.Password(v.Password))
+	}
+	if len(methods) == 0 {
+		release()
+		return nil, func() {}, ErrNoAuthMethods
+	}
+	var algorithms []string
+	if v.HostKeyAlgorithms != nil {
+		algorithms = v.HostKeyAlgorithms(hostport(v.Addr))
+	}
+	return &ssh.ClientConfig{
+		User:              v.User,
+		Auth:              methods,
+		Timeout:           v.Timeout,
+		ClientVersion:     v.ClientVersion,
+		HostKeyCallback:   v.HostKeyCallback,
+		HostKeyAlgorithms: algorithms,
+	}, release, nil
+}
+
+// hostport appends default ssh port to address if missing
+func hostport(addr string) string {
+	if addr == "" {
+		return addr
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return net.JoinHostPort(strings.Trim(addr, "[]"), "22")
+	}
+	return addr
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
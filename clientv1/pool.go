@@ -0,0 +1,379 @@
+package clientv1
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// PoolOption func
+type PoolOption func(*Pool)
+
+// Pool keeps authenticated connections per host and multiplexes sessions
+// over them. Broken connections are evicted and redialed on demand.
+type Pool struct {
+	sync.Mutex
+	// Maximum sessions multiplexed over one connection
+	MaxSessions int
+	// Maximum connections per host, 0 for unlimited
+	MaxConnections int
+	// Interval between keepalive requests, 0 disables keepalives
+	KeepAlive time.Duration
+	// Idle connections are closed after this duration, 0 keeps them open
+	IdleTimeout time.Duration
+	// Client options applied to every host, read once per host
+	Options []Option
+	cond    *sync.Cond
+	hosts   map[string][]*pooled
+	options map[string]*Options
+	closed  bool
+	done    chan struct{}
+}
+
+// pooled connection
+type pooled struct {
+	key      string
+	conn     *ssh.Client
+	release  func()
+	sessions int
+	full     bool
+	broken   bool
+	used     time.Time
+}
+
+// NewPool creates connection pool
+func NewPool(opts ...PoolOption) *Pool {
+	p := &Pool{
+		MaxSessions: 10,
+		KeepAlive:   30 * time.Second,
+		IdleTimeout: 5 * time.Minute,
+		Options:     make([]Option, 0),
+		hosts:       make(map[string][]*pooled),
+		options:     make(map[string]*Options),
+		done:        make(chan struct{}),
+	}
+	p.cond = sync.NewCond(&p.Mutex)
+	for _, opt := range opts {
+		opt(p)
+	}
+	go p.maintain()
+	return p
+}
+
+// MaxSessions option
+func MaxSessions(n int) PoolOption {
+	return func(p *Pool) {
+		if n > 0 {
+			p.MaxSessions = n
+		}
+	}
+}
+
+// MaxConnections option
+func MaxConnections(n int) PoolOption {
+	return func(p *Pool) {
+		p.MaxConnections = n
+	}
+}
+
+// KeepAlive option
+func KeepAlive(d time.Duration) PoolOption {
+	return func(p *Pool) {
+		p.KeepAlive = d
+	}
+}
+
+// IdleTimeout option
+func IdleTimeout(d time.Duration) PoolOption {
+	return func(p *Pool) {
+		p.IdleTimeout = d
+	}
+}
+
+// PoolClientOptions option
+func PoolClientOptions(opts ...Option) PoolOption {
+	return func(p *Pool) {
+		p.Options = append(p.Options, opts...)
+	}
+}
+
+// Session multiplexed over a pooled connection, Close returns the slot to
+// the pool
+type Session struct {
+	*ssh.Session
+	Host  string
+	pool  *Pool
+	entry *pooled
+	once  sync.Once
+}
+
+// Close closes the session and releases its pool slot
+func (v *Session) Close() error {
+	err := v.Session.Close()
+	v.once.Do(func() {
+		v.pool.put(v.entry)
+	})
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// Session opens a new session to the host, in [user@]<addr>[:<port>] form
+func (v *Pool) Session(host string) (*Session, error) {
+	o := v.host(host)
+	key := o.GetUser() + "@" + o.GetAddr()
+	// a connection may have been dropped without us noticing, retry once
+	// on a fresh connection before giving up
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		var (
+			entry   *pooled
+			conn    *ssh.Client
+			session *ssh.Session
+		)
+		entry, conn, err = v.get(key, o)
+		if err != nil {
+			return nil, err
+		}
+		session, err = conn.NewSession()
+		if err == nil {
+			return &Session{Session: session, Host: o.GetAddr(), pool: v, entry: entry}, nil
+		}
+		v.Lock()
+		entry.sessions--
+		if _, ok := err.(*ssh.OpenChannelError); ok {
+			// the server refused another channel, stop assigning sessions
+			// to this connection until one is released
+			entry.full = true
+		} else {
+			entry.broken = true
+			v.evict(entry)
+		}
+		v.cond.Broadcast()
+		v.Unlock()
+	}
+	return nil, err
+}
+
+// Run executes command on the host over a pooled connection
+func (v *Pool) Run(host, cmd string) (*Result, error) {
+	return v.Stream(host, cmd, nil, nil)
+}
+
+// Stream executes command on the host over a pooled connection, copying
+// output to the writers as it arrives
+func (v *Pool) Stream(host, cmd string, stdout, stderr io.Writer) (*Result, error) {
+	session, err := v.Session(host)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	return execute(session.Session, session.Host, cmd, stdout, stderr)
+}
+
+// Close closes every pooled connection
+func (v *Pool) Close() error {
+	v.Lock()
+	defer v.Unlock()
+	if v.closed {
+		return nil
+	}
+	v.closed = true
+	close(v.done)
+	for key, entries := range v.hosts {
+		for _, entry := range entries {
+			if entry.conn != nil {
+				entry.conn.Close()
+				entry.release()
+				entry.conn = nil
+			}
+		}
+		delete(v.hosts, key)
+	}
+	v.cond.Broadcast()
+	return nil
+}
+
+// host returns the client options of the host, built on first use so the
+// known_hosts files are not read again for every session
+func (v *Pool) host(host string) *Options {
+	v.Lock()
+	defer v.Unlock()
+	o, ok := v.options[host]
+	if !ok {
+		o = newOptions(hostOptions(host, v.Options)...)
+		v.options[host] = o
+	}
+	return o
+}
+
+// get reserves a session slot on a connection to the host, dialing a new
+// connection when every existing one is full
+func (v *Pool) get(key string, o *Options) (*pooled, *ssh.Client, error) {
+	v.Lock()
+	for {
+		if v.closed {
+			v.Unlock()
+			return nil, nil, ErrNotConnected
+		}
+		entries := v.hosts[key]
+		for _, entry := range entries {
+			if entry.conn == nil || entry.broken || entry.full || entry.sessions >= v.MaxSessions {
+				continue
+			}
+			entry.sessions++
+			entry.used = time.Now()
+			conn := entry.conn
+			v.Unlock()
+			return entry, conn, nil
+		}
+		if v.MaxConnections <= 0 || len(entries) < v.MaxConnections {
+			break
+		}
+		v.cond.Wait()
+	}
+	// reserve the connection while dialing so concurrent callers honour
+	// the connection limit
+	entry := &pooled{key: key, sessions: 1, used: time.Now()}
+	v.hosts[key] = append(v.hosts[key], entry)
+	v.Unlock()
+
+	conn, release, err := dial(o)
+
+	v.Lock()
+	defer v.Unlock()
+	if err != nil || v.closed {
+		v.remove(entry)
+		v.cond.Broadcast()
+		if err == nil {
+			conn.Close()
+			release()
+			err = ErrNotConnected
+		}
+		return nil, nil, err
+	}
+	entry.conn, entry.release = conn, release
+	go v.watch(entry, conn)
+	v.cond.Broadcast()
+	return entry, conn, nil
+}
+
+// put releases a session slot, broken connections are closed once their
+// last session is gone
+func (v *Pool) put(entry *pooled) {
+	v.Lock()
+	defer v.Unlock()
+	entry.sessions--
+	entry.full = false
+	entry.used = time.Now()
+	if entry.broken {
+		v.evict(entry)
+	}
+	v.cond.Broadcast()
+}
+
+// watch evicts the connection when it is closed by the remote end
+func (v *Pool) watch(entry *pooled, conn *ssh.Client) {
+	conn.Wait()
+	v.Lock()
+	defer v.Unlock()
+	entry.broken = true
+	v.evict(entry)
+	v.cond.Broadcast()
+}
+
+// evict removes the connection from the pool and closes it, must be called
+// with the lock held
+func (v *Pool) evict(entry *pooled) {
+	v.remove(entry)
+	if entry.conn != nil {
+		entry.conn.Close()
+		entry.release()
+		entry.conn = nil
+	}
+}
+
+func (v *Pool) remove(entry *pooled) {
+	entries := v.hosts[entry.key]
+	for i, o := range entries {
+		if o == entry {
+			entries = append(entries[:i], entries[i+1:]...)
+			break
+		}
+	}
+	if len(entries) == 0 {
+		delete(v.hosts, entry.key)
+	} else {
+		v.hosts[entry.key] = entries
+	}
+}
+
+// maintain sends keepalives and closes idle connections
+func (v *Pool) maintain() {
+	interval := v.KeepAlive
+	if interval <= 0 || (v.IdleTimeout > 0 && v.IdleTimeout < interval) {
+		interval = v.IdleTimeout
+	}
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-v.done:
+			return
+		case <-ticker.C:
+		}
+		conns := make([]*ssh.Client, 0)
+		v.Lock()
+		for _, entries := range v.hosts {
+			for _, entry := range append([]*pooled(nil), entries...) {
+				switch {
+				case entry.conn == nil:
+				case v.IdleTimeout > 0 && entry.sessions == 0 && time.Since(entry.used) > v.IdleTimeout:
+					v.evict(entry)
+				case v.KeepAlive > 0:
+					conns = append(conns, entry.conn)
+				}
+			}
+		}
+		v.Unlock()
+		for _, conn := range conns {
+			go keepalive(conn, v.KeepAlive)
+		}
+	}
+}
+
+// keepalive closes the connection if the server does not answer in time,
+// which in turn evicts it from the pool
+func keepalive(conn *ssh.Client, timeout time.Duration) {
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := conn.SendRequest("keepalive@openssh.com", true, nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			conn.Close()
+		}
+	case <-time.After(timeout):
+		conn.Close()
+	}
+}
+
+// hostOptions appends user and address options parsed from a
+// [user@]<addr>[:<port>] host string
+func hostOptions(host string, opts []Option) []Option {
+	o := append([]Option(nil), opts...)
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		o = append(o, User(host[:i]))
+		host = host[i+1:]
+	}
+	return append(o, Addr(host))
+}
@@ -0,0 +1,37 @@
+package clientv1
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestPoolReusesOptions(t *testing.T) {
+	addr := serve(t)
+	var built int
+	p := NewPool(PoolClientOptions(
+		User("test"),
+		Password("test"),
+		HostKeyCallback(ssh.InsecureIgnoreHostKey()),
+		func(*Options) { built++ },
+	))
+	defer p.Close()
+	for i := 0; i < 5; i++ {
+		r, err := p.Run(addr, "echo ok")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(r.Stdout) != "ok\n" || r.ExitStatus != 0 {
+			t.Fatalf("result: %q, exit status %d", r.Stdout, r.ExitStatus)
+		}
+	}
+	if built != 1 {
+		t.Fatalf("options built %d times", built)
+	}
+	p.Lock()
+	conns := len(p.hosts["test@"+addr])
+	p.Unlock()
+	if conns != 1 {
+		t.Fatalf("%d connections", conns)
+	}
+}
@@ -0,0 +1,59 @@
+package clientv1
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Result of a remote command
+type Result struct {
+	// Remote <addr>:<port>
+	Host string
+	// Command executed, empty for interactive shells
+	Command string
+	// Captured standard output
+	Stdout []byte
+	// Captured standard error
+	Stderr []byte
+	// Exit status, -1 when the remote did not report one
+	ExitStatus int
+	// Signal that terminated the remote process, if any
+	Signal string
+	// Time the command was started
+	Started time.Time
+	// Time taken by the command
+	Duration time.Duration
+	// Transport or session error
+	Err error
+}
+
+// Success returns true if the command exited with status 0
+func (v *Result) Success() bool {
+	return v.Err == nil && v.ExitStatus == 0
+}
+
+// String returns result object in string format
+func (v *Result) String() string {
+	o := map[string]interface{}{
+		"host":     v.Host,
+		"status":   v.ExitStatus,
+		"duration": v.Duration.String(),
+	}
+	if v.Command != "" {
+		o["command"] = v.Command
+	}
+	if len(v.Stdout) > 0 {
+		o["stdout"] = string(v.Stdout)
+	}
+	if len(v.Stderr) > 0 {
+		o["stderr"] = string(v.Stderr)
+	}
+	if v.Signal != "" {
+		o["signal"] = v.Signal
+	}
+	if v.Err != nil {
+		o["error"] = v.Err.Error()
+	}
+	b, _ := json.Marshal(o)
+	return string(b[:])
+}
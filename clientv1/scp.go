@@ -0,0 +1,306 @@
+package clientv1
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/samuelngs/universe/errors"
+)
+
+// scp session speaking the legacy rcp protocol
+type scp struct {
+	*transfer
+	session *ssh.Session
+	w       io.WriteCloser
+	r       *bufio.Reader
+}
+
+func (v *transfer) scp(conn *ssh.Client, mode, target string) (*scp, error) {
+	session, err := conn.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	w, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	cmd := "scp " + mode
+	if v.recursive {
+		cmd += " -r"
+	}
+	if v.preserve {
+		cmd += " -p"
+	}
+	if err := session.Start(cmd + " " + quote(target)); err != nil {
+		session.Close()
+		return nil, err
+	}
+	return &scp{transfer: v, session: session, w: w, r: bufio.NewReader(r)}, nil
+}
+
+// close finishes the protocol and waits for the remote scp to exit
+func (v *scp) close() error {
+	v.w.Close()
+	defer v.session.Close()
+	return v.session.Wait()
+}
+
+// ack reads the remote response, non-zero responses carry a message
+func (v *scp) ack() error {
+	b, err := v.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if b == 0 {
+		return nil
+	}
+	msg, _ := v.r.ReadString('\n')
+	return errors.InternalServer(namespace, "scp failure").Info(strings.TrimSpace(msg))
+}
+
+func (v *scp) send(format string, args ...interface{}) error {
+	if _, err := fmt.Fprintf(v.w, format, args...); err != nil {
+		return err
+	}
+	return v.ack()
+}
+
+func (v *transfer) scpUpload(conn *ssh.Client, local, remote string, fi os.FileInfo) error {
+	s, err := v.scp(conn, "-t", remote)
+	if err != nil {
+		return err
+	}
+	if err := s.ack(); err != nil {
+		s.close()
+		return err
+	}
+	if err := s.upload(local, fi); err != nil {
+		s.close()
+		return err
+	}
+	return s.close()
+}
+
+func (v *scp) upload(local string, fi os.FileInfo) error {
+	if v.preserve {
+		t := fi.ModTime().Unix()
+		if err := v.send("T%d 0 %d 0\n", t, t); err != nil {
+			return err
+		}
+	}
+	if fi.IsDir() {
+		if err := v.send("D%04o 0 %s\n", fi.Mode().Perm(), fi.Name()); err != nil {
+			return err
+		}
+		entries, err := ioutil.ReadDir(local)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && !entry.Mode().IsRegular() {
+				continue
+			}
+			if err := v.upload(filepath.Join(local, entry.Name()), entry); err != nil {
+				return err
+			}
+		}
+		return v.send("E\n")
+	}
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := v.send("C%04o %d %s\n", fi.Mode().Perm(), fi.Size(), fi.Name()); err != nil {
+		return err
+	}
+	if err := v.copy(v.w, f, local, 0, fi.Size()); err != nil {
+		return err
+	}
+	if _, err := v.w.Write([]byte{0}); err != nil {
+		return err
+	}
+	return v.ack()
+}
+
+func (v *transfer) scpDownload(conn *ssh.Client, remote, local string) error {
+	s, err := v.scp(conn, "-f", remote)
+	if err != nil {
+		return err
+	}
+	if err := s.download(local); err != nil {
+		s.close()
+		return err
+	}
+	return s.close()
+}
+
+// directory being received, with the times its T message carried
+type scpDir struct {
+	path  string
+	times []time.Time
+}
+
+// download reads control messages from the remote scp, directories are
+// tracked as a stack of local paths. A T message applies to the following
+// C or D message, directory times are set once the directory is closed so
+// the files written into it do not change them again.
+func (v *scp) download(local string) error {
+	var (
+		stack []scpDir
+		times []time.Time
+	)
+	target := func(name string) string {
+		if len(stack) > 0 {
+			return filepath.Join(stack[len(stack)-1].path, name)
+		}
+		if fi, err := os.Stat(local); err == nil && fi.IsDir() {
+			return filepath.Join(local, name)
+		}
+		return local
+	}
+	if _, err := v.w.Write([]byte{0}); err != nil {
+		return err
+	}
+	for {
+		typ, err := v.r.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line, err := v.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch typ {
+		case 1, 2:
+			return errors.InternalServer(namespace, "scp failure").Info(line)
+		case 'T':
+			var mtime, atime int64
+			if _, err := fmt.Sscanf(line, "%d 0 %d 0", &mtime, &atime); err != nil {
+				return err
+			}
+			times = []time.Time{time.Unix(atime, 0), time.Unix(mtime, 0)}
+		case 'D':
+			mode, _, name, err := parseControl(line)
+			if err != nil {
+				return err
+			}
+			dir := target(name)
+			if err := os.MkdirAll(dir, mode|0700); err != nil {
+				return err
+			}
+			if v.preserve {
+				os.Chmod(dir, mode)
+			}
+			stack = append(stack, scpDir{path: dir, times: times})
+			times = nil
+		case 'E':
+			if len(stack) == 0 {
+				return errors.InternalServer(namespace, "scp protocol error").Info("unexpected end of directory")
+			}
+			dir := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if v.preserve && dir.times != nil {
+				if err := os.Chtimes(dir.path, dir.times[0], dir.times[1]); err != nil {
+					return err
+				}
+			}
+			times = nil
+		case 'C':
+			mode, size, name, err := parseControl(line)
+			if err != nil {
+				return err
+			}
+			file := target(name)
+			if _, err := v.w.Write([]byte{0}); err != nil {
+				return err
+			}
+			if err := v.receive(file, mode, size); err != nil {
+				return err
+			}
+			if err := v.ack(); err != nil {
+				return err
+			}
+			if v.preserve && times != nil {
+				if err := os.Chtimes(file, times[0], times[1]); err != nil {
+					return err
+				}
+			}
+			times = nil
+		default:
+			return errors.InternalServer(namespace, "scp protocol error").Info(fmt.Sprintf("unexpected message %q", typ))
+		}
+		if _, err := v.w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+}
+
+func (v *scp) receive(file string, mode os.FileMode, size int64) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if err := v.copy(f, v.r, file, 0, size); err != nil {
+		f.Close()
+		return err
+	}
+	if v.preserve {
+		if err := f.Chmod(mode); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// parseControl parses "<mode> <size> <name>" of C and D messages
+func parseControl(line string) (os.FileMode, int64, string, error) {
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) != 3 {
+		return 0, 0, "", errors.InternalServer(namespace, "scp protocol error").Info(line)
+	}
+	mode, err := strconv.ParseUint(parts[0], 8, 32)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	size, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	name := parts[2]
+	if !validName(name) {
+		return 0, 0, "", errors.Forbidden(namespace, "scp protocol error").Info(fmt.Sprintf("invalid file name %q", name))
+	}
+	return os.FileMode(mode).Perm(), size, name, nil
+}
+
+// validName reports whether a name sent by the server is a single path
+// element, one that cannot escape the local directory
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsRune(name, '/') && !strings.ContainsRune(name, filepath.Separator)
+}
+
+// quote wraps a path in single quotes for the remote shell
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
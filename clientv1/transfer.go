@@ -0,0 +1,367 @@
+package clientv1
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/samuelngs/universe/errors"
+	"github.com/samuelngs/universe/pkg/sftp"
+)
+
+// Progress of a single file transfer
+type Progress struct {
+	// Local path of the file
+	Path string
+	// Bytes transferred so far, including resumed bytes
+	Bytes int64
+	// Size of the file
+	Total int64
+}
+
+// ProgressFunc is called as file data is transferred
+type ProgressFunc func(Progress)
+
+// TransferOption func
+type TransferOption func(*transfer)
+
+// transfer settings
+type transfer struct {
+	recursive bool
+	preserve  bool
+	resume    bool
+	progress  ProgressFunc
+}
+
+// Recursive option to copy directories
+func Recursive(b bool) TransferOption {
+	return func(t *transfer) {
+		t.recursive = b
+	}
+}
+
+// Preserve option to keep modes and modification times
+func Preserve(b bool) TransferOption {
+	return func(t *transfer) {
+		t.preserve = b
+	}
+}
+
+// Resume option to continue partial transfers. A destination file shorter
+// than the source is appended to, one of the same size is skipped. Resume
+// is not supported by the scp fallback.
+func Resume(b bool) TransferOption {
+	return func(t *transfer) {
+		t.resume = b
+	}
+}
+
+// OnProgress option
+func OnProgress(f ProgressFunc) TransferOption {
+	return func(t *transfer) {
+		t.progress = f
+	}
+}
+
+func newTransfer(opts ...TransferOption) *transfer {
+	t := new(transfer)
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+func (v *client) Upload(local, remote string, opts ...TransferOption) error {
+	v.RLock()
+	conn := v.conn
+	v.RUnlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+	return newTransfer(opts...).upload(conn, local, remote)
+}
+
+func (v *client) Download(remote, local string, opts ...TransferOption) error {
+	v.RLock()
+	conn := v.conn
+	v.RUnlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+	return newTransfer(opts...).download(conn, remote, local)
+}
+
+// upload copies local files over sftp, falling back to scp when the
+// server has no sftp subsystem
+func (v *transfer) upload(conn *ssh.Client, local, remote string) error {
+	fi, err := os.Stat(local)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() && !v.recursive {
+		return errors.BadRequest(namespace, "source is a directory").Info(local)
+	}
+	sc, err := openSFTP(conn)
+	if err == ErrNoSFTP {
+		return v.scpUpload(conn, local, remote, fi)
+	}
+	if err != nil {
+		return err
+	}
+	defer sc.Close()
+	if rfi, err := sc.Stat(remote); err == nil && rfi.IsDir() {
+		remote = path.Join(remote, filepath.Base(local))
+	}
+	if fi.IsDir() {
+		return v.uploadDir(sc, local, remote, fi)
+	}
+	return v.uploadFile(sc, local, remote, fi)
+}
+
+func (v *transfer) uploadDir(sc *sftp.Client, local, remote string, fi os.FileInfo) error {
+	if rfi, err := sc.Stat(remote); err != nil {
+		if err := sc.Mkdir(remote, fi.Mode().Perm()); err != nil {
+			return err
+		}
+	} else if !rfi.IsDir() {
+		return errors.BadRequest(namespace, "destination is not a directory").Info(remote)
+	}
+	entries, err := ioutil.ReadDir(local)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		src, dst := filepath.Join(local, entry.Name()), path.Join(remote, entry.Name())
+		switch {
+		case entry.IsDir():
+			err = v.uploadDir(sc, src, dst, entry)
+		case entry.Mode().IsRegular():
+			err = v.uploadFile(sc, src, dst, entry)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if v.preserve {
+		if err := sc.Chmod(remote, fi.Mode()); err != nil {
+			return err
+		}
+		return sc.Chtimes(remote, fi.ModTime(), fi.ModTime())
+	}
+	return nil
+}
+
+func (v *transfer) uploadFile(sc *sftp.Client, local, remote string, fi os.FileInfo) error {
+	var offset int64
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if v.resume {
+		if rfi, err := sc.Stat(remote); err == nil && rfi.Mode().IsRegular() && rfi.Size() <= fi.Size() {
+			offset, flag = rfi.Size(), os.O_WRONLY
+		}
+	}
+	src, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := sc.OpenFile(remote, flag, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := src.Seek(offset, io.SeekStart); err != nil {
+		dst.Close()
+		return err
+	}
+	if _, err := dst.Seek(offset, io.SeekStart); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := v.copy(dst, src, local, offset, fi.Size()); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if v.preserve {
+		if err := sc.Chmod(remote, fi.Mode()); err != nil {
+			return err
+		}
+		return sc.Chtimes(remote, fi.ModTime(), fi.ModTime())
+	}
+	return nil
+}
+
+// download copies remote files over sftp, falling back to scp when the
+// server has no sftp subsystem
+func (v *transfer) download(conn *ssh.Client, remote, local string) error {
+	sc, err := openSFTP(conn)
+	if err == ErrNoSFTP {
+		return v.scpDownload(conn, remote, local)
+	}
+	if err != nil {
+		return err
+	}
+	defer sc.Close()
+	fi, err := sc.Stat(remote)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() && !v.recursive {
+		return errors.BadRequest(namespace, "source is a directory").Info(remote)
+	}
+	if lfi, err := os.Stat(local); err == nil && lfi.IsDir() {
+		local = filepath.Join(local, path.Base(remote))
+	}
+	if fi.IsDir() {
+		return v.downloadDir(sc, remote, local, fi)
+	}
+	return v.downloadFile(sc, remote, local, fi)
+}
+
+func (v *transfer) downloadDir(sc *sftp.Client, remote, local string, fi os.FileInfo) error {
+	if err := os.MkdirAll(local, fi.Mode().Perm()|0700); err != nil {
+		return err
+	}
+	entries, err := sc.ReadDir(remote)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !validName(entry.Name()) {
+			return errors.Forbidden(namespace, "sftp protocol error").Info(fmt.Sprintf("invalid file name %q", entry.Name()))
+		}
+		src, dst := path.Join(remote, entry.Name()), filepath.Join(local, entry.Name())
+		switch {
+		case entry.IsDir():
+			err = v.downloadDir(sc, src, dst, entry)
+		case entry.Mode().IsRegular():
+			err = v.downloadFile(sc, src, dst, entry)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if v.preserve {
+		if err := os.Chmod(local, fi.Mode().Perm()); err != nil {
+			return err
+		}
+		return os.Chtimes(local, fi.ModTime(), fi.ModTime())
+	}
+	return nil
+}
+
+func (v *transfer) downloadFile(sc *sftp.Client, remote, local string, fi os.FileInfo) error {
+	var offset int64
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if v.resume {
+		if lfi, err := os.Stat(local); err == nil && lfi.Mode().IsRegular() && lfi.Size() <= fi.Size() {
+			offset, flag = lfi.Size(), os.O_WRONLY
+		}
+	}
+	src, err := sc.Open(remote)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(local, flag, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := src.Seek(offset, io.SeekStart); err != nil {
+		dst.Close()
+		return err
+	}
+	if _, err := dst.Seek(offset, io.SeekStart); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := v.copy(dst, src, local, offset, fi.Size()); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if v.preserve {
+		if err := os.Chmod(local, fi.Mode().Perm()); err != nil {
+			return err
+		}
+		return os.Chtimes(local, fi.ModTime(), fi.ModTime())
+	}
+	return nil
+}
+
+// copy transfers the remaining bytes of a file reporting progress
+func (v *transfer) copy(dst io.Writer, src io.Reader, name string, offset, total int64) error {
+	if v.progress != nil {
+		v.progress(Progress{Path: name, Bytes: offset, Total: total})
+		dst = &progressWriter{w: dst, f: v.progress, p: Progress{Path: name, Bytes: offset, Total: total}}
+	}
+	_, err := io.CopyN(dst, src, total-offset)
+	return err
+}
+
+// progressWriter reports written bytes
+type progressWriter struct {
+	w io.Writer
+	f ProgressFunc
+	p Progress
+}
+
+func (v *progressWriter) Write(b []byte) (int, error) {
+	n, err := v.w.Write(b)
+	v.p.Bytes += int64(n)
+	v.f(v.p)
+	return n, err
+}
+
+// sftp subsystem channel, closing it closes the session
+type subsystem struct {
+	io.WriteCloser
+	session *ssh.Session
+}
+
+func (v *subsystem) Close() error {
+	v.WriteCloser.Close()
+	return v.session.Close()
+}
+
+// openSFTP starts the sftp subsystem on a new session, ErrNoSFTP if the
+// server refuses the subsystem
+func openSFTP(conn *ssh.Client) (*sftp.Client, error) {
+	session, err := conn.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	w, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	ok, err := session.SendRequest("subsystem", true, ssh.Marshal(struct{ Name string }{"sftp"}))
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	if !ok {
+		session.Close()
+		return nil, ErrNoSFTP
+	}
+	sc, err := sftp.NewClient(r, &subsystem{w, session})
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	return sc, nil
+}
@@ -0,0 +1,306 @@
+package clientv1
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/samuelngs/universe/pkg/sftp/sftptest"
+)
+
+// serveSFTP starts an ssh server whose sessions only serve the sftp
+// subsystem with the handler
+func serveSFTP(t *testing.T, handler func(ch ssh.Channel) error) string {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) { return nil, nil },
+	}
+	config.AddHostKey(signer)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn, chans, reqs, err := ssh.NewServerConn(c, config)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				go ssh.DiscardRequests(reqs)
+				for nc := range chans {
+					ch, reqs, err := nc.Accept()
+					if err != nil {
+						return
+					}
+					go func() {
+						for req := range reqs {
+							var sub struct{ Name string }
+							ok := req.Type == "subsystem" && ssh.Unmarshal(req.Payload, &sub) == nil && sub.Name == "sftp"
+							req.Reply(ok, nil)
+							if !ok {
+								continue
+							}
+							go func() {
+								var status uint32
+								if err := handler(ch); err != nil {
+									status = 1
+								}
+								ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+								ch.Close()
+							}()
+						}
+					}()
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// sftpServers are the subsystems transfers are tested against, the
+// OpenSSH sftp-server when installed
+func sftpServers(t *testing.T) map[string]func(ch ssh.Channel) error {
+	servers := map[string]func(ch ssh.Channel) error{
+		"sftptest": func(ch ssh.Channel) error { return new(sftptest.Server).Serve(ch, ch) },
+	}
+	for _, bin := range []string{"/usr/lib/openssh/sftp-server", "/usr/libexec/openssh/sftp-server", "/usr/libexec/sftp-server", "/usr/lib/ssh/sftp-server"} {
+		if _, err := os.Stat(bin); err == nil {
+			servers["sftp-server"] = func(ch ssh.Channel) error {
+				cmd := exec.Command(bin)
+				cmd.Stdin, cmd.Stdout, cmd.Stderr = ch, ch, ch.Stderr()
+				return cmd.Run()
+			}
+			break
+		}
+	}
+	if _, ok := servers["sftp-server"]; !ok {
+		t.Log("sftp-server is not installed, testing against sftptest only")
+	}
+	return servers
+}
+
+func TestOpenSFTPRefused(t *testing.T) {
+	c := dialTest(t, serve(t)).(*client)
+	if _, err := openSFTP(c.conn); err != ErrNoSFTP {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+// tree is a file hierarchy with distinct modes and times
+type tree map[string]struct {
+	mode  os.FileMode
+	data  []byte
+	mtime time.Time
+}
+
+func (v tree) write(t *testing.T, root string) {
+	// parents first so they exist, their modes and times last since
+	// creating entries changes them
+	for _, name := range v.names() {
+		e := v[name]
+		p := filepath.Join(root, name)
+		var err error
+		if e.mode.IsDir() {
+			err = os.MkdirAll(p, 0700)
+		} else {
+			err = ioutil.WriteFile(p, e.data, 0600)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	names := v.names()
+	for i := len(names) - 1; i >= 0; i-- {
+		e, p := v[names[i]], filepath.Join(root, names[i])
+		if err := os.Chmod(p, e.mode.Perm()); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, e.mtime, e.mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func (v tree) check(t *testing.T, root string) {
+	t.Helper()
+	for name, e := range v {
+		p := filepath.Join(root, name)
+		fi, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode() != e.mode {
+			t.Errorf("%q mode = %v, want %v", name, fi.Mode(), e.mode)
+		}
+		if !fi.ModTime().Equal(e.mtime) {
+			t.Errorf("%q mtime = %v, want %v", name, fi.ModTime(), e.mtime)
+		}
+		if !e.mode.IsDir() {
+			if b, err := ioutil.ReadFile(p); err != nil || !bytes.Equal(b, e.data) {
+				t.Errorf("%q content differs: %d bytes, %v", name, len(b), err)
+			}
+		}
+	}
+}
+
+// names in creation order, parents before children
+func (v tree) names() []string {
+	var names []string
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestSFTPRoundTrip(t *testing.T) {
+	big := make([]byte, 300*1024)
+	rand.Read(big)
+	files := tree{
+		"":          {os.ModeDir | 0750, nil, time.Unix(1000000000, 0)},
+		"big":       {0640, big, time.Unix(1100000000, 0)},
+		"run":       {0755, []byte("#!/bin/sh\n"), time.Unix(1200000000, 0)},
+		"sub":       {os.ModeDir | 0700, nil, time.Unix(1300000000, 0)},
+		"sub/file":  {0600, []byte("data"), time.Unix(1400000000, 0)},
+		"sub/empty": {os.ModeDir | 0755, nil, time.Unix(1500000000, 0)},
+	}
+	for name, handler := range sftpServers(t) {
+		t.Run(name, func(t *testing.T) {
+			c := dialTest(t, serveSFTP(t, handler))
+			src, remote, dst := filepath.Join(t.TempDir(), "tree"), t.TempDir(), t.TempDir()
+			files.write(t, src)
+			// into an existing directory, then back to a new one
+			if err := c.Upload(src, remote, Recursive(true), Preserve(true)); err != nil {
+				t.Fatal(err)
+			}
+			files.check(t, filepath.Join(remote, "tree"))
+			if err := c.Download(filepath.Join(remote, "tree"), filepath.Join(dst, "copy"), Recursive(true), Preserve(true)); err != nil {
+				t.Fatal(err)
+			}
+			files.check(t, filepath.Join(dst, "copy"))
+
+			// a single file, without preserving its mode and time
+			if err := c.Upload(filepath.Join(src, "sub", "file"), filepath.Join(remote, "single"), Preserve(false)); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Download(filepath.Join(remote, "single"), dst); err != nil {
+				t.Fatal(err)
+			}
+			fi, err := os.Stat(filepath.Join(dst, "single"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.ModTime().Equal(files["sub/file"].mtime) {
+				t.Error("mtime preserved without Preserve")
+			}
+			if b, err := ioutil.ReadFile(filepath.Join(dst, "single")); err != nil || string(b) != "data" {
+				t.Fatalf("file = %q, %v", b, err)
+			}
+			if err := c.Download(filepath.Join(remote, "tree"), dst); err == nil {
+				t.Fatal("directory downloaded without Recursive")
+			}
+		})
+	}
+}
+
+func TestSFTPDownloadInvalidName(t *testing.T) {
+	for _, name := range []string{"../escaped", "sub/../../escaped", "/tmp/escaped", ""} {
+		srv := &sftptest.Server{Names: func(dir, entry string) string {
+			if entry == "victim" {
+				return name
+			}
+			return entry
+		}}
+		c := dialTest(t, serveSFTP(t, func(ch ssh.Channel) error { return srv.Serve(ch, ch) }))
+		remote := filepath.Join(t.TempDir(), "remote")
+		if err := os.MkdirAll(remote, 0755); err != nil {
+			t.Fatal(err)
+		}
+		// the listed name resolves on the server too
+		for _, p := range []string{filepath.Join(remote, "victim"), filepath.Join(remote, name)} {
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(p, []byte("evil"), 0644); err != nil && name != "" {
+				t.Fatal(err)
+			}
+		}
+		dst := filepath.Join(t.TempDir(), "a", "b")
+		err := c.Download(remote, dst, Recursive(true))
+		if err == nil || !strings.Contains(err.Error(), "invalid file name") {
+			t.Fatalf("%q: err = %v", name, err)
+		}
+		// nothing written next to or above the destination
+		for _, p := range []string{filepath.Join(dst, "..", "escaped"), filepath.Join(dst, "..", "..", "escaped"), filepath.Join(dst, "escaped")} {
+			if _, err := os.Stat(p); err == nil {
+				t.Fatalf("%q: %s written", name, p)
+			}
+		}
+	}
+}
+
+func TestDownloadPreservesDirectoryTimes(t *testing.T) {
+	if _, err := exec.LookPath("scp"); err != nil {
+		t.Skip("scp is not installed")
+	}
+	c := dialTest(t, serve(t))
+	src := filepath.Join(t.TempDir(), "tree")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "sub", "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	times := map[string]time.Time{
+		"":         time.Unix(1000000000, 0),
+		"sub":      time.Unix(1100000000, 0),
+		"sub/file": time.Unix(1200000000, 0),
+	}
+	// files first, writing into a directory changes its mtime
+	for _, name := range []string{"sub/file", "sub", ""} {
+		if err := os.Chtimes(filepath.Join(src, name), times[name], times[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dst := filepath.Join(t.TempDir(), "copy")
+	if err := c.Download(src, dst, Recursive(true), Preserve(true)); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range times {
+		fi, err := os.Stat(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fi.ModTime().Equal(want) {
+			t.Errorf("%q mtime = %v, want %v", name, fi.ModTime(), want)
+		}
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dst, "sub", "file")); err != nil || string(b) != "data" {
+		t.Fatalf("file = %q, %v", b, err)
+	}
+}
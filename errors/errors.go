@@ -89,6 +89,8 @@ func Read(e error) *Error {
 	switch o := e.(type) {
 	case *Error:
 		return o
+	case *HostKeyError:
+		return o.Err()
 	default:
 		return Forbidden(DefaultRef, e.Error())
 	}
@@ -143,3 +145,64 @@ func InternalServer(ref, reason string) *Error {
 		Status: http.StatusText(http.StatusInternalServerError),
 	}
 }
+
+// HostKeyError is returned when a remote host key cannot be verified
+// against the known hosts database.
+type HostKeyError struct {
+	Ref         string   `json:"resource"`
+	Code        int      `json:"code"`
+	Reason      string   `json:"reason"`
+	Status      string   `json:"status"`
+	Host        string   `json:"host"`
+	Fingerprint string   `json:"fingerprint"`
+	Known       []string `json:"known,omitempty"`
+}
+
+func (e *HostKeyError) Error() string {
+	b, _ := json.Marshal(e)
+	return string(b[:])
+}
+
+// Mismatch returns true if the host is known with a different key
+func (e *HostKeyError) Mismatch() bool {
+	return len(e.Known) > 0
+}
+
+// Err returns the generic error representation
+func (e *HostKeyError) Err() *Error {
+	return &Error{
+		Ref:    e.Ref,
+		Code:   e.Code,
+		Reason: e.Reason,
+		Detail: e.Host + " " + e.Fingerprint,
+		Status: e.Status,
+	}
+}
+
+func newHostKeyError(base *Error, host, fingerprint string, known []string) *HostKeyError {
+	return &HostKeyError{
+		Ref:         base.Ref,
+		Code:        base.Code,
+		Reason:      base.Reason,
+		Status:      base.Status,
+		Host:        host,
+		Fingerprint: fingerprint,
+		Known:       known,
+	}
+}
+
+// HostKeyUnknown error
+func HostKeyUnknown(ref, host, fingerprint string) *HostKeyError {
+	return newHostKeyError(Unauthorized(ref, "host key is not known"), host, fingerprint, nil)
+}
+
+// HostKeyMismatch error, known lists the file:line locations of the
+// keys recorded for the host
+func HostKeyMismatch(ref, host, fingerprint string, known ...string) *HostKeyError {
+	return newHostKeyError(Forbidden(ref, "host key does not match known hosts"), host, fingerprint, known)
+}
+
+// HostKeyRevoked error
+func HostKeyRevoked(ref, host, fingerprint string) *HostKeyError {
+	return newHostKeyError(Forbidden(ref, "host key has been revoked"), host, fingerprint, nil)
+}
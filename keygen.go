@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/samuelngs/universe/pkg/crypto"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// keygen generates a private key and its public key, usage:
+//
+//	universe keygen [-type <type>] <file>
+func keygen(args []string) int {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	var (
+		typ  = fs.String("type", crypto.KeyEd25519, "key type: "+strings.Join(crypto.KeyTypes(), ", "))
+		bits = fs.Int("bits", 3072, "size of rsa keys")
+	)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: universe keygen [flags] <file>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	k, err := crypto.GenerateKey(*typ, *bits)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := k.Export(fs.Arg(0)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	signer, err := k.Signer()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("%s %s\n", signer.PublicKey().Type(), ssh.FingerprintSHA256(signer.PublicKey()))
+	return 0
+}
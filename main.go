@@ -4,22 +4,43 @@ import (
 	"flag"
 	"log"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/samuelngs/universe/admin"
 	"github.com/samuelngs/universe/pkg/crypto"
 	"github.com/samuelngs/universe/server"
 )
 
 var (
 	rsa           = flag.String("rsa-key", os.Getenv("HOME")+"/.ssh/id_rsa", "path to the private key file")
+	hostkeys      = flag.String("host-keys", "", "comma separated additional host key files, rsa, ecdsa or ed25519")
 	addr          = flag.String("tcp-address", "127.0.0.1:2222", "<addr>:<port> to listen on for tcp clients")
+	listen        = flag.String("listen", "", "comma separated additional addresses to listen on, [<addr>]:<port> or unix:<path>")
 	protocol      = flag.Int("protocol", 2, "protocol version")
 	noauth        = flag.Bool("disable-authentication", false, "disable authentication")
 	allowpassword = flag.Bool("password-authentication", false, "allow password authentication")
 	allowrsa      = flag.Bool("rsa-authentication", true, "allow rsa key authentication")
+	config        = flag.String("config", "", "path to a yaml, toml or json configuration file, reloaded on SIGHUP")
+	adminaddr     = flag.String("admin-address", "", "<addr>:<port> on localhost or unix:<path> to serve the admin api on, disabled if empty")
+	auditpath     = flag.String("audit-log", "", "path to the audit log, disabled if empty")
+	preset        = flag.String("algorithms", "", "algorithm preset: "+strings.Join(server.Presets(), ", ")+", x/crypto defaults if empty")
+	grace         = flag.Duration("grace-period", 30*time.Second, "time to wait for sessions to exit on shutdown")
 )
 
 func main() {
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "run":
+			os.Exit(run(os.Args[2:]))
+		case "audit":
+			os.Exit(auditlog(os.Args[2:]))
+		case "keygen":
+			os.Exit(keygen(os.Args[2:]))
+		}
+	}
+
 	flag.Parse()
 
 	key, err := crypto.Import(*rsa)
@@ -27,23 +48,57 @@ func main() {
 		log.Fatal(err)
 	}
 
-	ser := server.New(
+	opts := []server.Option{
 		server.ListenAddr(*addr),
 		server.ClientAuth(*noauth),
 		server.PasswordAuthentication(*allowpassword),
 		server.RSAAuthentication(*allowrsa),
 		server.Protocol(*protocol),
 		server.HostKey(key),
+		server.GracePeriod(*grace),
 		server.Metadata(map[string]string{
 			"x-machine-id": "",
 		}),
-	)
+	}
+	if *hostkeys != "" {
+		for _, s := range strings.Split(*hostkeys, ",") {
+			k, err := crypto.Import(strings.TrimSpace(s))
+			if err != nil {
+				log.Fatal(err)
+			}
+			opts = append(opts, server.HostKey(k))
+		}
+	}
+	if *listen != "" {
+		opts = append(opts, server.Listen(*addr))
+		for _, s := range strings.Split(*listen, ",") {
+			opts = append(opts, server.Listen(strings.TrimSpace(s)))
+		}
+	}
+	if *auditpath != "" {
+		opts = append(opts, server.AuditLog(*auditpath))
+	}
+	if *preset != "" {
+		opts = append(opts, server.AlgorithmPreset(*preset))
+	}
+	if *config != "" {
+		opts = append(opts, server.ConfigFile(*config))
+	}
+	ser := server.New(opts...)
 
 	ser.Use(func(c *server.Context) error {
 		log.Printf("RemoteAddr: %v", c.RemoteAddr())
 		return nil
 	})
 
+	if *adminaddr != "" {
+		go func() {
+			if err := admin.New(ser, admin.ListenAddr(*adminaddr)).Run(); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+
 	go func() {
 		for {
 			select {
@@ -55,5 +110,7 @@ func main() {
 		}
 	}()
 
-	ser.Run()
+	if err := ser.Run(); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,436 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Record types
+const (
+	TypeOpen         string = "open"
+	TypeAuth                = "auth"
+	TypeSessionStart        = "session-start"
+	TypeSessionEnd          = "session-end"
+	TypeExec                = "exec"
+	TypeForward             = "forward"
+	TypeAdmin               = "admin"
+	TypeCheckpoint          = "checkpoint"
+)
+
+// Defaults
+const (
+	DefaultInterval = time.Minute
+	DefaultEvery    = 100
+)
+
+var (
+	// ErrClosed error
+	ErrClosed = errors.New("audit log is closed")
+	// ErrUnsealed error, records follow the last signed checkpoint. The log
+	// was truncated, or the writer is still running or crashed.
+	ErrUnsealed = errors.New("audit log does not end with a signed checkpoint")
+	// ErrKeyMismatch error
+	ErrKeyMismatch = errors.New("checkpoint is signed by another key")
+	// ErrNoKey error, checkpoints carry their own key and prove nothing
+	// unless checked against a trusted one
+	ErrNoKey = errors.New("no key to verify the checkpoints with")
+	// ErrWeakSignature error
+	ErrWeakSignature = errors.New("checkpoint is signed with SHA-1")
+)
+
+// hash of the record preceding the first one
+var genesis = hex.EncodeToString(make([]byte, sha256.Size))
+
+// Record of the audit log, one JSON object per line. Hash covers the
+// record without hash, signature and key, Prev is the hash of the previous
+// record. Checkpoints carry the host key signature of their hash.
+type Record struct {
+	Seq       uint64            `json:"seq"`
+	Time      time.Time         `json:"time"`
+	Type      string            `json:"type"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	Prev      string            `json:"prev"`
+	Hash      string            `json:"hash,omitempty"`
+	Key       string            `json:"key,omitempty"`
+	Signature string            `json:"signature,omitempty"`
+}
+
+// digest returns the record hash
+func (v Record) digest() string {
+	v.Hash, v.Key, v.Signature = "", "", ""
+	b, _ := json.Marshal(v)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Log is an append-only audit log
+type Log interface {
+	Record(typ string, fields map[string]string) error
+	Checkpoint() error
+	Close() error
+}
+
+// Option func
+type Option func(*Options)
+
+// Options for the audit log
+type Options struct {
+	// Time between signed checkpoints
+	Interval time.Duration
+	// Records between signed checkpoints
+	Every int
+	// Called with every checkpoint written, to anchor the last checkpoint
+	// outside of the log
+	OnCheckpoint func(seq uint64, hash string)
+}
+
+// Interval option
+func Interval(d time.Duration) Option {
+	return func(o *Options) {
+		if d > 0 {
+			o.Interval = d
+		}
+	}
+}
+
+// Every option
+func Every(n int) Option {
+	return func(o *Options) {
+		if n > 0 {
+			o.Every = n
+		}
+	}
+}
+
+// OnCheckpoint option
+func OnCheckpoint(fn func(seq uint64, hash string)) Option {
+	return func(o *Options) {
+		o.OnCheckpoint = fn
+	}
+}
+
+// internal log
+type log struct {
+	sync.Mutex
+	file    *os.File
+	signer  ssh.Signer
+	seq     uint64
+	prev    string
+	pending int
+	every   int
+	notify  func(seq uint64, hash string)
+	stop    chan struct{}
+	done    chan struct{}
+	// bytes of a torn last record cut by resume
+	torn int64
+}
+
+// Open appends to the audit log at path, the chain continues from the last
+// record of an existing log. Checkpoints are signed with the signer. A last
+// record left torn by a crash is cut, and the number of bytes cut is
+// recorded as "torn" in the open record.
+func Open(path string, signer ssh.Signer, opts ...Option) (Log, error) {
+	o := &Options{Interval: DefaultInterval, Every: DefaultEvery}
+	for _, opt := range opts {
+		opt(o)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	v := &log{
+		file:   f,
+		signer: signer,
+		prev:   genesis,
+		every:  o.Every,
+		notify: o.OnCheckpoint,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if err := v.resume(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	var fields map[string]string
+	if v.torn > 0 {
+		fields = map[string]string{"torn": strconv.FormatInt(v.torn, 10)}
+	}
+	if err := v.Record(TypeOpen, fields); err != nil {
+		f.Close()
+		return nil, err
+	}
+	go v.tick(o.Interval)
+	return v, nil
+}
+
+// resume reads the last record of an existing log. Records are written
+// whole with their newline, a last line without one was torn by a crash
+// and is cut.
+func (v *log) resume() error {
+	r := bufio.NewReader(v.file)
+	var (
+		last, line []byte
+		size       int64
+		err        error
+	)
+	for {
+		line, err = r.ReadBytes('\n')
+		if err != nil {
+			break
+		}
+		last = append(last[:0], line...)
+		size += int64(len(line))
+	}
+	if err != io.EOF {
+		return err
+	}
+	if len(line) > 0 {
+		if err := v.file.Truncate(size); err != nil {
+			return err
+		}
+		v.torn = int64(len(line))
+	}
+	if len(last) == 0 {
+		return nil
+	}
+	var rec Record
+	if err := json.Unmarshal(last, &rec); err != nil {
+		return fmt.Errorf("last record is corrupted: %v", err)
+	}
+	v.seq = rec.Seq + 1
+	v.prev = rec.Hash
+	return nil
+}
+
+// tick writes a checkpoint every interval while records are pending
+func (v *log) tick(interval time.Duration) {
+	defer close(v.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-v.stop:
+			return
+		case <-ticker.C:
+			v.Lock()
+			if v.pending > 0 && v.file != nil {
+				v.checkpoint()
+			}
+			v.Unlock()
+		}
+	}
+}
+
+// append chains and writes the record
+func (v *log) append(r Record) error {
+	if v.file == nil {
+		return ErrClosed
+	}
+	r.Seq = v.seq
+	r.Time = time.Now().UTC()
+	r.Prev = v.prev
+	r.Hash = r.digest()
+	if r.Type == TypeCheckpoint {
+		sig, err := sign(v.signer, []byte(r.Hash))
+		if err != nil {
+			return err
+		}
+		r.Key = base64.StdEncoding.EncodeToString(v.signer.PublicKey().Marshal())
+		r.Signature = base64.StdEncoding.EncodeToString(ssh.Marshal(sig))
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := v.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	v.seq++
+	v.prev = r.Hash
+	return nil
+}
+
+// sign signs with rsa-sha2-256 rather than SHA-1 for RSA keys
+func sign(signer ssh.Signer, data []byte) (*ssh.Signature, error) {
+	if s, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		return s.SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoRSASHA256)
+	}
+	return signer.Sign(rand.Reader, data)
+}
+
+func (v *log) checkpoint() error {
+	if err := v.append(Record{Type: TypeCheckpoint}); err != nil {
+		return err
+	}
+	v.pending = 0
+	if err := v.file.Sync(); err != nil {
+		return err
+	}
+	if v.notify != nil {
+		v.notify(v.seq-1, v.prev)
+	}
+	return nil
+}
+
+// Record appends a record, a checkpoint follows every so many records
+func (v *log) Record(typ string, fields map[string]string) error {
+	v.Lock()
+	defer v.Unlock()
+	if err := v.append(Record{Type: typ, Fields: fields}); err != nil {
+		return err
+	}
+	v.pending++
+	if v.pending >= v.every {
+		return v.checkpoint()
+	}
+	return nil
+}
+
+// Checkpoint appends a signed checkpoint
+func (v *log) Checkpoint() error {
+	v.Lock()
+	defer v.Unlock()
+	return v.checkpoint()
+}
+
+// Close seals the log with a final checkpoint
+func (v *log) Close() error {
+	v.Lock()
+	if v.file == nil {
+		v.Unlock()
+		return nil
+	}
+	err := v.checkpoint()
+	if e := v.file.Close(); err == nil {
+		err = e
+	}
+	v.file = nil
+	v.Unlock()
+	close(v.stop)
+	<-v.done
+	return err
+}
+
+// Report of a verified audit log
+type Report struct {
+	// Records read, checkpoints included
+	Records int
+	// Signed checkpoints
+	Checkpoints int
+	// Records after the last checkpoint
+	Unsealed int
+	// Fingerprints of the keys checkpoints were signed with
+	Keys []string
+	// Sequence and hash of the last checkpoint
+	LastSeq  uint64
+	LastHash string
+}
+
+// Verify reads the audit log and checks the chain and the checkpoint
+// signatures, every checkpoint must be signed by key. A log that does not
+// end with a checkpoint returns the report and ErrUnsealed.
+//
+// A log cut right after a checkpoint still verifies, compare the last
+// checkpoint of the report with one recorded elsewhere, see OnCheckpoint.
+func Verify(r io.Reader, key ssh.PublicKey) (*Report, error) {
+	report := &Report{Keys: make([]string, 0)}
+	if key == nil {
+		return report, ErrNoKey
+	}
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	prev, seq := genesis, uint64(0)
+	for line := 1; s.Scan(); line++ {
+		var rec Record
+		d := json.NewDecoder(bytes.NewReader(s.Bytes()))
+		d.DisallowUnknownFields()
+		if err := d.Decode(&rec); err != nil {
+			return report, fmt.Errorf("line %d: malformed record: %v", line, err)
+		}
+		switch {
+		case line == 1 && rec.Prev != genesis:
+			return report, fmt.Errorf("line %d: log does not start at the first record, head was truncated", line)
+		case rec.Seq != seq:
+			return report, fmt.Errorf("line %d: sequence %d, expected %d, records were removed or reordered", line, rec.Seq, seq)
+		case rec.Prev != prev:
+			return report, fmt.Errorf("line %d: chain is broken, the previous record was modified", line)
+		case rec.Hash != rec.digest():
+			return report, fmt.Errorf("line %d: hash mismatch, the record was modified", line)
+		}
+		report.Records++
+		report.Unsealed++
+		if rec.Type == TypeCheckpoint {
+			fingerprint, err := verify(rec, key)
+			if err != nil {
+				return report, fmt.Errorf("line %d: %v", line, err)
+			}
+			if !contains(report.Keys, fingerprint) {
+				report.Keys = append(report.Keys, fingerprint)
+			}
+			report.Checkpoints++
+			report.Unsealed = 0
+			report.LastSeq, report.LastHash = rec.Seq, rec.Hash
+		}
+		prev, seq = rec.Hash, seq+1
+	}
+	if err := s.Err(); err != nil {
+		return report, err
+	}
+	if report.Unsealed > 0 {
+		return report, ErrUnsealed
+	}
+	return report, nil
+}
+
+// verify checks the checkpoint signature, returning the key fingerprint
+func verify(r Record, key ssh.PublicKey) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(r.Key)
+	if err != nil {
+		return "", fmt.Errorf("invalid checkpoint key: %v", err)
+	}
+	pub, err := ssh.ParsePublicKey(b)
+	if err != nil {
+		return "", fmt.Errorf("invalid checkpoint key: %v", err)
+	}
+	if !bytes.Equal(pub.Marshal(), key.Marshal()) {
+		return "", ErrKeyMismatch
+	}
+	b, err = base64.StdEncoding.DecodeString(r.Signature)
+	if err != nil {
+		return "", fmt.Errorf("invalid checkpoint signature: %v", err)
+	}
+	sig := new(ssh.Signature)
+	if err := ssh.Unmarshal(b, sig); err != nil {
+		return "", fmt.Errorf("invalid checkpoint signature: %v", err)
+	}
+	if sig.Format == ssh.KeyAlgoRSA {
+		return "", ErrWeakSignature
+	}
+	if err := pub.Verify([]byte(r.Hash), sig); err != nil {
+		return "", fmt.Errorf("checkpoint signature does not match: %v", err)
+	}
+	return ssh.FingerprintSHA256(pub), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
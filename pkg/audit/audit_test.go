@@ -0,0 +1,216 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func signer(t *testing.T, rsaKey bool) ssh.Signer {
+	var (
+		s   ssh.Signer
+		err error
+	)
+	if rsaKey {
+		k, e := rsa.GenerateKey(rand.Reader, 2048)
+		if e != nil {
+			t.Fatal(e)
+		}
+		s, err = ssh.NewSignerFromKey(k)
+	} else {
+		_, k, e := ed25519.GenerateKey(rand.Reader)
+		if e != nil {
+			t.Fatal(e)
+		}
+		s, err = ssh.NewSignerFromKey(k)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// write a sealed log of n records, returning its lines
+func write(t *testing.T, s ssh.Signer, n int, opts ...Option) []string {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path, s, append([]Option{Every(3)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if err := l.Record(TypeExec, map[string]string{"command": "id"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+func verifyLines(lines []string, key ssh.PublicKey) (*Report, error) {
+	return Verify(strings.NewReader(strings.Join(lines, "\n")+"\n"), key)
+}
+
+func TestVerify(t *testing.T) {
+	for _, rsaKey := range []bool{false, true} {
+		s := signer(t, rsaKey)
+		var seq uint64
+		var hash string
+		lines := write(t, s, 5, OnCheckpoint(func(n uint64, h string) {
+			seq, hash = n, h
+		}))
+		report, err := verifyLines(lines, s.PublicKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// open, 5 records and 3 checkpoints
+		if report.Records != 9 || report.Checkpoints != 3 || len(report.Keys) != 1 {
+			t.Fatalf("report = %+v", report)
+		}
+		if report.LastSeq != seq || report.LastHash != hash {
+			t.Errorf("last checkpoint %d %s, notified %d %s", report.LastSeq, report.LastHash, seq, hash)
+		}
+		var last Record
+		json.Unmarshal([]byte(lines[len(lines)-1]), &last)
+		b, _ := base64.StdEncoding.DecodeString(last.Signature)
+		sig := new(ssh.Signature)
+		ssh.Unmarshal(b, sig)
+		if want := s.PublicKey().Type(); rsaKey && sig.Format != ssh.KeyAlgoRSASHA256 || !rsaKey && sig.Format != want {
+			t.Errorf("signature format %s", sig.Format)
+		}
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	s := signer(t, false)
+	lines := write(t, s, 5)
+	edit := func(i int, fn func(*Record)) []string {
+		out := append([]string(nil), lines...)
+		var r Record
+		if err := json.Unmarshal([]byte(out[i]), &r); err != nil {
+			t.Fatal(err)
+		}
+		fn(&r)
+		b, _ := json.Marshal(r)
+		out[i] = string(b)
+		return out
+	}
+	for _, c := range []struct {
+		name  string
+		lines []string
+		err   string
+	}{
+		{"modified", edit(2, func(r *Record) { r.Fields["command"] = "true" }), "hash mismatch"},
+		{"rehashed", edit(2, func(r *Record) { r.Fields["command"] = "true"; r.Hash = r.digest() }), "chain is broken"},
+		{"removed", append(append([]string(nil), lines[:2]...), lines[3:]...), "sequence"},
+		{"reordered", append(append(append([]string(nil), lines[:1]...), lines[2], lines[1]), lines[3:]...), "sequence"},
+		{"head truncated", lines[1:], "head was truncated"},
+		{"malformed", append(append([]string(nil), lines[:2]...), "{"), "malformed"},
+		{"unknown field", append(append([]string(nil), lines[:1]...), strings.Replace(lines[1], "{", `{"extra":1,`, 1)), "malformed"},
+		{"forged signature", edit(3, func(r *Record) {
+			r.Signature = base64.StdEncoding.EncodeToString(ssh.Marshal(&ssh.Signature{Format: ssh.KeyAlgoED25519, Blob: make([]byte, 64)}))
+		}), "signature does not match"},
+	} {
+		if _, err := verifyLines(c.lines, s.PublicKey()); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: err = %v, want %q", c.name, err, c.err)
+		}
+	}
+}
+
+func TestVerifyUnsealed(t *testing.T) {
+	s := signer(t, false)
+	lines := write(t, s, 5)
+	report, err := verifyLines(lines[:len(lines)-3], s.PublicKey())
+	if err != ErrUnsealed || report.Unsealed != 2 {
+		t.Fatalf("unsealed %d, err = %v", report.Unsealed, err)
+	}
+	// cut right after a checkpoint, only the last checkpoint tells
+	report, err = verifyLines(lines[:len(lines)-1], s.PublicKey())
+	if err != nil || report.LastSeq != uint64(len(lines)-2) {
+		t.Fatalf("report = %+v, err = %v", report, err)
+	}
+}
+
+func TestVerifyKey(t *testing.T) {
+	s := signer(t, false)
+	lines := write(t, s, 1)
+	if _, err := verifyLines(lines, nil); err != ErrNoKey {
+		t.Errorf("no key: err = %v", err)
+	}
+	if _, err := verifyLines(lines, signer(t, false).PublicKey()); err == nil || !strings.Contains(err.Error(), ErrKeyMismatch.Error()) {
+		t.Errorf("other key: err = %v", err)
+	}
+}
+
+func TestVerifySHA1(t *testing.T) {
+	s := signer(t, true)
+	lines := write(t, s, 1)
+	var r Record
+	json.Unmarshal([]byte(lines[len(lines)-1]), &r)
+	sig, err := s.(ssh.AlgorithmSigner).SignWithAlgorithm(rand.Reader, []byte(r.Hash), ssh.KeyAlgoRSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Signature = base64.StdEncoding.EncodeToString(ssh.Marshal(sig))
+	b, _ := json.Marshal(r)
+	lines[len(lines)-1] = string(b)
+	if _, err := verifyLines(lines, s.PublicKey()); err == nil || !strings.Contains(err.Error(), ErrWeakSignature.Error()) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestResumeTorn(t *testing.T) {
+	s := signer(t, false)
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Record(TypeExec, map[string]string{"command": "id"})
+	l.Close()
+	// a crash in the middle of writing a record
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"seq":3,"time":"2026-`)
+	f.Close()
+
+	l, err = Open(path, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Record(TypeExec, map[string]string{"command": "id"})
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if _, err := verifyLines(lines, s.PublicKey()); err != nil {
+		t.Fatal(err)
+	}
+	var r Record
+	if err := json.Unmarshal([]byte(lines[3]), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Type != TypeOpen || r.Seq != 3 || r.Fields["torn"] != "22" {
+		t.Fatalf("record after the torn one: %+v", r)
+	}
+}
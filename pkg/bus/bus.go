@@ -0,0 +1,179 @@
+package bus
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuffer is the number of messages a subscriber may fall behind
+// before messages are dropped
+const DefaultBuffer = 64
+
+// Message published on the bus
+type Message interface {
+	Topic() string
+}
+
+// Bus fans out messages to every subscriber, publishing never blocks. A
+// subscriber whose buffer is full misses the message and the drop is
+// counted.
+type Bus interface {
+	Publish(Message)
+	Subscribe(...Option) Subscription
+	Dropped() uint64
+	Close()
+}
+
+// Subscription to the bus
+type Subscription interface {
+	C() <-chan Message
+	Dropped() uint64
+	Unsubscribe()
+}
+
+// Option func
+type Option func(*Options)
+
+// Options for a subscription
+type Options struct {
+	// Topics delivered to the subscriber, every topic when empty
+	Topics []string
+	// Messages buffered for the subscriber
+	Buffer int
+}
+
+// Topics option
+func Topics(topics ...string) Option {
+	return func(o *Options) {
+		o.Topics = append(o.Topics, topics...)
+	}
+}
+
+// Buffer option
+func Buffer(n int) Option {
+	return func(o *Options) {
+		if n >= 0 {
+			o.Buffer = n
+		}
+	}
+}
+
+// New create bus
+func New() Bus {
+	return &bus{
+		subs: make(map[*subscription]struct{}),
+	}
+}
+
+// internal bus
+type bus struct {
+	sync.RWMutex
+	subs    map[*subscription]struct{}
+	dropped uint64
+	closed  bool
+}
+
+// internal subscription
+type subscription struct {
+	bus     *bus
+	ch      chan Message
+	topics  map[string]struct{}
+	dropped uint64
+}
+
+// Publish delivers the message to every subscriber of its topic, nothing is
+// delivered once the bus is closed
+func (v *bus) Publish(m Message) {
+	v.RLock()
+	defer v.RUnlock()
+	if v.closed {
+		return
+	}
+	for s := range v.subs {
+		if !s.match(m.Topic()) {
+			continue
+		}
+		select {
+		case s.ch <- m:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+			atomic.AddUint64(&v.dropped, 1)
+		}
+	}
+}
+
+// Subscribe adds a subscriber, the subscription channel is closed right
+// away when the bus is closed
+func (v *bus) Subscribe(opts ...Option) Subscription {
+	o := &Options{Buffer: DefaultBuffer}
+	for _, opt := range opts {
+		opt(o)
+	}
+	s := &subscription{
+		bus: v,
+		ch:  make(chan Message, o.Buffer),
+	}
+	if len(o.Topics) > 0 {
+		s.topics = make(map[string]struct{}, len(o.Topics))
+		for _, topic := range o.Topics {
+			s.topics[topic] = struct{}{}
+		}
+	}
+	v.Lock()
+	defer v.Unlock()
+	if v.closed {
+		close(s.ch)
+		return s
+	}
+	v.subs[s] = struct{}{}
+	return s
+}
+
+// Dropped returns the number of messages dropped across every subscriber
+func (v *bus) Dropped() uint64 {
+	return atomic.LoadUint64(&v.dropped)
+}
+
+// Close closes every subscription channel
+func (v *bus) Close() {
+	v.Lock()
+	defer v.Unlock()
+	if v.closed {
+		return
+	}
+	v.closed = true
+	for s := range v.subs {
+		close(s.ch)
+	}
+	v.subs = nil
+}
+
+func (v *subscription) match(topic string) bool {
+	if v.topics == nil {
+		return true
+	}
+	_, ok := v.topics[topic]
+	return ok
+}
+
+// C returns the channel messages are delivered on, it is closed on
+// unsubscribe or when the bus is closed
+func (v *subscription) C() <-chan Message {
+	return v.ch
+}
+
+// Dropped returns the number of messages the subscriber missed
+func (v *subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&v.dropped)
+}
+
+// Unsubscribe removes the subscriber and closes its channel
+func (v *subscription) Unsubscribe() {
+	v.bus.Lock()
+	defer v.bus.Unlock()
+	if _, ok := v.bus.subs[v]; !ok {
+		return
+	}
+	delete(v.bus.subs, v)
+	close(v.ch)
+}
@@ -1,6 +1,10 @@
 package crypto
 
 import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -11,19 +15,40 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
+// Key types
+const (
+	KeyRSA       string = "rsa"
+	KeyEd25519          = "ed25519"
+	KeyECDSAP256        = "ecdsa-p256"
+	KeyECDSAP384        = "ecdsa-p384"
+	KeyECDSAP521        = "ecdsa-p521"
+)
+
 var (
 	// ErrInvalidPEM error
 	ErrInvalidPEM = errors.New("invalid PEM encoded key file")
 	// ErrInvalidBlockT error
 	ErrInvalidBlockT = errors.New("invalid PEM key block type")
+	// ErrInvalidKeyType error
+	ErrInvalidKeyType = errors.New("unsupported key type")
 )
 
+// PEM block types of the supported private keys
+var blocks = map[string]bool{
+	"RSA PRIVATE KEY":     true,
+	"EC PRIVATE KEY":      true,
+	"PRIVATE KEY":         true,
+	"OPENSSH PRIVATE KEY": true,
+}
+
 // PrivateKey struct
 type PrivateKey struct {
-	key *rsa.PrivateKey
+	key  gocrypto.Signer
+	path string
 }
 
-// Import to load key from filesystem
+// Import to load key from filesystem, rsa, ecdsa and ed25519 keys are
+// read in PKCS#1, SEC 1, PKCS#8 and OpenSSH formats
 func Import(path string) (*PrivateKey, error) {
 	b, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -33,27 +58,96 @@ func Import(path string) (*PrivateKey, error) {
 	if block == nil {
 		return nil, ErrInvalidPEM
 	}
-	if got, exp := block.Type, "RSA PRIVATE KEY"; got != exp {
+	if !blocks[block.Type] {
 		return nil, ErrInvalidBlockT
 	}
-	k, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	raw, err := ssh.ParseRawPrivateKey(b)
 	if err != nil {
 		return nil, err
 	}
-	return &PrivateKey{k}, nil
+	var k gocrypto.Signer
+	switch key := raw.(type) {
+	case *rsa.PrivateKey:
+		k = key
+	case *ecdsa.PrivateKey:
+		k = key
+	case ed25519.PrivateKey:
+		k = key
+	case *ed25519.PrivateKey:
+		k = *key
+	default:
+		return nil, ErrInvalidKeyType
+	}
+	if keyType(k) == "" {
+		return nil, ErrInvalidKeyType
+	}
+	return &PrivateKey{k, path}, nil
 }
 
 // Generate to generate rsa key
 func Generate(opts ...int) (*PrivateKey, error) {
-	var bits = 2048
-	for _, opt := range opts {
-		bits = opt
+	return GenerateKey(KeyRSA, opts...)
+}
+
+// GenerateKey to generate a key of the type, the optional size only
+// applies to rsa keys
+func GenerateKey(typ string, opts ...int) (*PrivateKey, error) {
+	var (
+		k   gocrypto.Signer
+		err error
+	)
+	switch typ {
+	case KeyRSA:
+		var bits = 2048
+		for _, opt := range opts {
+			bits = opt
+		}
+		k, err = rsa.GenerateKey(rand.Reader, bits)
+	case KeyEd25519:
+		_, k, err = ed25519.GenerateKey(rand.Reader)
+	case KeyECDSAP256:
+		k, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyECDSAP384:
+		k, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyECDSAP521:
+		k, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	default:
+		return nil, ErrInvalidKeyType
 	}
-	private, err := rsa.GenerateKey(rand.Reader, bits)
 	if err != nil {
 		return nil, err
 	}
-	return &PrivateKey{private}, nil
+	return &PrivateKey{k, ""}, nil
+}
+
+// KeyTypes returns the key types that can be generated
+func KeyTypes() []string {
+	return []string{KeyRSA, KeyEd25519, KeyECDSAP256, KeyECDSAP384, KeyECDSAP521}
+}
+
+// keyType returns the type of the key, empty if unsupported
+func keyType(k gocrypto.Signer) string {
+	switch key := k.(type) {
+	case *rsa.PrivateKey:
+		return KeyRSA
+	case ed25519.PrivateKey:
+		return KeyEd25519
+	case *ecdsa.PrivateKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return KeyECDSAP256
+		case elliptic.P384():
+			return KeyECDSAP384
+		case elliptic.P521():
+			return KeyECDSAP521
+		}
+	}
+	return ""
+}
+
+// Type returns the key type
+func (v *PrivateKey) Type() string {
+	return keyType(v.key)
 }
 
 // Signer returns private key signer
@@ -64,3 +158,44 @@ func (v *PrivateKey) Signer() (ssh.Signer, error) {
 	}
 	return signer, nil
 }
+
+// Export to write the key to the filesystem, rsa keys in PKCS#1, ecdsa keys
+// in SEC 1 and ed25519 keys in OpenSSH format, and its public key next to
+// it in authorized_keys format
+func (v *PrivateKey) Export(path string) error {
+	var block *pem.Block
+	switch key := v.key.(type) {
+	case *rsa.PrivateKey:
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	case *ecdsa.PrivateKey:
+		b, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return err
+		}
+		block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: b}
+	default:
+		b, err := ssh.MarshalPrivateKey(key, "")
+		if err != nil {
+			return err
+		}
+		block = b
+	}
+	signer, err := v.Signer()
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path+".pub", ssh.MarshalAuthorizedKey(signer.PublicKey()), 0644); err != nil {
+		return err
+	}
+	v.path = path
+	return nil
+}
+
+// Path returns the file the key was imported from or exported to, empty
+// for generated keys
+func (v *PrivateKey) Path() string {
+	return v.path
+}
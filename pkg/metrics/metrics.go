@@ -0,0 +1,348 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are histogram buckets suited to request latencies in seconds
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector writes its series in the text exposition format
+type collector interface {
+	name() string
+	write(*bufio.Writer)
+}
+
+// Registry of metrics exposed in the Prometheus text format
+type Registry struct {
+	sync.Mutex
+	collectors map[string]collector
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: make(map[string]collector),
+	}
+}
+
+// register adds the collector, metric names must be unique
+func (v *Registry) register(c collector) {
+	v.Lock()
+	defer v.Unlock()
+	if _, ok := v.collectors[c.name()]; ok {
+		panic(fmt.Sprintf("metrics: duplicate metric %s", c.name()))
+	}
+	v.collectors[c.name()] = c
+}
+
+// Counter creates and registers a counter
+func (v *Registry) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{newFamily(name, help, "counter", labels)}
+	v.register(c)
+	return c
+}
+
+// Gauge creates and registers a gauge
+func (v *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{newFamily(name, help, "gauge", labels)}
+	v.register(g)
+	return g
+}
+
+// Histogram creates and registers a histogram with the upper bounds of
+// its buckets, DefBuckets are used if none are given
+func (v *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &Histogram{
+		family:  newFamily(name, help, "histogram", labels),
+		buckets: buckets,
+	}
+	v.register(h)
+	return h
+}
+
+// WriteTo writes every metric in the text exposition format, sorted by
+// name
+func (v *Registry) WriteTo(w io.Writer) (int64, error) {
+	v.Lock()
+	names := make([]string, 0, len(v.collectors))
+	for name := range v.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	collectors := make([]collector, 0, len(names))
+	for _, name := range names {
+		collectors = append(collectors, v.collectors[name])
+	}
+	v.Unlock()
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// family of series sharing a name and label names
+type family struct {
+	sync.Mutex
+	id, help, typ string
+	labels        []string
+	series        map[string]*series
+}
+
+// series of a family for one set of label values
+type series struct {
+	values  []string
+	value   float64
+	counts  []uint64
+	sum     float64
+	samples uint64
+}
+
+// newFamily creates a family, metrics without labels start with their
+// only series so they are exposed before the first update
+func newFamily(name, help, typ string, labels []string) *family {
+	f := &family{
+		id:     name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		series: make(map[string]*series),
+	}
+	if len(labels) == 0 {
+		f.series[""] = &series{}
+	}
+	return f
+}
+
+func (v *family) name() string {
+	return v.id
+}
+
+// get returns the series for the label values, the caller must hold the
+// lock
+func (v *family) get(values []string) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.id, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+// sorted returns the series ordered by label values, the caller must hold
+// the lock
+func (v *family) sorted() []*series {
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	list := make([]*series, 0, len(keys))
+	for _, key := range keys {
+		list = append(list, v.series[key])
+	}
+	return list
+}
+
+func (v *family) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.id, escape(v.help, false))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.id, v.typ)
+}
+
+// sample writes one line, extra is appended to the series labels
+func (v *family) sample(w *bufio.Writer, suffix string, s *series, value float64, extra ...string) {
+	w.WriteString(v.id + suffix)
+	pairs := make([]string, 0, len(s.values)+1)
+	for i, l := range v.labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, l, escape(s.values[i], true)))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], escape(extra[i+1], true)))
+	}
+	if len(pairs) > 0 {
+		w.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	w.WriteString(" " + format(value) + "\n")
+}
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	*family
+}
+
+// Inc increments the counter by one
+func (v *Counter) Inc(values ...string) {
+	v.Add(1, values...)
+}
+
+// Add increments the counter, negative deltas are ignored
+func (v *Counter) Add(delta float64, values ...string) {
+	if delta < 0 {
+		return
+	}
+	v.Lock()
+	defer v.Unlock()
+	v.get(values).value += delta
+}
+
+// Value returns the current value
+func (v *Counter) Value(values ...string) float64 {
+	v.Lock()
+	defer v.Unlock()
+	return v.get(values).value
+}
+
+func (v *Counter) write(w *bufio.Writer) {
+	v.Lock()
+	defer v.Unlock()
+	v.header(w)
+	for _, s := range v.sorted() {
+		v.sample(w, "", s, s.value)
+	}
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	*family
+}
+
+// Set sets the gauge
+func (v *Gauge) Set(value float64, values ...string) {
+	v.Lock()
+	defer v.Unlock()
+	v.get(values).value = value
+}
+
+// Inc increments the gauge by one
+func (v *Gauge) Inc(values ...string) {
+	v.Add(1, values...)
+}
+
+// Dec decrements the gauge by one
+func (v *Gauge) Dec(values ...string) {
+	v.Add(-1, values...)
+}
+
+// Add adds delta to the gauge
+func (v *Gauge) Add(delta float64, values ...string) {
+	v.Lock()
+	defer v.Unlock()
+	v.get(values).value += delta
+}
+
+// Value returns the current value
+func (v *Gauge) Value(values ...string) float64 {
+	v.Lock()
+	defer v.Unlock()
+	return v.get(values).value
+}
+
+func (v *Gauge) write(w *bufio.Writer) {
+	v.Lock()
+	defer v.Unlock()
+	v.header(w)
+	for _, s := range v.sorted() {
+		v.sample(w, "", s, s.value)
+	}
+}
+
+// Histogram counts observations in buckets
+type Histogram struct {
+	*family
+	buckets []float64
+}
+
+// Observe records a value
+func (v *Histogram) Observe(value float64, values ...string) {
+	v.Lock()
+	defer v.Unlock()
+	s := v.get(values)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(v.buckets))
+	}
+	if i := sort.SearchFloat64s(v.buckets, value); i < len(v.buckets) {
+		s.counts[i]++
+	}
+	s.sum += value
+	s.samples++
+}
+
+// Count returns the number of observations
+func (v *Histogram) Count(values ...string) uint64 {
+	v.Lock()
+	defer v.Unlock()
+	return v.get(values).samples
+}
+
+func (v *Histogram) write(w *bufio.Writer) {
+	v.Lock()
+	defer v.Unlock()
+	v.header(w)
+	for _, s := range v.sorted() {
+		var cumulative uint64
+		for i, le := range v.buckets {
+			if s.counts != nil {
+				cumulative += s.counts[i]
+			}
+			v.sample(w, "_bucket", s, float64(cumulative), "le", format(le))
+		}
+		v.sample(w, "_bucket", s, float64(s.samples), "le", "+Inf")
+		v.sample(w, "_sum", s, s.sum)
+		v.sample(w, "_count", s, float64(s.samples))
+	}
+}
+
+// format a sample value
+func format(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
+
+// escape help text or label values
+func escape(s string, quote bool) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if quote {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+	return s
+}
+
+// countWriter counts bytes written
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (v *countWriter) Write(b []byte) (int, error) {
+	n, err := v.w.Write(b)
+	v.n += int64(n)
+	return n, err
+}
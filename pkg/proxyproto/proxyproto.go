@@ -0,0 +1,200 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidHeader error
+	ErrInvalidHeader = errors.New("invalid PROXY protocol header")
+	// ErrUnsupportedVersion error
+	ErrUnsupportedVersion = errors.New("unsupported PROXY protocol version")
+)
+
+// v2 signature
+var signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// Header of a PROXY protocol connection, the addresses are nil when the
+// proxy did not forward any (v1 UNKNOWN, v2 LOCAL or unsupported families)
+type Header struct {
+	Version     int
+	Source      net.Addr
+	Destination net.Addr
+}
+
+// Read reads a v1 or v2 header
+func Read(r *bufio.Reader) (*Header, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	switch b[0] {
+	case 'P':
+		return readV1(r)
+	case '\r':
+		return readV2(r)
+	default:
+		return nil, ErrInvalidHeader
+	}
+}
+
+// readV1 reads the text header, "PROXY TCP4 <src> <dst> <sport> <dport>\r\n"
+func readV1(r *bufio.Reader) (*Header, error) {
+	// the longest v1 header is 107 bytes
+	var line []byte
+	for len(line) < 107 {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, ErrInvalidHeader
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, ErrInvalidHeader
+	}
+	h := &Header{Version: 1}
+	switch fields[1] {
+	case "UNKNOWN":
+		return h, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, ErrInvalidHeader
+	}
+	if len(fields) != 6 {
+		return nil, ErrInvalidHeader
+	}
+	src, dst := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+	if src == nil || dst == nil || (fields[1] == "TCP4") != (src.To4() != nil) || (fields[1] == "TCP4") != (dst.To4() != nil) {
+		return nil, ErrInvalidHeader
+	}
+	sport, err := port(fields[4])
+	if err != nil {
+		return nil, err
+	}
+	dport, err := port(fields[5])
+	if err != nil {
+		return nil, err
+	}
+	h.Source = &net.TCPAddr{IP: src, Port: sport}
+	h.Destination = &net.TCPAddr{IP: dst, Port: dport}
+	return h, nil
+}
+
+func port(s string) (int, error) {
+	p, err := strconv.Atoi(s)
+	if err != nil || p < 0 || p > 65535 || (len(s) > 1 && s[0] == '0') {
+		return 0, ErrInvalidHeader
+	}
+	return p, nil
+}
+
+// readV2 reads the binary header
+func readV2(r *bufio.Reader) (*Header, error) {
+	head := make([]byte, 16)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(head[:12], signature) {
+		return nil, ErrInvalidHeader
+	}
+	if head[12]>>4 != 2 {
+		return nil, ErrUnsupportedVersion
+	}
+	cmd, family := head[12]&0x0f, head[13]
+	body := make([]byte, binary.BigEndian.Uint16(head[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	h := &Header{Version: 2}
+	switch cmd {
+	case 0x0:
+		// LOCAL, the connection was made by the proxy itself
+		return h, nil
+	case 0x1:
+	default:
+		return nil, ErrInvalidHeader
+	}
+	switch family {
+	case 0x11:
+		if len(body) < 12 {
+			return nil, ErrInvalidHeader
+		}
+		h.Source = &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}
+		h.Destination = &net.TCPAddr{IP: net.IP(body[4:8]), Port: int(binary.BigEndian.Uint16(body[10:12]))}
+	case 0x21:
+		if len(body) < 36 {
+			return nil, ErrInvalidHeader
+		}
+		h.Source = &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}
+		h.Destination = &net.TCPAddr{IP: net.IP(body[16:32]), Port: int(binary.BigEndian.Uint16(body[34:36]))}
+	case 0x31:
+		if len(body) < 216 {
+			return nil, ErrInvalidHeader
+		}
+		h.Source = &net.UnixAddr{Name: string(bytes.TrimRight(body[0:108], "\x00")), Net: "unix"}
+		h.Destination = &net.UnixAddr{Name: string(bytes.TrimRight(body[108:216], "\x00")), Net: "unix"}
+	}
+	return h, nil
+}
+
+// Conn is a connection with the addresses reported by the proxy
+type Conn struct {
+	net.Conn
+	r      *bufio.Reader
+	header *Header
+}
+
+// NewConn reads the header from the connection, the timeout bounds the
+// time the proxy is given to send it
+func NewConn(c net.Conn, timeout time.Duration) (*Conn, error) {
+	if timeout > 0 {
+		c.SetReadDeadline(time.Now().Add(timeout))
+		defer c.SetReadDeadline(time.Time{})
+	}
+	r := bufio.NewReader(c)
+	h, err := Read(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{Conn: c, r: r, header: h}, nil
+}
+
+// Header returns the header sent by the proxy
+func (v *Conn) Header() *Header {
+	return v.header
+}
+
+func (v *Conn) Read(b []byte) (int, error) {
+	return v.r.Read(b)
+}
+
+// RemoteAddr returns the client address reported by the proxy
+func (v *Conn) RemoteAddr() net.Addr {
+	if v.header.Source != nil {
+		return v.header.Source
+	}
+	return v.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the address the client connected to
+func (v *Conn) LocalAddr() net.Addr {
+	if v.header.Destination != nil {
+		return v.header.Destination
+	}
+	return v.Conn.LocalAddr()
+}
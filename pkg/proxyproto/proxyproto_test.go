@@ -0,0 +1,179 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// v2 builds a binary header
+func v2(cmd, family byte, body []byte) []byte {
+	b := append([]byte(nil), signature...)
+	b = append(b, 0x20|cmd, family, 0, 0)
+	binary.BigEndian.PutUint16(b[14:16], uint16(len(body)))
+	return append(b, body...)
+}
+
+func v2tcp4(src, dst string, sport, dport uint16) []byte {
+	body := append(net.ParseIP(src).To4(), net.ParseIP(dst).To4()...)
+	body = append(body, 0, 0, 0, 0)
+	binary.BigEndian.PutUint16(body[8:], sport)
+	binary.BigEndian.PutUint16(body[10:], dport)
+	return v2(0x1, 0x11, body)
+}
+
+func v2tcp6(src, dst string, sport, dport uint16) []byte {
+	body := append(net.ParseIP(src).To16(), net.ParseIP(dst).To16()...)
+	body = append(body, 0, 0, 0, 0)
+	binary.BigEndian.PutUint16(body[32:], sport)
+	binary.BigEndian.PutUint16(body[34:], dport)
+	return v2(0x1, 0x21, body)
+}
+
+func TestRead(t *testing.T) {
+	unix := make([]byte, 216)
+	copy(unix, "/run/client.sock")
+	copy(unix[108:], "/run/server.sock")
+	for _, c := range []struct {
+		name    string
+		header  []byte
+		version int
+		src     string
+		dst     string
+		err     error
+	}{
+		{"v1 tcp4", []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 22\r\n"), 1, "192.0.2.1:56324", "198.51.100.1:22", nil},
+		{"v1 tcp6", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 22\r\n"), 1, "[2001:db8::1]:56324", "[2001:db8::2]:22", nil},
+		{"v1 unknown", []byte("PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n"), 1, "", "", nil},
+		{"v1 family mismatch", []byte("PROXY TCP4 2001:db8::1 198.51.100.1 56324 22\r\n"), 0, "", "", ErrInvalidHeader},
+		{"v1 bad port", []byte("PROXY TCP4 192.0.2.1 198.51.100.1 056324 22\r\n"), 0, "", "", ErrInvalidHeader},
+		{"v1 port range", []byte("PROXY TCP4 192.0.2.1 198.51.100.1 65536 22\r\n"), 0, "", "", ErrInvalidHeader},
+		{"v1 missing fields", []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324\r\n"), 0, "", "", ErrInvalidHeader},
+		{"v1 no crlf", []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 22\n"), 0, "", "", ErrInvalidHeader},
+		{"v1 too long", []byte("PROXY TCP4 " + strings.Repeat("1", 120) + "\r\n"), 0, "", "", ErrInvalidHeader},
+		{"v2 tcp4", v2tcp4("192.0.2.1", "198.51.100.1", 56324, 22), 2, "192.0.2.1:56324", "198.51.100.1:22", nil},
+		{"v2 tcp6", v2tcp6("2001:db8::1", "2001:db8::2", 56324, 22), 2, "[2001:db8::1]:56324", "[2001:db8::2]:22", nil},
+		{"v2 unix", v2(0x1, 0x31, unix), 2, "/run/client.sock", "/run/server.sock", nil},
+		{"v2 local", v2(0x0, 0x00, nil), 2, "", "", nil},
+		{"v2 unspecified family", v2(0x1, 0x00, nil), 2, "", "", nil},
+		{"v2 short body", v2(0x1, 0x11, make([]byte, 8)), 0, "", "", ErrInvalidHeader},
+		{"v2 bad command", v2(0x2, 0x11, make([]byte, 12)), 0, "", "", ErrInvalidHeader},
+		{"v2 bad version", append(append([]byte(nil), signature...), 0x11, 0x11, 0, 0), 0, "", "", ErrUnsupportedVersion},
+		{"v2 bad signature", append([]byte("\r\n\r\n\x00\r\nQUIT!"), 0x21, 0x11, 0, 0), 0, "", "", ErrInvalidHeader},
+		{"ssh banner", []byte("SSH-2.0-OpenSSH_9.6\r\n"), 0, "", "", ErrInvalidHeader},
+	} {
+		h, err := Read(bufio.NewReader(bytes.NewReader(c.header)))
+		if err != c.err {
+			t.Errorf("%s: err = %v, want %v", c.name, err, c.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if h.Version != c.version {
+			t.Errorf("%s: version = %d", c.name, h.Version)
+		}
+		if got := addr(h.Source); got != c.src {
+			t.Errorf("%s: source = %q, want %q", c.name, got, c.src)
+		}
+		if got := addr(h.Destination); got != c.dst {
+			t.Errorf("%s: destination = %q, want %q", c.name, got, c.dst)
+		}
+	}
+}
+
+func TestReadTruncated(t *testing.T) {
+	for _, header := range [][]byte{
+		[]byte("PROXY TCP4 192.0.2.1"),
+		v2tcp4("192.0.2.1", "198.51.100.1", 56324, 22)[:20],
+	} {
+		if _, err := Read(bufio.NewReader(bytes.NewReader(header))); err != io.EOF && err != io.ErrUnexpectedEOF {
+			t.Errorf("%q: err = %v", header, err)
+		}
+	}
+}
+
+func addr(a net.Addr) string {
+	if a == nil {
+		return ""
+	}
+	return a.String()
+}
+
+// accept returns the server side of a loopback connection the client
+// writes the data to
+func accept(t *testing.T, data []byte) (net.Conn, net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	server, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	if len(data) > 0 {
+		if _, err := client.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return server, client
+}
+
+func TestConn(t *testing.T) {
+	for _, header := range [][]byte{
+		[]byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 22\r\n"),
+		v2tcp4("192.0.2.1", "198.51.100.1", 56324, 22),
+	} {
+		server, _ := accept(t, append(header, "SSH-2.0-client\r\n"...))
+		c, err := NewConn(server, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.RemoteAddr().String(); got != "192.0.2.1:56324" {
+			t.Errorf("remote addr = %s", got)
+		}
+		if got := c.LocalAddr().String(); got != "198.51.100.1:22" {
+			t.Errorf("local addr = %s", got)
+		}
+		// the bytes following the header are left for the handshake
+		line, err := bufio.NewReader(c).ReadString('\n')
+		if err != nil || line != "SSH-2.0-client\r\n" {
+			t.Errorf("payload = %q, %v", line, err)
+		}
+	}
+}
+
+func TestConnLocal(t *testing.T) {
+	server, _ := accept(t, v2(0x0, 0x00, nil))
+	c, err := NewConn(server, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.RemoteAddr().String() != server.RemoteAddr().String() {
+		t.Errorf("remote addr = %s, want the proxy %s", c.RemoteAddr(), server.RemoteAddr())
+	}
+}
+
+func TestConnTimeout(t *testing.T) {
+	server, _ := accept(t, []byte("PROXY TCP4"))
+	started := time.Now()
+	_, err := NewConn(server, 100*time.Millisecond)
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("err = %v", err)
+	}
+	if time.Since(started) > 5*time.Second {
+		t.Fatal("timeout not applied")
+	}
+}
@@ -0,0 +1,453 @@
+package sftp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// status codes
+const (
+	statusOK               uint32 = 0
+	statusEOF                     = 1
+	statusNoSuchFile              = 2
+	statusPermissionDenied        = 3
+	statusFailure                 = 4
+)
+
+// ErrClosed error
+var ErrClosed = errors.New("sftp: client closed")
+
+// StatusError is returned when the server replies with a failure status
+type StatusError struct {
+	Code    uint32
+	Message string
+}
+
+func (v *StatusError) Error() string {
+	return fmt.Sprintf("sftp: %s (code %d)", v.Message, v.Code)
+}
+
+// response packet
+type response struct {
+	typ byte
+	r   *reader
+	err error
+}
+
+// Client speaks SFTP version 3 over a subsystem channel
+type Client struct {
+	sync.Mutex
+	w       io.WriteCloser
+	next    uint32
+	pending map[uint32]chan *response
+	err     error
+}
+
+// NewClient performs the version handshake over the channel
+func NewClient(r io.Reader, w io.WriteCloser) (*Client, error) {
+	if err := writePacket(w, fxpInit, new(buffer).uint32(version).b); err != nil {
+		return nil, err
+	}
+	typ, _, err := readPacket(r)
+	if err != nil {
+		return nil, err
+	}
+	if typ != fxpVersion {
+		return nil, fmt.Errorf("sftp: unexpected packet %d during handshake", typ)
+	}
+	c := &Client{
+		w:       w,
+		pending: make(map[uint32]chan *response),
+	}
+	go c.receive(r)
+	return c, nil
+}
+
+// receive dispatches responses to the pending requests by id
+func (v *Client) receive(r io.Reader) {
+	for {
+		typ, b, err := readPacket(r)
+		if err != nil {
+			v.Lock()
+			v.err = err
+			for id, ch := range v.pending {
+				ch <- &response{err: err}
+				delete(v.pending, id)
+			}
+			v.Unlock()
+			return
+		}
+		p := &reader{b: b}
+		id := p.uint32()
+		v.Lock()
+		ch, ok := v.pending[id]
+		delete(v.pending, id)
+		v.Unlock()
+		if ok {
+			ch <- &response{typ: typ, r: p}
+		}
+	}
+}
+
+// request sends a packet and waits for its response
+func (v *Client) request(typ byte, b *buffer) (*response, error) {
+	ch := make(chan *response, 1)
+	v.Lock()
+	if v.err != nil {
+		v.Unlock()
+		return nil, v.err
+	}
+	id := v.next
+	v.next++
+	v.pending[id] = ch
+	p := new(buffer).uint32(id)
+	p.b = append(p.b, b.b...)
+	err := writePacket(v.w, typ, p.b)
+	if err != nil {
+		delete(v.pending, id)
+	}
+	v.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	res := <-ch
+	if res.err != nil {
+		return nil, res.err
+	}
+	return res, nil
+}
+
+// status converts a status response to an error, nil for OK
+func status(res *response) error {
+	if res.typ != fxpStatus {
+		return fmt.Errorf("sftp: unexpected packet %d", res.typ)
+	}
+	code := res.r.uint32()
+	msg := res.r.string()
+	switch code {
+	case statusOK:
+		return nil
+	case statusEOF:
+		return io.EOF
+	case statusNoSuchFile:
+		return os.ErrNotExist
+	case statusPermissionDenied:
+		return os.ErrPermission
+	default:
+		return &StatusError{Code: code, Message: msg}
+	}
+}
+
+func (v *Client) expect(typ byte, b *buffer, want byte) (*reader, error) {
+	res, err := v.request(typ, b)
+	if err != nil {
+		return nil, err
+	}
+	if res.typ != want {
+		if err := status(res); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("sftp: unexpected packet %d", res.typ)
+	}
+	return res.r, nil
+}
+
+func (v *Client) call(typ byte, b *buffer) error {
+	res, err := v.request(typ, b)
+	if err != nil {
+		return err
+	}
+	return status(res)
+}
+
+// Close closes the channel
+func (v *Client) Close() error {
+	v.Lock()
+	if v.err == nil {
+		v.err = ErrClosed
+	}
+	v.Unlock()
+	return v.w.Close()
+}
+
+func (v *Client) stat(typ byte, p string) (os.FileInfo, error) {
+	r, err := v.expect(typ, new(buffer).string(p), fxpAttrs)
+	if err != nil {
+		return nil, wrap(typ, p, err)
+	}
+	return &FileInfo{name: path.Base(p), a: r.attrs()}, r.err
+}
+
+// Stat returns file info, following symbolic links
+func (v *Client) Stat(p string) (os.FileInfo, error) {
+	return v.stat(fxpStat, p)
+}
+
+// Lstat returns file info without following symbolic links
+func (v *Client) Lstat(p string) (os.FileInfo, error) {
+	return v.stat(fxpLstat, p)
+}
+
+// Mkdir creates a directory
+func (v *Client) Mkdir(p string, mode os.FileMode) error {
+	a := &attrs{flags: attrPermissions, mode: unixMode(mode)}
+	return wrap(fxpMkdir, p, v.call(fxpMkdir, new(buffer).string(p).attrs(a)))
+}
+
+// Rmdir removes an empty directory
+func (v *Client) Rmdir(p string) error {
+	return wrap(fxpRmdir, p, v.call(fxpRmdir, new(buffer).string(p)))
+}
+
+// Remove removes a file
+func (v *Client) Remove(p string) error {
+	return wrap(fxpRemove, p, v.call(fxpRemove, new(buffer).string(p)))
+}
+
+// Rename renames a file
+func (v *Client) Rename(from, to string) error {
+	return wrap(fxpRename, from, v.call(fxpRename, new(buffer).string(from).string(to)))
+}
+
+// Chmod changes file mode
+func (v *Client) Chmod(p string, mode os.FileMode) error {
+	a := &attrs{flags: attrPermissions, mode: unixMode(mode)}
+	return wrap(fxpSetstat, p, v.call(fxpSetstat, new(buffer).string(p).attrs(a)))
+}
+
+// Chtimes changes access and modification times
+func (v *Client) Chtimes(p string, atime, mtime time.Time) error {
+	a := &attrs{flags: attrACModTime, atime: uint32(atime.Unix()), mtime: uint32(mtime.Unix())}
+	return wrap(fxpSetstat, p, v.call(fxpSetstat, new(buffer).string(p).attrs(a)))
+}
+
+// RealPath canonicalizes a remote path
+func (v *Client) RealPath(p string) (string, error) {
+	r, err := v.expect(fxpRealpath, new(buffer).string(p), fxpName)
+	if err != nil {
+		return "", wrap(fxpRealpath, p, err)
+	}
+	if r.uint32() < 1 {
+		return "", errShortPacket
+	}
+	return r.string(), r.err
+}
+
+// ReadDir lists directory entries, excluding . and ..
+func (v *Client) ReadDir(p string) ([]os.FileInfo, error) {
+	r, err := v.expect(fxpOpendir, new(buffer).string(p), fxpHandle)
+	if err != nil {
+		return nil, wrap(fxpOpendir, p, err)
+	}
+	handle := r.string()
+	defer v.call(fxpClose, new(buffer).string(handle))
+	o := make([]os.FileInfo, 0)
+	for {
+		r, err := v.expect(fxpReaddir, new(buffer).string(handle), fxpName)
+		if err == io.EOF {
+			return o, nil
+		}
+		if err != nil {
+			return nil, wrap(fxpReaddir, p, err)
+		}
+		for n := r.uint32(); n > 0 && r.err == nil; n-- {
+			name := r.string()
+			r.string()
+			a := r.attrs()
+			if name == "." || name == ".." {
+				continue
+			}
+			o = append(o, &FileInfo{name: name, a: a})
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+	}
+}
+
+// Open opens a file for reading
+func (v *Client) Open(p string) (*File, error) {
+	return v.OpenFile(p, os.O_RDONLY, 0)
+}
+
+// Create creates or truncates a file for writing
+func (v *Client) Create(p string, mode os.FileMode) (*File, error) {
+	return v.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+}
+
+// OpenFile opens a file with os.O_* flags, mode is applied when the file is
+// created
+func (v *Client) OpenFile(p string, flag int, mode os.FileMode) (*File, error) {
+	var pflags uint32
+	switch flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR) {
+	case os.O_RDONLY:
+		pflags = fxfRead
+	case os.O_WRONLY:
+		pflags = fxfWrite
+	case os.O_RDWR:
+		pflags = fxfRead | fxfWrite
+	}
+	if flag&os.O_APPEND != 0 {
+		pflags |= fxfAppend
+	}
+	if flag&os.O_CREATE != 0 {
+		pflags |= fxfCreat
+	}
+	if flag&os.O_TRUNC != 0 {
+		pflags |= fxfTrunc
+	}
+	if flag&os.O_EXCL != 0 {
+		pflags |= fxfExcl
+	}
+	a := &attrs{flags: attrPermissions, mode: unixMode(mode)}
+	r, err := v.expect(fxpOpen, new(buffer).string(p).uint32(pflags).attrs(a), fxpHandle)
+	if err != nil {
+		return nil, wrap(fxpOpen, p, err)
+	}
+	return &File{client: v, path: p, handle: r.string()}, r.err
+}
+
+// chunk size for reads and writes
+const chunk = 32 * 1024
+
+// File handle on the remote server
+type File struct {
+	sync.Mutex
+	client *Client
+	path   string
+	handle string
+	offset int64
+}
+
+// Name returns the remote path
+func (v *File) Name() string {
+	return v.path
+}
+
+// ReadAt reads from the given offset
+func (v *File) ReadAt(b []byte, off int64) (int, error) {
+	n := 0
+	for n < len(b) {
+		size := len(b) - n
+		if size > chunk {
+			size = chunk
+		}
+		r, err := v.client.expect(fxpRead, new(buffer).string(v.handle).uint64(uint64(off+int64(n))).uint32(uint32(size)), fxpData)
+		if err != nil {
+			return n, err
+		}
+		data := r.bytes()
+		if r.err != nil {
+			return n, r.err
+		}
+		n += copy(b[n:], data)
+		if len(data) < size {
+			// short read, let the caller ask again
+			break
+		}
+	}
+	return n, nil
+}
+
+// Read reads from the current offset
+func (v *File) Read(b []byte) (int, error) {
+	v.Lock()
+	defer v.Unlock()
+	n, err := v.ReadAt(b, v.offset)
+	v.offset += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// WriteAt writes at the given offset
+func (v *File) WriteAt(b []byte, off int64) (int, error) {
+	n := 0
+	for n < len(b) {
+		size := len(b) - n
+		if size > chunk {
+			size = chunk
+		}
+		err := v.client.call(fxpWrite, new(buffer).string(v.handle).uint64(uint64(off+int64(n))).bytes(b[n:n+size]))
+		if err != nil {
+			return n, err
+		}
+		n += size
+	}
+	return n, nil
+}
+
+// Write writes at the current offset
+func (v *File) Write(b []byte) (int, error) {
+	v.Lock()
+	defer v.Unlock()
+	n, err := v.WriteAt(b, v.offset)
+	v.offset += int64(n)
+	return n, err
+}
+
+// Seek sets the offset for the next Read or Write
+func (v *File) Seek(offset int64, whence int) (int64, error) {
+	v.Lock()
+	defer v.Unlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += v.offset
+	case io.SeekEnd:
+		fi, err := v.Stat()
+		if err != nil {
+			return v.offset, err
+		}
+		offset += fi.Size()
+	}
+	if offset < 0 {
+		return v.offset, os.ErrInvalid
+	}
+	v.offset = offset
+	return offset, nil
+}
+
+// Stat returns file info of the open file
+func (v *File) Stat() (os.FileInfo, error) {
+	r, err := v.client.expect(fxpFstat, new(buffer).string(v.handle), fxpAttrs)
+	if err != nil {
+		return nil, wrap(fxpFstat, v.path, err)
+	}
+	return &FileInfo{name: path.Base(v.path), a: r.attrs()}, r.err
+}
+
+// Close closes the handle
+func (v *File) Close() error {
+	return wrap(fxpClose, v.path, v.client.call(fxpClose, new(buffer).string(v.handle)))
+}
+
+var ops = map[byte]string{
+	fxpOpen:     "open",
+	fxpClose:    "close",
+	fxpLstat:    "lstat",
+	fxpFstat:    "fstat",
+	fxpSetstat:  "setstat",
+	fxpOpendir:  "opendir",
+	fxpReaddir:  "readdir",
+	fxpRemove:   "remove",
+	fxpMkdir:    "mkdir",
+	fxpRmdir:    "rmdir",
+	fxpRealpath: "realpath",
+	fxpStat:     "stat",
+	fxpRename:   "rename",
+}
+
+// wrap converts errors into *os.PathError so callers can use os.IsNotExist
+func wrap(typ byte, p string, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	return &os.PathError{Op: ops[typ], Path: p, Err: err}
+}
@@ -0,0 +1,112 @@
+package sftp
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/samuelngs/universe/pkg/sftp/sftptest"
+)
+
+// dial connects a client to an sftptest server over pipes
+func dial(t *testing.T) *Client {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	go func() {
+		new(sftptest.Server).Serve(sr, sw)
+		sw.Close()
+	}()
+	c, err := NewClient(cr, cw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestClient(t *testing.T) {
+	c := dial(t)
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	if err := c.Mkdir(sub, 0750); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(sub, "file")
+	f, err := c.Create(name, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// larger than a chunk and a packet
+	data := make([]byte, 300*1024)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	if n, err := f.Write(data); n != len(data) || err != nil {
+		t.Fatalf("write = %d, %v", n, err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(name); err != nil || string(b) != string(data) {
+		t.Fatalf("written %d bytes, %v", len(b), err)
+	}
+
+	f, err = c.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(-10, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadAll(f); err != nil || string(b) != string(data[len(data)-10:]) {
+		t.Fatalf("read %v, %v", b, err)
+	}
+	f.Close()
+
+	mtime := time.Unix(1000000000, 0)
+	if err := c.Chmod(name, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Chtimes(name, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := c.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode() != 0640 || fi.Size() != int64(len(data)) || !fi.ModTime().Equal(mtime) {
+		t.Fatalf("stat = %v %d %v", fi.Mode(), fi.Size(), fi.ModTime())
+	}
+	entries, err := c.ReadDir(sub)
+	if err != nil || len(entries) != 1 || entries[0].Name() != "file" || !entries[0].Mode().IsRegular() {
+		t.Fatalf("readdir = %v, %v", entries, err)
+	}
+	if fi, err := c.Stat(sub); err != nil || !fi.IsDir() || fi.Mode().Perm() != 0750 {
+		t.Fatalf("stat dir = %v, %v", fi, err)
+	}
+	if p, err := c.RealPath(filepath.Join(sub, "..", "sub")); err != nil || p != sub {
+		t.Fatalf("realpath = %q, %v", p, err)
+	}
+
+	if err := c.Rename(name, name+".old"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Stat(name); !os.IsNotExist(err) {
+		t.Fatalf("stat renamed = %v", err)
+	}
+	if err := c.Rmdir(sub); err == nil {
+		t.Fatal("removed a directory that is not empty")
+	}
+	if err := c.Remove(name + ".old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Rmdir(sub); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ReadDir(sub); !os.IsNotExist(err) {
+		t.Fatalf("readdir removed = %v", err)
+	}
+}
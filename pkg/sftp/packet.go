@@ -0,0 +1,305 @@
+package sftp
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// protocol version implemented by the client
+const version uint32 = 3
+
+// packet types
+const (
+	fxpInit     byte = 1
+	fxpVersion  byte = 2
+	fxpOpen     byte = 3
+	fxpClose    byte = 4
+	fxpRead     byte = 5
+	fxpWrite    byte = 6
+	fxpLstat    byte = 7
+	fxpFstat    byte = 8
+	fxpSetstat  byte = 9
+	fxpFsetstat byte = 10
+	fxpOpendir  byte = 11
+	fxpReaddir  byte = 12
+	fxpRemove   byte = 13
+	fxpMkdir    byte = 14
+	fxpRmdir    byte = 15
+	fxpRealpath byte = 16
+	fxpStat     byte = 17
+	fxpRename   byte = 18
+	fxpStatus   byte = 101
+	fxpHandle   byte = 102
+	fxpData     byte = 103
+	fxpName     byte = 104
+	fxpAttrs    byte = 105
+)
+
+// open flags
+const (
+	fxfRead   uint32 = 0x01
+	fxfWrite  uint32 = 0x02
+	fxfAppend uint32 = 0x04
+	fxfCreat  uint32 = 0x08
+	fxfTrunc  uint32 = 0x10
+	fxfExcl   uint32 = 0x20
+)
+
+// attribute flags
+const (
+	attrSize        uint32 = 0x01
+	attrUIDGID      uint32 = 0x02
+	attrPermissions uint32 = 0x04
+	attrACModTime   uint32 = 0x08
+	attrExtended    uint32 = 0x80000000
+)
+
+// maximum packet length accepted from the server
+const maxPacket uint32 = 256 * 1024
+
+var errShortPacket = errors.New("sftp: short packet")
+
+// packet buffer
+type buffer struct {
+	b []byte
+}
+
+func (v *buffer) byte(b byte) *buffer {
+	v.b = append(v.b, b)
+	return v
+}
+
+func (v *buffer) uint32(n uint32) *buffer {
+	v.b = binary.BigEndian.AppendUint32(v.b, n)
+	return v
+}
+
+func (v *buffer) uint64(n uint64) *buffer {
+	v.b = binary.BigEndian.AppendUint64(v.b, n)
+	return v
+}
+
+func (v *buffer) string(s string) *buffer {
+	v.uint32(uint32(len(s)))
+	v.b = append(v.b, s...)
+	return v
+}
+
+func (v *buffer) bytes(b []byte) *buffer {
+	v.uint32(uint32(len(b)))
+	v.b = append(v.b, b...)
+	return v
+}
+
+func (v *buffer) attrs(a *attrs) *buffer {
+	v.uint32(a.flags)
+	if a.flags&attrSize != 0 {
+		v.uint64(a.size)
+	}
+	if a.flags&attrUIDGID != 0 {
+		v.uint32(a.uid).uint32(a.gid)
+	}
+	if a.flags&attrPermissions != 0 {
+		v.uint32(a.mode)
+	}
+	if a.flags&attrACModTime != 0 {
+		v.uint32(a.atime).uint32(a.mtime)
+	}
+	return v
+}
+
+// packet reader
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (v *reader) byte() byte {
+	if len(v.b) < 1 {
+		v.err = errShortPacket
+		return 0
+	}
+	b := v.b[0]
+	v.b = v.b[1:]
+	return b
+}
+
+func (v *reader) uint32() uint32 {
+	if len(v.b) < 4 {
+		v.err = errShortPacket
+		return 0
+	}
+	n := binary.BigEndian.Uint32(v.b)
+	v.b = v.b[4:]
+	return n
+}
+
+func (v *reader) uint64() uint64 {
+	if len(v.b) < 8 {
+		v.err = errShortPacket
+		return 0
+	}
+	n := binary.BigEndian.Uint64(v.b)
+	v.b = v.b[8:]
+	return n
+}
+
+func (v *reader) bytes() []byte {
+	n := v.uint32()
+	if uint32(len(v.b)) < n {
+		v.err = errShortPacket
+		return nil
+	}
+	b := v.b[:n]
+	v.b = v.b[n:]
+	return b
+}
+
+func (v *reader) string() string {
+	return string(v.bytes())
+}
+
+func (v *reader) attrs() *attrs {
+	a := &attrs{flags: v.uint32()}
+	if a.flags&attrSize != 0 {
+		a.size = v.uint64()
+	}
+	if a.flags&attrUIDGID != 0 {
+		a.uid, a.gid = v.uint32(), v.uint32()
+	}
+	if a.flags&attrPermissions != 0 {
+		a.mode = v.uint32()
+	}
+	if a.flags&attrACModTime != 0 {
+		a.atime, a.mtime = v.uint32(), v.uint32()
+	}
+	if a.flags&attrExtended != 0 {
+		for n := v.uint32(); n > 0 && v.err == nil; n-- {
+			v.string()
+			v.string()
+		}
+	}
+	return a
+}
+
+// file attributes
+type attrs struct {
+	flags        uint32
+	size         uint64
+	uid, gid     uint32
+	mode         uint32
+	atime, mtime uint32
+}
+
+// unix mode bits
+const (
+	modeType  uint32 = 0170000
+	modeDir   uint32 = 0040000
+	modeLink  uint32 = 0120000
+	modeSetid uint32 = 0004000
+	modeSgid  uint32 = 0002000
+	modeStky  uint32 = 0001000
+)
+
+// fileMode converts unix mode bits to os.FileMode
+func fileMode(m uint32) os.FileMode {
+	mode := os.FileMode(m & 0777)
+	switch m & modeType {
+	case modeDir:
+		mode |= os.ModeDir
+	case modeLink:
+		mode |= os.ModeSymlink
+	case 0, 0100000:
+	default:
+		mode |= os.ModeIrregular
+	}
+	if m&modeSetid != 0 {
+		mode |= os.ModeSetuid
+	}
+	if m&modeSgid != 0 {
+		mode |= os.ModeSetgid
+	}
+	if m&modeStky != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// unixMode converts os.FileMode to unix permission bits
+func unixMode(mode os.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		m |= modeSetid
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= modeSgid
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= modeStky
+	}
+	return m
+}
+
+// FileInfo of a remote file
+type FileInfo struct {
+	name string
+	a    *attrs
+}
+
+// Name returns base name of the file
+func (v *FileInfo) Name() string {
+	return v.name
+}
+
+// Size returns length in bytes
+func (v *FileInfo) Size() int64 {
+	return int64(v.a.size)
+}
+
+// Mode returns file mode bits
+func (v *FileInfo) Mode() os.FileMode {
+	return fileMode(v.a.mode)
+}
+
+// ModTime returns modification time
+func (v *FileInfo) ModTime() time.Time {
+	return time.Unix(int64(v.a.mtime), 0)
+}
+
+// IsDir returns true if the file is a directory
+func (v *FileInfo) IsDir() bool {
+	return v.Mode().IsDir()
+}
+
+// Sys returns nil
+func (v *FileInfo) Sys() interface{} {
+	return nil
+}
+
+func writePacket(w io.Writer, typ byte, b []byte) error {
+	p := make([]byte, 0, len(b)+5)
+	p = binary.BigEndian.AppendUint32(p, uint32(len(b)+1))
+	p = append(p, typ)
+	p = append(p, b...)
+	_, err := w.Write(p)
+	return err
+}
+
+func readPacket(r io.Reader) (byte, []byte, error) {
+	var h [5]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(h[:4])
+	if n < 1 || n > maxPacket {
+		return 0, nil, errShortPacket
+	}
+	b := make([]byte, n-1)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, nil, err
+	}
+	return h[4], b, nil
+}
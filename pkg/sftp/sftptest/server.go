@@ -0,0 +1,463 @@
+// Package sftptest provides an SFTP server over the local file system for
+// testing SFTP clients.
+package sftptest
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// packet types
+const (
+	fxpInit     byte = 1
+	fxpVersion  byte = 2
+	fxpOpen     byte = 3
+	fxpClose    byte = 4
+	fxpRead     byte = 5
+	fxpWrite    byte = 6
+	fxpLstat    byte = 7
+	fxpFstat    byte = 8
+	fxpSetstat  byte = 9
+	fxpFsetstat byte = 10
+	fxpOpendir  byte = 11
+	fxpReaddir  byte = 12
+	fxpRemove   byte = 13
+	fxpMkdir    byte = 14
+	fxpRmdir    byte = 15
+	fxpRealpath byte = 16
+	fxpStat     byte = 17
+	fxpRename   byte = 18
+	fxpStatus   byte = 101
+	fxpHandle   byte = 102
+	fxpData     byte = 103
+	fxpName     byte = 104
+	fxpAttrs    byte = 105
+)
+
+// status codes
+const (
+	statusOK               uint32 = 0
+	statusEOF                     = 1
+	statusNoSuchFile              = 2
+	statusPermissionDenied        = 3
+	statusFailure                 = 4
+	statusBadMessage              = 5
+	statusOpUnsupported           = 8
+)
+
+// attribute flags
+const (
+	attrSize        uint32 = 0x01
+	attrUIDGID      uint32 = 0x02
+	attrPermissions uint32 = 0x04
+	attrACModTime   uint32 = 0x08
+)
+
+var errShortPacket = errors.New("sftptest: short packet")
+
+// Server serves the local file system over SFTP version 3, paths are used
+// as given
+type Server struct {
+	sync.Mutex
+	// Names returns the name listed for an entry of the directory, the
+	// entry name when nil. Lets tests play a hostile server.
+	Names   func(dir, name string) string
+	handles map[string]interface{}
+	next    int
+}
+
+// directory handle, listed once
+type dir struct {
+	path string
+	done bool
+}
+
+// Serve answers the requests read from r until it is closed
+func (v *Server) Serve(r io.Reader, w io.Writer) error {
+	v.Lock()
+	v.handles = make(map[string]interface{})
+	v.Unlock()
+	defer v.close()
+	typ, _, err := read(r)
+	if err != nil {
+		return err
+	}
+	if typ != fxpInit {
+		return errors.New("sftptest: expected init")
+	}
+	if err := write(w, fxpVersion, put32(nil, 3)); err != nil {
+		return err
+	}
+	for {
+		typ, b, err := read(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		p := &packet{b: b}
+		id := p.u32()
+		rtyp, reply := v.handle(typ, p)
+		if p.err != nil {
+			rtyp, reply = fxpStatus, status(statusBadMessage, p.err.Error())
+		}
+		if err := write(w, rtyp, append(put32(nil, id), reply...)); err != nil {
+			return err
+		}
+	}
+}
+
+// close releases the handles left open
+func (v *Server) close() {
+	v.Lock()
+	defer v.Unlock()
+	for _, h := range v.handles {
+		if f, ok := h.(*os.File); ok {
+			f.Close()
+		}
+	}
+}
+
+func (v *Server) handle(typ byte, p *packet) (byte, []byte) {
+	switch typ {
+	case fxpOpen:
+		name, pflags, a := p.str(), p.u32(), p.attrs()
+		flag := 0
+		switch {
+		case pflags&0x03 == 0x03:
+			flag = os.O_RDWR
+		case pflags&0x02 != 0:
+			flag = os.O_WRONLY
+		}
+		for bit, f := range map[uint32]int{0x04: os.O_APPEND, 0x08: os.O_CREATE, 0x10: os.O_TRUNC, 0x20: os.O_EXCL} {
+			if pflags&bit != 0 {
+				flag |= f
+			}
+		}
+		perm := os.FileMode(0644)
+		if a.flags&attrPermissions != 0 {
+			perm = os.FileMode(a.mode & 0777)
+		}
+		f, err := os.OpenFile(name, flag, perm)
+		if err != nil {
+			return fxpStatus, fail(err)
+		}
+		return fxpHandle, str(nil, v.add(f))
+	case fxpOpendir:
+		name := p.str()
+		fi, err := os.Stat(name)
+		if err != nil {
+			return fxpStatus, fail(err)
+		}
+		if !fi.IsDir() {
+			return fxpStatus, status(statusFailure, "not a directory")
+		}
+		return fxpHandle, str(nil, v.add(&dir{path: name}))
+	case fxpClose:
+		h := p.str()
+		v.Lock()
+		o, ok := v.handles[h]
+		delete(v.handles, h)
+		v.Unlock()
+		if !ok {
+			return fxpStatus, status(statusFailure, "invalid handle")
+		}
+		if f, ok := o.(*os.File); ok {
+			if err := f.Close(); err != nil {
+				return fxpStatus, fail(err)
+			}
+		}
+		return fxpStatus, status(statusOK, "")
+	case fxpRead:
+		f, off, n := v.file(p.str()), p.u64(), p.u32()
+		if f == nil {
+			return fxpStatus, status(statusFailure, "invalid handle")
+		}
+		b := make([]byte, n)
+		m, err := f.ReadAt(b, int64(off))
+		if m == 0 && err == io.EOF {
+			return fxpStatus, status(statusEOF, "")
+		}
+		if m == 0 && err != nil {
+			return fxpStatus, fail(err)
+		}
+		return fxpData, bytes(nil, b[:m])
+	case fxpWrite:
+		f, off, b := v.file(p.str()), p.u64(), p.bytes()
+		if f == nil {
+			return fxpStatus, status(statusFailure, "invalid handle")
+		}
+		if _, err := f.WriteAt(b, int64(off)); err != nil {
+			return fxpStatus, fail(err)
+		}
+		return fxpStatus, status(statusOK, "")
+	case fxpStat, fxpLstat:
+		name := p.str()
+		stat := os.Stat
+		if typ == fxpLstat {
+			stat = os.Lstat
+		}
+		fi, err := stat(name)
+		if err != nil {
+			return fxpStatus, fail(err)
+		}
+		return fxpAttrs, attrs(nil, fi)
+	case fxpFstat:
+		f := v.file(p.str())
+		if f == nil {
+			return fxpStatus, status(statusFailure, "invalid handle")
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			return fxpStatus, fail(err)
+		}
+		return fxpAttrs, attrs(nil, fi)
+	case fxpSetstat:
+		name, a := p.str(), p.attrs()
+		return fxpStatus, fail(setstat(name, a))
+	case fxpFsetstat:
+		f, a := v.file(p.str()), p.attrs()
+		if f == nil {
+			return fxpStatus, status(statusFailure, "invalid handle")
+		}
+		return fxpStatus, fail(setstat(f.Name(), a))
+	case fxpReaddir:
+		h := p.str()
+		v.Lock()
+		d, ok := v.handles[h].(*dir)
+		v.Unlock()
+		if !ok {
+			return fxpStatus, status(statusFailure, "invalid handle")
+		}
+		if d.done {
+			return fxpStatus, status(statusEOF, "")
+		}
+		d.done = true
+		f, err := os.Open(d.path)
+		if err != nil {
+			return fxpStatus, fail(err)
+		}
+		entries, err := f.Readdir(-1)
+		f.Close()
+		if err != nil {
+			return fxpStatus, fail(err)
+		}
+		b := put32(nil, uint32(len(entries)))
+		for _, fi := range entries {
+			name := fi.Name()
+			if v.Names != nil {
+				name = v.Names(d.path, name)
+			}
+			b = str(b, name)
+			b = str(b, name)
+			b = attrs(b, fi)
+		}
+		return fxpName, b
+	case fxpRemove:
+		return fxpStatus, fail(os.Remove(p.str()))
+	case fxpMkdir:
+		name, a := p.str(), p.attrs()
+		perm := os.FileMode(0755)
+		if a.flags&attrPermissions != 0 {
+			perm = os.FileMode(a.mode & 0777)
+		}
+		return fxpStatus, fail(os.Mkdir(name, perm))
+	case fxpRmdir:
+		return fxpStatus, fail(os.Remove(p.str()))
+	case fxpRealpath:
+		name, err := filepath.Abs(p.str())
+		if err != nil {
+			return fxpStatus, fail(err)
+		}
+		b := put32(nil, 1)
+		b = str(b, name)
+		b = str(b, name)
+		return fxpName, put32(b, 0)
+	case fxpRename:
+		from, to := p.str(), p.str()
+		return fxpStatus, fail(os.Rename(from, to))
+	default:
+		return fxpStatus, status(statusOpUnsupported, "unsupported operation "+strconv.Itoa(int(typ)))
+	}
+}
+
+func (v *Server) add(o interface{}) string {
+	v.Lock()
+	defer v.Unlock()
+	v.next++
+	h := strconv.Itoa(v.next)
+	v.handles[h] = o
+	return h
+}
+
+func (v *Server) file(h string) *os.File {
+	v.Lock()
+	defer v.Unlock()
+	f, _ := v.handles[h].(*os.File)
+	return f
+}
+
+// setstat applies the permissions, times and size of the attributes
+func setstat(name string, a *attributes) error {
+	if a.flags&attrSize != 0 {
+		if err := os.Truncate(name, int64(a.size)); err != nil {
+			return err
+		}
+	}
+	if a.flags&attrPermissions != 0 {
+		if err := os.Chmod(name, os.FileMode(a.mode&0777)); err != nil {
+			return err
+		}
+	}
+	if a.flags&attrACModTime != 0 {
+		return os.Chtimes(name, time.Unix(int64(a.atime), 0), time.Unix(int64(a.mtime), 0))
+	}
+	return nil
+}
+
+// status reply, OK when err is nil
+func fail(err error) []byte {
+	switch {
+	case err == nil:
+		return status(statusOK, "")
+	case os.IsNotExist(err):
+		return status(statusNoSuchFile, err.Error())
+	case os.IsPermission(err):
+		return status(statusPermissionDenied, err.Error())
+	default:
+		return status(statusFailure, err.Error())
+	}
+}
+
+func status(code uint32, msg string) []byte {
+	b := put32(nil, code)
+	b = str(b, msg)
+	return str(b, "")
+}
+
+// attributes of a request
+type attributes struct {
+	flags        uint32
+	size         uint64
+	mode         uint32
+	atime, mtime uint32
+}
+
+func attrs(b []byte, fi os.FileInfo) []byte {
+	mode := uint32(fi.Mode().Perm())
+	switch {
+	case fi.IsDir():
+		mode |= 0040000
+	case fi.Mode()&os.ModeSymlink != 0:
+		mode |= 0120000
+	case fi.Mode().IsRegular():
+		mode |= 0100000
+	}
+	b = put32(b, attrSize|attrUIDGID|attrPermissions|attrACModTime)
+	b = put32(put32(b, uint32(fi.Size()>>32)), uint32(fi.Size()))
+	b = put32(put32(b, 0), 0)
+	b = put32(b, mode)
+	mtime := uint32(fi.ModTime().Unix())
+	return put32(put32(b, mtime), mtime)
+}
+
+func put32(b []byte, n uint32) []byte {
+	return append(b, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func str(b []byte, s string) []byte {
+	return append(put32(b, uint32(len(s))), s...)
+}
+
+func bytes(b, data []byte) []byte {
+	return append(put32(b, uint32(len(data))), data...)
+}
+
+// request reader
+type packet struct {
+	b   []byte
+	err error
+}
+
+func (v *packet) u32() uint32 {
+	if len(v.b) < 4 {
+		v.err = errShortPacket
+		return 0
+	}
+	n := binary.BigEndian.Uint32(v.b)
+	v.b = v.b[4:]
+	return n
+}
+
+func (v *packet) u64() uint64 {
+	if len(v.b) < 8 {
+		v.err = errShortPacket
+		return 0
+	}
+	n := binary.BigEndian.Uint64(v.b)
+	v.b = v.b[8:]
+	return n
+}
+
+func (v *packet) bytes() []byte {
+	n := v.u32()
+	if uint32(len(v.b)) < n {
+		v.err = errShortPacket
+		return nil
+	}
+	b := v.b[:n]
+	v.b = v.b[n:]
+	return b
+}
+
+func (v *packet) str() string {
+	return string(v.bytes())
+}
+
+func (v *packet) attrs() *attributes {
+	a := &attributes{flags: v.u32()}
+	if a.flags&attrSize != 0 {
+		a.size = v.u64()
+	}
+	if a.flags&attrUIDGID != 0 {
+		v.u32()
+		v.u32()
+	}
+	if a.flags&attrPermissions != 0 {
+		a.mode = v.u32()
+	}
+	if a.flags&attrACModTime != 0 {
+		a.atime, a.mtime = v.u32(), v.u32()
+	}
+	return a
+}
+
+func write(w io.Writer, typ byte, b []byte) error {
+	p := put32(make([]byte, 0, len(b)+5), uint32(len(b)+1))
+	p = append(p, typ)
+	_, err := w.Write(append(p, b...))
+	return err
+}
+
+func read(r io.Reader) (byte, []byte, error) {
+	var h [5]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(h[:4])
+	if n < 1 || n > 256*1024 {
+		return 0, nil, errShortPacket
+	}
+	b := make([]byte, n-1)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, nil, err
+	}
+	return h[4], b, nil
+}
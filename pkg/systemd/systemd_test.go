@@ -0,0 +1,193 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// pass duplicates the listeners to consecutive descriptors from fd on, as
+// the service manager passes them from 3 on
+func pass(t *testing.T, fd int, listeners ...net.Listener) {
+	prev := listenFdsStart
+	listenFdsStart = fd
+	t.Cleanup(func() { listenFdsStart = prev })
+	for i, l := range listeners {
+		f, err := l.(interface{ File() (*os.File, error) }).File()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := syscall.Dup2(int(f.Fd()), fd+i); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+}
+
+func TestListeners(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	unix, err := net.Listen("unix", filepath.Join(t.TempDir(), "sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close()
+	pass(t, 200, tcp, unix)
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "2")
+	t.Setenv("LISTEN_FDNAMES", "ssh")
+
+	ls, err := Listeners()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 2 {
+		t.Fatalf("%d listeners", len(ls))
+	}
+	defer ls[0].Close()
+	defer ls[1].Close()
+	if ls[0].Name != "ssh" || ls[1].Name != "LISTEN_FD_201" {
+		t.Errorf("names = %q, %q", ls[0].Name, ls[1].Name)
+	}
+	if ls[0].Addr().String() != tcp.Addr().String() || ls[1].Addr().String() != unix.Addr().String() {
+		t.Errorf("addrs = %s, %s", ls[0].Addr(), ls[1].Addr())
+	}
+	for _, name := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		if _, ok := os.LookupEnv(name); ok {
+			t.Errorf("%s left in the environment", name)
+		}
+	}
+	// the inherited socket accepts connections
+	go func() {
+		if c, err := net.Dial("tcp", tcp.Addr().String()); err == nil {
+			c.Close()
+		}
+	}()
+	c, err := ls[0].Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+}
+
+func TestListenersNotActivated(t *testing.T) {
+	for _, env := range []map[string]string{
+		{},
+		{"LISTEN_PID": "1", "LISTEN_FDS": "1"},
+		{"LISTEN_PID": strconv.Itoa(os.Getpid()), "LISTEN_FDS": "0"},
+		{"LISTEN_PID": strconv.Itoa(os.Getpid()), "LISTEN_FDS": "x"},
+	} {
+		t.Setenv("LISTEN_PID", "")
+		t.Setenv("LISTEN_FDS", "")
+		for k, v := range env {
+			t.Setenv(k, v)
+		}
+		if ls, err := Listeners(); ls != nil || err != nil {
+			t.Errorf("%v: listeners = %v, %v", env, ls, err)
+		}
+	}
+}
+
+func TestListenersNotASocket(t *testing.T) {
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := syscall.Dup2(int(f.Fd()), 210); err != nil {
+		t.Fatal(err)
+	}
+	prev := listenFdsStart
+	listenFdsStart = 210
+	defer func() { listenFdsStart = prev }()
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+	if _, err := Listeners(); err == nil {
+		t.Fatal("a file was accepted as a listener")
+	}
+}
+
+// notifySocket listens on a datagram socket set as NOTIFY_SOCKET
+func notifySocket(t *testing.T, name string) *net.UnixConn {
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func receive(t *testing.T, conn *net.UnixConn) string {
+	b := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b[:n])
+}
+
+func TestNotify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify")
+	conn := notifySocket(t, path)
+	t.Setenv("NOTIFY_SOCKET", path)
+	ok, err := Notify("READY=1\nSTATUS=Listening")
+	if !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	if got := receive(t, conn); got != "READY=1\nSTATUS=Listening" {
+		t.Errorf("state = %q", got)
+	}
+}
+
+func TestNotifyAbstract(t *testing.T) {
+	name := "universe-test-" + strconv.Itoa(os.Getpid())
+	conn := notifySocket(t, "\x00"+name)
+	t.Setenv("NOTIFY_SOCKET", "@"+name)
+	if ok, err := Notify("WATCHDOG=1"); !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	if got := receive(t, conn); got != "WATCHDOG=1" {
+		t.Errorf("state = %q", got)
+	}
+}
+
+func TestNotifyUnset(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if ok, err := Notify("READY=1"); ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	t.Setenv("NOTIFY_SOCKET", filepath.Join(t.TempDir(), "missing"))
+	if ok, err := Notify("READY=1"); ok || err == nil {
+		t.Fatal(ok, err)
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	for _, c := range []struct {
+		usec, pid string
+		interval  time.Duration
+		err       error
+	}{
+		{"", "", 0, nil},
+		{"2000000", "", 2 * time.Second, nil},
+		{"2000000", strconv.Itoa(os.Getpid()), 2 * time.Second, nil},
+		{"2000000", "1", 0, nil},
+		{"0", "", 0, ErrInvalidWatchdog},
+		{"x", "", 0, ErrInvalidWatchdog},
+	} {
+		t.Setenv("WATCHDOG_USEC", c.usec)
+		t.Setenv("WATCHDOG_PID", c.pid)
+		d, err := Watchdog()
+		if d != c.interval || err != c.err {
+			t.Errorf("usec %q pid %q: %v, %v", c.usec, c.pid, d, err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package proxy
+
+import "encoding/json"
+
+// Event topics
+const (
+	EventProxyStarted    string = "proxy-started"
+	EventProxyStopped           = "proxy-stopped"
+	TraceProxyConnect           = "proxy-connect"
+	TraceProxyUpstream          = "proxy-upstream"
+	TraceProxyDisconnect        = "proxy-disconnect"
+)
+
+// Topics lists every proxy topic
+var Topics = []string{
+	EventProxyStarted,
+	EventProxyStopped,
+	TraceProxyConnect,
+	TraceProxyUpstream,
+	TraceProxyDisconnect,
+}
+
+// Event interface for proxy, satisfies server.Event
+type Event interface {
+	Topic() string
+	Message() string
+	String() string
+}
+
+// proxy event
+type event struct {
+	topic, message string
+	err            error
+}
+
+// Topic returns event topic
+func (v *event) Topic() string {
+	return v.topic
+}
+
+// Message returns event message
+func (v *event) Message() string {
+	return v.message
+}
+
+// Error returns event error
+func (v *event) Error() error {
+	return v.err
+}
+
+// String returns event object in string format
+func (v *event) String() string {
+	o := map[string]interface{}{
+		"topic": v.topic,
+	}
+	if v.message != "" {
+		o["message"] = v.message
+	}
+	if v.err != nil {
+		o["error"] = v.err.Error()
+	}
+	b, _ := json.Marshal(o)
+	return string(b[:])
+}
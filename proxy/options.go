@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/samuelngs/universe/pkg/uuid"
+)
+
+// Option func
+type Option func(*Options)
+
+// Options for proxy
+type Options struct {
+	sync.RWMutex
+	// Proxy Id
+	ProxyID string
+	// Proxy listen addr
+	ListenAddr string
+	// Upstream universe servers, connections are balanced round robin
+	Upstreams []string
+	// Upstream dial timeout
+	DialTimeout time.Duration
+}
+
+// newOptions creates new option
+func newOptions(opts ...Option) *Options {
+	o := &Options{
+		ProxyID:     uuid.MustV4(),
+		ListenAddr:  ":0",
+		Upstreams:   make([]string, 0),
+		DialTimeout: 10 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// ID option
+func ID(s string) Option {
+	return func(o *Options) {
+		o.SetProxyID(s)
+	}
+}
+
+// ListenAddr option
+func ListenAddr(s string) Option {
+	return func(o *Options) {
+		o.SetListenAddr(s)
+	}
+}
+
+// Upstream option
+func Upstream(addrs ...string) Option {
+	return func(o *Options) {
+		o.AddUpstream(addrs...)
+	}
+}
+
+// DialTimeout option
+func DialTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.SetDialTimeout(d)
+	}
+}
+
+// SetProxyID to set proxy reference id
+func (v *Options) SetProxyID(s string) *Options {
+	v.Lock()
+	defer v.Unlock()
+	if len(s) > 0 {
+		v.ProxyID = s
+	}
+	return v
+}
+
+// SetListenAddr to set listen address
+func (v *Options) SetListenAddr(addr string) *Options {
+	v.Lock()
+	defer v.Unlock()
+	if len(addr) > 0 {
+		v.ListenAddr = addr
+	}
+	return v
+}
+
+// AddUpstream to add upstream servers
+func (v *Options) AddUpstream(addrs ...string) *Options {
+	v.Lock()
+	defer v.Unlock()
+	for _, addr := range addrs {
+		if len(addr) > 0 {
+			v.Upstreams = append(v.Upstreams, addr)
+		}
+	}
+	return v
+}
+
+// SetDialTimeout to set upstream dial timeout
+func (v *Options) SetDialTimeout(d time.Duration) *Options {
+	v.Lock()
+	defer v.Unlock()
+	if d > 0 {
+		v.DialTimeout = d
+	}
+	return v
+}
+
+// GetProxyID to return proxy id
+func (v *Options) GetProxyID() string {
+	v.RLock()
+	defer v.RUnlock()
+	return v.ProxyID
+}
+
+// GetListenAddr to return listen address
+func (v *Options) GetListenAddr() string {
+	v.RLock()
+	defer v.RUnlock()
+	return v.ListenAddr
+}
+
+// GetUpstreams to return upstream servers
+func (v *Options) GetUpstreams() []string {
+	v.RLock()
+	defer v.RUnlock()
+	return append([]string(nil), v.Upstreams...)
+}
+
+// GetDialTimeout to return upstream dial timeout
+func (v *Options) GetDialTimeout() time.Duration {
+	v.RLock()
+	defer v.RUnlock()
+	return v.DialTimeout
+}
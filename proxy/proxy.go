@@ -1 +1,229 @@
 package proxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/samuelngs/universe/errors"
+	"github.com/samuelngs/universe/pkg/bus"
+)
+
+const namespace string = "proxy"
+
+// Error messages
+var (
+	ErrNoUpstreams = errors.BadRequest(namespace, "no upstream servers configured")
+	ErrStarted     = errors.BadRequest(namespace, "proxy is already running")
+)
+
+// Proxy relays secure shell connections to upstream universe servers
+type Proxy interface {
+	Run() error
+	Stop() error
+	Started() bool
+	Option() *Options
+	Subscribe() <-chan Event
+	Bus() bus.Bus
+}
+
+// New create proxy
+func New(opts ...Option) Proxy {
+	p := new(proxy)
+	p.option = newOptions(opts...)
+	p.bus = bus.New()
+	p.eventsub = p.bus.Subscribe(bus.Topics(Topics...))
+	p.conns = make(map[net.Conn]struct{})
+	return p
+}
+
+// internal proxy
+type proxy struct {
+	sync.Mutex
+	option   *Options
+	bus      bus.Bus
+	eventsub bus.Subscription
+	events   chan Event
+	once     sync.Once
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	next     int
+	started  bool
+	stopped  bool
+}
+
+// emit publishes an event without blocking the relay
+func (v *proxy) emit(e *event) {
+	v.bus.Publish(e)
+}
+
+func (v *proxy) Run() error {
+	if len(v.option.GetUpstreams()) == 0 {
+		return ErrNoUpstreams
+	}
+	v.Lock()
+	if v.started || v.stopped {
+		v.Unlock()
+		return ErrStarted
+	}
+	listener, err := net.Listen("tcp", v.option.GetListenAddr())
+	if err != nil {
+		v.Unlock()
+		return err
+	}
+	v.listener = listener
+	v.started = true
+	v.Unlock()
+	v.emit(&event{
+		topic:   EventProxyStarted,
+		message: fmt.Sprintf("Proxy listening on %s", listener.Addr().String()),
+	})
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !v.Started() {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return err
+		}
+		go v.relay(conn)
+	}
+}
+
+// relay connects the client to the first reachable upstream
+func (v *proxy) relay(conn net.Conn) {
+	upstreams := v.option.GetUpstreams()
+	v.Lock()
+	start := v.next
+	v.next++
+	v.Unlock()
+	var (
+		upstream net.Conn
+		err      error
+	)
+	for i := range upstreams {
+		addr := upstreams[(start+i)%len(upstreams)]
+		upstream, err = net.DialTimeout("tcp", addr, v.option.GetDialTimeout())
+		if err == nil {
+			break
+		}
+		v.emit(&event{
+			topic:   TraceProxyUpstream,
+			message: fmt.Sprintf("Upstream %s unreachable", addr),
+			err:     err,
+		})
+	}
+	if upstream == nil {
+		conn.Close()
+		return
+	}
+	if !v.track(conn, upstream) {
+		conn.Close()
+		upstream.Close()
+		return
+	}
+	v.emit(&event{
+		topic:   TraceProxyConnect,
+		message: fmt.Sprintf("Relaying %s to %s", conn.RemoteAddr(), upstream.RemoteAddr()),
+	})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	pipe := func(dst, src net.Conn) {
+		defer wg.Done()
+		io.Copy(dst, src)
+		if c, ok := dst.(*net.TCPConn); ok {
+			c.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+	go pipe(upstream, conn)
+	go pipe(conn, upstream)
+	wg.Wait()
+	v.untrack(conn, upstream)
+	conn.Close()
+	upstream.Close()
+	v.emit(&event{
+		topic:   TraceProxyDisconnect,
+		message: fmt.Sprintf("Connection from %s closed", conn.RemoteAddr()),
+	})
+}
+
+// track registers relayed connections so Stop can close them, false if
+// the proxy is stopping
+func (v *proxy) track(conns ...net.Conn) bool {
+	v.Lock()
+	defer v.Unlock()
+	if !v.started {
+		return false
+	}
+	for _, conn := range conns {
+		v.conns[conn] = struct{}{}
+	}
+	return true
+}
+
+func (v *proxy) untrack(conns ...net.Conn) {
+	v.Lock()
+	defer v.Unlock()
+	for _, conn := range conns {
+		delete(v.conns, conn)
+	}
+}
+
+// Stop closes the listener and every relayed connection, the event stream
+// is closed afterwards and the proxy cannot be started again
+func (v *proxy) Stop() error {
+	v.Lock()
+	defer v.Unlock()
+	if v.stopped {
+		return nil
+	}
+	var err error
+	if v.started {
+		v.started = false
+		err = v.listener.Close()
+		for conn := range v.conns {
+			conn.Close()
+		}
+		v.emit(&event{topic: EventProxyStopped})
+	}
+	v.stopped = true
+	v.bus.Close()
+	return err
+}
+
+func (v *proxy) Started() bool {
+	v.Lock()
+	defer v.Unlock()
+	return v.started
+}
+
+func (v *proxy) Option() *Options {
+	return v.option
+}
+
+// Subscribe returns the proxy events, the channel is shared by every
+// caller and closed once the proxy is stopped
+func (v *proxy) Subscribe() <-chan Event {
+	v.once.Do(func() {
+		events := make(chan Event)
+		go func() {
+			defer close(events)
+			for m := range v.eventsub.C() {
+				events <- m.(Event)
+			}
+		}()
+		v.events = events
+	})
+	return v.events
+}
+
+// Bus returns the bus proxy events are published on
+func (v *proxy) Bus() bus.Bus {
+	return v.bus
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/samuelngs/universe/clientv1"
+	"github.com/samuelngs/universe/pkg/crypto"
+)
+
+// run executes a command across hosts, usage:
+//
+//	universe run -hosts a,b,c [flags] <command>
+func run(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	var (
+		hosts       = fs.String("hosts", "", "comma separated list of [user@]<addr>[:<port>]")
+		hostsfile   = fs.String("hosts-file", "", "path to a file with one host per line")
+		user        = fs.String("user", "", "remote user name")
+		identity    = fs.String("identity", "", "path to the private key file")
+		agent       = fs.Bool("agent", os.Getenv("SSH_AUTH_SOCK") != "", "use keys from ssh-agent")
+		concurrency = fs.Int("concurrency", 10, "maximum number of hosts running at once")
+		timeout     = fs.Duration("timeout", 5*time.Minute, "time allowed per host")
+		knownhosts  = fs.String("known-hosts", clientv1.DefaultKnownHostsFile(), "path to the known_hosts file")
+		hostkeys    = fs.String("host-key-checking", "strict", "host key checking mode (strict, accept-new)")
+		quiet       = fs.Bool("quiet", false, "do not stream command output")
+	)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: universe run [flags] <command>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cmd := strings.Join(fs.Args(), " ")
+	if cmd == "" {
+		fs.Usage()
+		return 2
+	}
+
+	targets := split(*hosts)
+	if *hostsfile != "" {
+		f, err := os.Open(*hostsfile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if s := strings.TrimSpace(scanner.Text()); s != "" && !strings.HasPrefix(s, "#") {
+				targets = append(targets, s)
+			}
+		}
+		f.Close()
+	}
+	if len(targets) == 0 {
+		fmt.Fprintln(os.Stderr, "no hosts specified")
+		return 2
+	}
+
+	var mode clientv1.HostKeyMode
+	switch *hostkeys {
+	case "strict":
+		mode = clientv1.HostKeyStrict
+	case "accept-new":
+		mode = clientv1.HostKeyAcceptNew
+	default:
+		fmt.Fprintf(os.Stderr, "unknown host key checking mode %q\n", *hostkeys)
+		return 2
+	}
+
+	opts := []clientv1.Option{
+		clientv1.User(*user),
+		clientv1.Agent(*agent),
+		clientv1.Password(os.Getenv("UNIVERSE_PASSWORD")),
+		clientv1.KnownHostsFile(mode, *knownhosts),
+	}
+	if *identity != "" {
+		key, err := crypto.Import(*identity)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		opts = append(opts, clientv1.Key(key))
+	}
+
+	fleet := clientv1.NewFleet(
+		targets,
+		clientv1.Concurrency(*concurrency),
+		clientv1.HostTimeout(*timeout),
+		clientv1.ClientOptions(opts...),
+	)
+	if !*quiet {
+		fleet.Output = os.Stdout
+	}
+
+	summary := fleet.Run(cmd)
+	fmt.Fprint(os.Stderr, summary)
+	if summary.Failed() {
+		return 1
+	}
+	return 0
+}
+
+func split(s string) []string {
+	o := make([]string, 0)
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			o = append(o, v)
+		}
+	}
+	return o
+}
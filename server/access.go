@@ -0,0 +1,225 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/samuelngs/universe/errors"
+)
+
+// Rules of the network access control. Entries are an address, a CIDR or
+// @<group>, and are negated by a leading !. A list matches a source when an
+// entry matches it and no negated entry does.
+type Rules struct {
+	// Sources allowed to connect, every source when empty
+	Allow []string
+	// Sources refused, even when allowed
+	Deny []string
+	// Sources each user may authenticate from, users missing or with an
+	// empty list are not restricted
+	Users map[string][]string
+	// Group files by name, one address or CIDR per line, # starts a comment
+	Groups map[string]string
+}
+
+// Access is the compiled network access control, sources other than IP
+// addresses such as unix socket peers are not restricted. A nil Access
+// allows every source.
+type Access struct {
+	rules Rules
+	allow *ruleset
+	deny  *ruleset
+	users map[string]*ruleset
+}
+
+// entry of a rule list
+type entry struct {
+	text    string
+	negated bool
+	nets    []*net.IPNet
+}
+
+// ruleset is a compiled rule list
+type ruleset struct {
+	entries []entry
+}
+
+// NewAccess compiles the rules, the group files are read once
+func NewAccess(r Rules) (*Access, error) {
+	groups := make(map[string][]*net.IPNet, len(r.Groups))
+	for name, path := range r.Groups {
+		nets, err := readGroup(path)
+		if err != nil {
+			return nil, errors.BadRequest(namespace, "invalid access group").Info(fmt.Sprintf("%s: %v", name, err))
+		}
+		groups[name] = nets
+	}
+	v := &Access{rules: r, users: make(map[string]*ruleset, len(r.Users))}
+	var err error
+	if v.allow, err = compile(r.Allow, groups); err != nil {
+		return nil, err
+	}
+	if v.deny, err = compile(r.Deny, groups); err != nil {
+		return nil, err
+	}
+	for user, list := range r.Users {
+		rs, err := compile(list, groups)
+		if err != nil {
+			return nil, err
+		}
+		if rs != nil {
+			v.users[user] = rs
+		}
+	}
+	return v, nil
+}
+
+// readGroup reads the networks of a group file
+func readGroup(path string) ([]*net.IPNet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	nets := make([]*net.IPNet, 0)
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		text := s.Text()
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = text[:i]
+		}
+		if text = strings.TrimSpace(text); text == "" {
+			continue
+		}
+		n := cidr(text)
+		if n == nil {
+			return nil, fmt.Errorf("line %d: invalid address %q", line, text)
+		}
+		nets = append(nets, n)
+	}
+	return nets, s.Err()
+}
+
+// compile parses the rule list, nil when empty
+func compile(list []string, groups map[string][]*net.IPNet) (*ruleset, error) {
+	if len(list) == 0 {
+		return nil, nil
+	}
+	rs := &ruleset{entries: make([]entry, 0, len(list))}
+	for _, s := range list {
+		e := entry{text: s}
+		s = strings.TrimSpace(s)
+		if strings.HasPrefix(s, "!") {
+			e.negated = true
+			s = s[1:]
+		}
+		switch {
+		case strings.HasPrefix(s, "@"):
+			nets, ok := groups[s[1:]]
+			if !ok {
+				return nil, errors.BadRequest(namespace, "invalid access rule").Info(fmt.Sprintf("unknown group %q", s[1:]))
+			}
+			e.nets = nets
+		case cidr(s) != nil:
+			e.nets = []*net.IPNet{cidr(s)}
+		default:
+			return nil, errors.BadRequest(namespace, "invalid access rule").Info(e.text)
+		}
+		rs.entries = append(rs.entries, e)
+	}
+	return rs, nil
+}
+
+// match returns the entry matching the address and whether the list
+// matches, a negated entry returns the entry and false
+func (v *ruleset) match(ip net.IP) (string, bool) {
+	for _, e := range v.entries {
+		if e.negated && e.contains(ip) {
+			return e.text, false
+		}
+	}
+	for _, e := range v.entries {
+		if !e.negated && e.contains(ip) {
+			return e.text, true
+		}
+	}
+	return "", false
+}
+
+func (v entry) contains(ip net.IP) bool {
+	for _, n := range v.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceIP returns the address of a tcp source, nil for other sources
+func sourceIP(addr net.Addr) net.IP {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return tcp.IP
+	}
+	return nil
+}
+
+// Rules returns the rules the access control was compiled from
+func (v *Access) Rules() Rules {
+	if v == nil {
+		return Rules{}
+	}
+	return v.rules
+}
+
+// Check returns true if the source may connect, otherwise the rule that
+// refused it
+func (v *Access) Check(addr net.Addr) (string, bool) {
+	src := sourceIP(addr)
+	if v == nil || src == nil {
+		return "", true
+	}
+	if v.deny != nil {
+		if e, ok := v.deny.match(src); ok {
+			return "deny " + e, false
+		}
+	}
+	if v.allow != nil {
+		e, ok := v.allow.match(src)
+		switch {
+		case ok:
+		case e != "":
+			return "allow " + e, false
+		default:
+			return "allow (no match)", false
+		}
+	}
+	return "", true
+}
+
+// CheckUser returns true if the user may authenticate from the source,
+// otherwise the rule that refused it
+func (v *Access) CheckUser(addr net.Addr, user string) (string, bool) {
+	if rule, ok := v.Check(addr); !ok {
+		return rule, false
+	}
+	src := sourceIP(addr)
+	if v == nil || src == nil {
+		return "", true
+	}
+	rs, ok := v.users[user]
+	if !ok {
+		return "", true
+	}
+	e, ok := rs.match(src)
+	switch {
+	case ok:
+		return "", true
+	case e != "":
+		return fmt.Sprintf("users.%s %s", user, e), false
+	default:
+		return fmt.Sprintf("users.%s (no match)", user), false
+	}
+}
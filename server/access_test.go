@@ -0,0 +1,120 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samuelngs/universe/pkg/bus"
+)
+
+func TestAccessCheck(t *testing.T) {
+	group := filepath.Join(t.TempDir(), "office.cidr")
+	if err := ioutil.WriteFile(group, []byte("# office\n192.0.2.0/24 # main\n\n2001:db8::/32\n198.51.100.7\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewAccess(Rules{
+		Allow:  []string{"10.0.0.0/8", "@office"},
+		Deny:   []string{"10.66.0.0/16", "!10.66.0.5"},
+		Users:  map[string][]string{"root": {"10.1.2.0/24", "!10.1.2.9"}, "any": {}},
+		Groups: map[string]string{"office": group},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		ip, user, rule string
+		ok             bool
+	}{
+		{"10.0.0.1", "", "", true},
+		{"10.66.1.1", "", "deny 10.66.0.0/16", false},
+		{"10.66.0.5", "", "", true},
+		{"192.0.2.7", "", "", true},
+		{"2001:db8::1", "", "", true},
+		{"2001:db9::1", "", "allow (no match)", false},
+		{"198.51.100.7", "", "", true},
+		{"198.51.100.8", "", "allow (no match)", false},
+		{"::ffff:10.0.0.1", "", "", true},
+		{"8.8.8.8", "", "allow (no match)", false},
+		{"10.1.2.3", "root", "", true},
+		{"10.1.2.9", "root", "users.root !10.1.2.9", false},
+		{"10.0.0.1", "root", "users.root (no match)", false},
+		{"10.66.1.1", "root", "deny 10.66.0.0/16", false},
+		{"10.0.0.1", "any", "", true},
+		{"8.8.8.8", "bob", "allow (no match)", false},
+	} {
+		addr := tcpAddr(c.ip, 40000)
+		var (
+			rule string
+			ok   bool
+		)
+		if c.user == "" {
+			rule, ok = a.Check(addr)
+		} else {
+			rule, ok = a.CheckUser(addr, c.user)
+		}
+		if rule != c.rule || ok != c.ok {
+			t.Errorf("%s %s: %q, %v, want %q, %v", c.ip, c.user, rule, ok, c.rule, c.ok)
+		}
+	}
+	if _, ok := a.Check(&net.UnixAddr{Name: "@", Net: "unix"}); !ok {
+		t.Error("unix socket peer refused")
+	}
+	var none *Access
+	if _, ok := none.CheckUser(tcpAddr("8.8.8.8", 40000), "root"); !ok {
+		t.Error("refused without rules")
+	}
+}
+
+func TestAccessInvalid(t *testing.T) {
+	group := filepath.Join(t.TempDir(), "bad.cidr")
+	if err := ioutil.WriteFile(group, []byte("192.0.2.0/24\ngarbage\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		rules Rules
+		err   string
+	}{
+		{Rules{Allow: []string{"nope"}}, "nope"},
+		{Rules{Deny: []string{"@missing"}}, "missing"},
+		{Rules{Groups: map[string]string{"office": "/nonexistent"}}, "nonexistent"},
+		{Rules{Groups: map[string]string{"office": group}}, "line 2"},
+	} {
+		if _, err := NewAccess(c.rules); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%v: err = %v, want %q", c.rules, err, c.err)
+		}
+	}
+}
+
+func TestAccessServer(t *testing.T) {
+	s, addr := testServer(t, AccessControl(Rules{Users: map[string][]string{"root": {"10.0.0.0/8"}}}))
+	logs := s.bus.Subscribe(bus.Topics(TraceAccess))
+	defer logs.Unsubscribe()
+	refused := func(rule string) {
+		t.Helper()
+		select {
+		case m := <-logs.C():
+			if l := m.(Log); l.Fields()[FieldRule] != rule {
+				t.Fatalf("refused by %v, want %q", l.Fields()[FieldRule], rule)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("refusal not traced")
+		}
+	}
+	if _, err := testDial(t, addr, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testDial(t, addr, "root"); err == nil {
+		t.Fatal("root logged in from outside its sources")
+	}
+	refused("users.root (no match)")
+
+	s.Option().Update(AccessControl(Rules{Deny: []string{"127.0.0.0/8"}}))
+	if _, err := testDial(t, addr, "alice"); err == nil {
+		t.Fatal("denied source connected")
+	}
+	refused("deny 127.0.0.0/8")
+}
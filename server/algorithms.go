@@ -0,0 +1,145 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/samuelngs/universe/errors"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Algorithm presets
+const (
+	PresetModern        string = "modern"
+	PresetFIPS                 = "fips"
+	PresetCompatibility        = "compatibility"
+)
+
+// Algorithms offered to clients in order of preference, the x/crypto
+// defaults are used for the empty lists
+type Algorithms struct {
+	Ciphers      []string
+	KeyExchanges []string
+	MACs         []string
+	// Signature algorithms of the host keys, keys without any are not used
+	HostKeys []string
+}
+
+// presets by name
+var presets = map[string]Algorithms{
+	// AEAD ciphers, curve25519 and post-quantum hybrid key exchanges only
+	PresetModern: {
+		Ciphers:      []string{"chacha20-poly1305@openssh.com", "aes256-gcm@openssh.com", "aes128-gcm@openssh.com"},
+		KeyExchanges: []string{"mlkem768x25519-sha256", "curve25519-sha256"},
+		MACs:         []string{"hmac-sha2-512-etm@openssh.com", "hmac-sha2-256-etm@openssh.com"},
+		HostKeys:     []string{"ssh-ed25519", "ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521", "rsa-sha2-512", "rsa-sha2-256"},
+	},
+	// NIST approved primitives only
+	PresetFIPS: {
+		Ciphers:      []string{"aes256-gcm@openssh.com", "aes128-gcm@openssh.com", "aes256-ctr", "aes192-ctr", "aes128-ctr"},
+		KeyExchanges: []string{"ecdh-sha2-nistp384", "ecdh-sha2-nistp256", "ecdh-sha2-nistp521", "diffie-hellman-group16-sha512", "diffie-hellman-group14-sha256"},
+		MACs:         []string{"hmac-sha2-512-etm@openssh.com", "hmac-sha2-256-etm@openssh.com", "hmac-sha2-512", "hmac-sha2-256"},
+		HostKeys:     []string{"ecdsa-sha2-nistp384", "ecdsa-sha2-nistp256", "ecdsa-sha2-nistp521", "rsa-sha2-512", "rsa-sha2-256"},
+	},
+	// every supported algorithm, followed by the legacy ones old clients
+	// still need
+	PresetCompatibility: {
+		Ciphers:      append(ssh.SupportedAlgorithms().Ciphers, "aes128-cbc", "3des-cbc"),
+		KeyExchanges: append(ssh.SupportedAlgorithms().KeyExchanges, "diffie-hellman-group14-sha1", "diffie-hellman-group-exchange-sha1"),
+		MACs:         append(ssh.SupportedAlgorithms().MACs, "hmac-sha1-96"),
+		HostKeys:     []string{"ssh-ed25519", "ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521", "rsa-sha2-512", "rsa-sha2-256", "ssh-rsa"},
+	},
+}
+
+// Presets returns the preset names
+func Presets() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Preset returns the algorithms of the preset by name
+func Preset(name string) (Algorithms, error) {
+	a, ok := presets[name]
+	if !ok {
+		return Algorithms{}, errors.BadRequest(namespace, "unknown algorithm preset").Info(name)
+	}
+	return a.clone(), nil
+}
+
+// clone copies the lists
+func (v Algorithms) clone() Algorithms {
+	return Algorithms{
+		Ciphers:      append([]string(nil), v.Ciphers...),
+		KeyExchanges: append([]string(nil), v.KeyExchanges...),
+		MACs:         append([]string(nil), v.MACs...),
+		HostKeys:     append([]string(nil), v.HostKeys...),
+	}
+}
+
+// validate rejects the names x/crypto does not implement
+func (v Algorithms) validate() error {
+	supported, insecure := ssh.SupportedAlgorithms(), ssh.InsecureAlgorithms()
+	for _, c := range []struct {
+		kind  string
+		names []string
+		known [][]string
+	}{
+		{"cipher", v.Ciphers, [][]string{supported.Ciphers, insecure.Ciphers}},
+		{"key exchange", v.KeyExchanges, [][]string{supported.KeyExchanges, insecure.KeyExchanges, {"curve25519-sha256@libssh.org"}}},
+		{"mac", v.MACs, [][]string{supported.MACs, insecure.MACs}},
+		{"host key algorithm", v.HostKeys, [][]string{supported.HostKeys, insecure.HostKeys}},
+	} {
+		for _, name := range c.names {
+			if !known(name, c.known...) {
+				return errors.BadRequest(namespace, "invalid algorithms").Info(fmt.Sprintf("unknown %s %q", c.kind, name))
+			}
+		}
+	}
+	return nil
+}
+
+func known(name string, lists ...[]string) bool {
+	for _, list := range lists {
+		for _, s := range list {
+			if s == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// signer restricts the host key to the allowed signature algorithms that
+// apply to its type, false if none does
+func (v Algorithms) signer(signer ssh.Signer) (ssh.Signer, bool, error) {
+	if len(v.HostKeys) == 0 {
+		return signer, true, nil
+	}
+	kinds := []string{signer.PublicKey().Type()}
+	if kinds[0] == ssh.KeyAlgoRSA {
+		kinds = []string{ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSA}
+	}
+	algorithms := make([]string, 0)
+	for _, name := range v.HostKeys {
+		if known(name, kinds) {
+			algorithms = append(algorithms, name)
+		}
+	}
+	if len(algorithms) == 0 {
+		return nil, false, nil
+	}
+	as, ok := signer.(ssh.AlgorithmSigner)
+	if !ok {
+		return nil, false, nil
+	}
+	s, err := ssh.NewSignerWithAlgorithms(as, algorithms)
+	if err != nil {
+		return nil, false, err
+	}
+	return s, true, nil
+}
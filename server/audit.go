@@ -0,0 +1,174 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/samuelngs/universe/errors"
+	"github.com/samuelngs/universe/pkg/audit"
+	"github.com/samuelngs/universe/pkg/crypto"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// open the audit log, checkpoints are signed with the first Ed25519 host
+// key, or the first host key when there is none. Checkpoints are logged to
+// the trace logs, for truncations after the last one to be noticed.
+func (v *server) openAudit() error {
+	path := v.option.GetAuditLog()
+	if path == "" {
+		return nil
+	}
+	keys := v.option.GetHostKeys()
+	if len(keys) == 0 {
+		return errors.BadRequest(namespace, "audit log requires a host key")
+	}
+	key := keys[0]
+	for _, k := range keys {
+		if k.Type() == crypto.KeyEd25519 {
+			key = k
+			break
+		}
+	}
+	signer, err := key.Signer()
+	if err != nil {
+		return err
+	}
+	a, err := audit.Open(path, signer, audit.OnCheckpoint(func(seq uint64, hash string) {
+		v.log(&trace{
+			topic:   TraceAudit,
+			message: "Audit log checkpoint",
+			fields:  Fields{FieldPath: path, FieldSeq: seq, FieldHash: hash},
+		})
+	}))
+	if err != nil {
+		return err
+	}
+	v.Lock()
+	v.auditor = a
+	v.Unlock()
+	return nil
+}
+
+// closeAudit seals the audit log
+func (v *server) closeAudit() {
+	v.Lock()
+	a := v.auditor
+	v.auditor = nil
+	v.Unlock()
+	if a == nil {
+		return
+	}
+	if err := a.Close(); err != nil {
+		v.log(&trace{
+			topic:   TraceAudit,
+			level:   LevelError,
+			message: "Could not seal audit log",
+			err:     err,
+		})
+	}
+}
+
+// Audit appends a record to the audit log, nothing is recorded when the
+// audit log is disabled or the server is not running
+func (v *server) Audit(typ string, fields map[string]string) {
+	v.Lock()
+	a := v.auditor
+	v.Unlock()
+	if a == nil {
+		return
+	}
+	if err := a.Record(typ, fields); err != nil {
+		v.log(&trace{
+			topic:   TraceAudit,
+			level:   LevelError,
+			message: fmt.Sprintf("Could not record %s", typ),
+			err:     err,
+		})
+	}
+}
+
+// record returns the audit fields identifying the connection
+func (v *connection) record() map[string]string {
+	return map[string]string{
+		FieldConnectionID: v.id,
+		FieldUser:         v.conn.User(),
+		FieldRemoteAddr:   v.conn.RemoteAddr().String(),
+	}
+}
+
+// outcome of a request or channel as recorded
+func outcome(ok bool) string {
+	if ok {
+		return "accepted"
+	}
+	return "rejected"
+}
+
+// globalRequests answers the global requests of a connection, none is
+// served, and records every forward request with the reply given
+func (v *server) globalRequests(conn *connection, reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		ok := false
+		if req.WantReply {
+			req.Reply(ok, nil)
+		}
+		v.recordForwardRequest(conn, req, ok)
+	}
+}
+
+// recordForwardRequest records a remote forward request or its
+// cancellation, other requests are not recorded
+func (v *server) recordForwardRequest(conn *connection, req *ssh.Request, ok bool) {
+	fields := conn.record()
+	switch req.Type {
+	case "tcpip-forward", "cancel-tcpip-forward":
+		var payload struct {
+			Addr string
+			Port uint32
+		}
+		if err := ssh.Unmarshal(req.Payload, &payload); err == nil {
+			fields["bind"] = fmt.Sprintf("%s:%d", payload.Addr, payload.Port)
+		}
+	case "streamlocal-forward@openssh.com", "cancel-streamlocal-forward@openssh.com":
+		var payload struct{ Path string }
+		if err := ssh.Unmarshal(req.Payload, &payload); err == nil {
+			fields["bind"] = payload.Path
+		}
+	default:
+		return
+	}
+	fields["direction"] = "remote"
+	fields["request"] = req.Type
+	fields["result"] = outcome(ok)
+	v.Audit(audit.TypeForward, fields)
+}
+
+// recordForwardChannel records a local forward channel, other channel
+// types are not recorded
+func (v *server) recordForwardChannel(conn *connection, channel ssh.NewChannel, ok bool) {
+	fields := conn.record()
+	switch channel.ChannelType() {
+	case "direct-tcpip":
+		var payload struct {
+			Host     string
+			Port     uint32
+			OrigHost string
+			OrigPort uint32
+		}
+		if err := ssh.Unmarshal(channel.ExtraData(), &payload); err == nil {
+			fields["target"] = fmt.Sprintf("%s:%d", payload.Host, payload.Port)
+			fields["origin"] = fmt.Sprintf("%s:%d", payload.OrigHost, payload.OrigPort)
+		}
+	case "direct-streamlocal@openssh.com":
+		var payload struct{ Path string }
+		if err := ssh.Unmarshal(channel.ExtraData(), &payload); err == nil {
+			fields["target"] = payload.Path
+		}
+	default:
+		return
+	}
+	fields["direction"] = "local"
+	fields["request"] = channel.ChannelType()
+	fields["result"] = outcome(ok)
+	v.Audit(audit.TypeForward, fields)
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/samuelngs/universe/pkg/audit"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestAuditForwards(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	s, addr := testServer(t, AuditLog(path))
+	conn, err := testDial(t, addr, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _, err := conn.SendRequest("tcpip-forward", true, ssh.Marshal(struct {
+		Addr string
+		Port uint32
+	}{"127.0.0.1", 8080})); ok || err != nil {
+		t.Fatalf("tcpip-forward = %v, %v", ok, err)
+	}
+	conn.SendRequest("streamlocal-forward@openssh.com", true, ssh.Marshal(struct{ Path string }{"/tmp/fwd.sock"}))
+	conn.SendRequest("keepalive@openssh.com", true, nil)
+	if _, err := conn.Dial("tcp", "127.0.0.1:9090"); err == nil {
+		t.Fatal("direct-tcpip channel opened")
+	}
+	conn.Close()
+	s.Stop(context.Background())
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []map[string]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r audit.Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		if r.Type == audit.TypeForward {
+			got = append(got, r.Fields)
+		}
+	}
+	want := []map[string]string{
+		{"request": "tcpip-forward", "direction": "remote", "bind": "127.0.0.1:8080"},
+		{"request": "streamlocal-forward@openssh.com", "direction": "remote", "bind": "/tmp/fwd.sock"},
+		{"request": "direct-tcpip", "direction": "local", "target": "127.0.0.1:9090"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("forward records: %v", got)
+	}
+	for i, w := range want {
+		for k, v := range w {
+			if got[i][k] != v {
+				t.Errorf("record %d %s = %q, want %q", i, k, got[i][k], v)
+			}
+		}
+		if got[i]["result"] != "rejected" || got[i][FieldUser] != "alice" {
+			t.Errorf("record %d: %v", i, got[i])
+		}
+	}
+}
@@ -3,26 +3,94 @@ package server
 import (
 	"fmt"
 
+	"github.com/samuelngs/universe/pkg/audit"
+
 	"golang.org/x/crypto/ssh"
 )
 
+// authenticator traces the authentication attempts of a connection. Only
+// the method, user, source, result, failure reason and key fingerprint are
+// recorded, never passwords or key material.
 type authenticator struct {
-	option *Options
-	logger chan Log
+	server *server
+	// fingerprint of the key last accepted by the public key callback, the
+	// callback is not called again when the client signs with that key
+	accepted string
+}
+
+// keyError is a public key rejection carrying the key fingerprint
+type keyError struct {
+	fingerprint string
+	err         error
 }
 
-func (v *authenticator) Password(md ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
-	v.logger <- &trace{
-		topic:   TracePasswordAuthentication,
-		message: fmt.Sprintf("Password authentication from %s@%s, %s (%s) [%s]", md.User(), md.LocalAddr(), md.RemoteAddr(), md.ClientVersion(), string(pass[:])),
+func (v *keyError) Error() string {
+	return v.err.Error()
+}
+
+// wrap returns a copy of the config tracing every attempt
+func (v *authenticator) wrap(base *ssh.ServerConfig) *ssh.ServerConfig {
+	conf := *base
+	if callback := base.PublicKeyCallback; callback != nil {
+		conf.PublicKeyCallback = func(md ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			fingerprint := ssh.FingerprintSHA256(key)
+			perms, err := callback(md, key)
+			if err != nil {
+				return nil, &keyError{fingerprint, err}
+			}
+			v.accepted = fingerprint
+			return perms, nil
+		}
+	}
+	logs := base.AuthLogCallback
+	conf.AuthLogCallback = func(md ssh.ConnMetadata, method string, err error) {
+		if logs != nil {
+			logs(md, method, err)
+		}
+		v.log(md, method, err)
 	}
-	return nil, nil
+	return &conf
 }
 
-func (v *authenticator) PublicKey(md ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
-	v.logger <- &trace{
-		topic:   TraceRSAAuthentication,
-		message: fmt.Sprintf("RSA authentication from %s@%s, %s (%s) [%s]", md.User(), md.LocalAddr(), md.RemoteAddr(), md.ClientVersion(), string(key.Marshal()[:])),
+// log traces and audits the attempt, the none method clients start with is
+// only traced at debug level
+func (v *authenticator) log(md ssh.ConnMetadata, method string, err error) {
+	fields := Fields{
+		FieldUser:       md.User(),
+		FieldRemoteAddr: md.RemoteAddr().String(),
+		FieldMethod:     method,
+		FieldResult:     "success",
+	}
+	if ke, ok := err.(*keyError); ok {
+		fields[FieldFingerprint] = ke.fingerprint
+		err = ke.err
+	} else if method == "publickey" && err == nil && v.accepted != "" {
+		fields[FieldFingerprint] = v.accepted
+	}
+	t := &trace{topic: TraceAuthentication, err: err, fields: fields}
+	switch {
+	case method == "none":
+		t.level = LevelDebug
+		t.message = fmt.Sprintf("Authentication started for %s from %s", md.User(), md.RemoteAddr())
+	case err != nil:
+		t.level = LevelWarn
+		t.message = fmt.Sprintf("Rejected %s authentication for %s from %s", method, md.User(), md.RemoteAddr())
+	default:
+		t.message = fmt.Sprintf("Accepted %s authentication for %s from %s", method, md.User(), md.RemoteAddr())
+	}
+	if err != nil {
+		fields[FieldResult] = "failure"
+	}
+	v.server.log(t)
+	if method == "none" {
+		return
+	}
+	record := make(map[string]string, len(fields)+1)
+	for k, val := range fields {
+		record[k] = fmt.Sprint(val)
+	}
+	if err != nil {
+		record[FieldReason] = err.Error()
 	}
-	return nil, nil
+	v.server.Audit(audit.TypeAuth, record)
 }
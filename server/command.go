@@ -0,0 +1,186 @@
+package server
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/kr/pty"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// time a command is given to exit after a hangup, and after it is killed
+var hangupTimeout = 5 * time.Second
+
+// command running on a session
+type command struct {
+	*exec.Cmd
+	// pty master, nil when no pty was requested
+	pty *os.File
+	// output read ends, closed when processes outside of the group keep
+	// them open
+	output []io.Closer
+	done   chan struct{}
+}
+
+// start runs the command on a pty of the size when one is given, otherwise
+// on pipes, copying its input and output over the channel. The exit status
+// is sent and the channel closed once the command exits.
+func start(cmd *exec.Cmd, channel ssh.Channel, size *Winsize) (*command, error) {
+	c := &command{Cmd: cmd, done: make(chan struct{})}
+	var output sync.WaitGroup
+	if size != nil {
+		fi, err := pty.Start(cmd)
+		if err != nil {
+			return nil, err
+		}
+		setWinsize(fi.Fd(), uint32(size.Width), uint32(size.Height))
+		c.pty = fi
+		c.output = []io.Closer{fi}
+		output.Add(1)
+		go func() {
+			// ends with EIO once every process holding the pty exited
+			io.Copy(channel, fi)
+			output.Done()
+		}()
+		go io.Copy(fi, channel)
+	} else {
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		stderr, err := cmd.StderrPipe()
+		if err != nil {
+			return nil, err
+		}
+		// a process group of its own to hang up, pty.Start starts a new
+		// session instead
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		if err := cmd.Start(); err != nil {
+			return nil, err
+		}
+		c.output = []io.Closer{stdout, stderr}
+		output.Add(2)
+		go func() {
+			io.Copy(channel, stdout)
+			output.Done()
+		}()
+		go func() {
+			io.Copy(channel.Stderr(), stderr)
+			output.Done()
+		}()
+		go func() {
+			io.Copy(stdin, channel)
+			stdin.Close()
+		}()
+	}
+	go func() {
+		output.Wait()
+		cmd.Wait()
+		if c.pty != nil {
+			c.pty.Close()
+		}
+		exit(channel, cmd.ProcessState)
+		channel.Close()
+		close(c.done)
+	}()
+	return c, nil
+}
+
+// resize changes the size of the pty, if any
+func (v *command) resize(w, h uint32) {
+	if v.pty != nil {
+		setWinsize(v.pty.Fd(), w, h)
+	}
+}
+
+// hangup signals the processes of the command the client is gone and
+// waits for the command to exit. Processes ignoring the hangup are killed,
+// and the output of those that left the group is closed.
+func (v *command) hangup() {
+	syscall.Kill(-v.Process.Pid, syscall.SIGHUP)
+	if v.wait(hangupTimeout) {
+		return
+	}
+	syscall.Kill(-v.Process.Pid, syscall.SIGKILL)
+	if v.wait(hangupTimeout) {
+		return
+	}
+	for _, c := range v.output {
+		c.Close()
+	}
+	<-v.done
+}
+
+// wait returns true if the command exited within the timeout
+func (v *command) wait(timeout time.Duration) bool {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-v.done:
+		return true
+	case <-t.C:
+		return false
+	}
+}
+
+// exit sends the exit status, or the signal that terminated the process
+func exit(channel ssh.Channel, state *os.ProcessState) {
+	if state == nil {
+		return
+	}
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		channel.SendRequest("exit-signal", false, ssh.Marshal(struct {
+			Signal     string
+			CoreDumped bool
+			Error      string
+			Lang       string
+		}{
+			Signal:     signame(ws.Signal()),
+			CoreDumped: ws.CoreDump(),
+		}))
+		return
+	}
+	channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(state.ExitCode())}))
+}
+
+// signame returns the name of the signal as RFC 4254 lists it
+func signame(s syscall.Signal) string {
+	switch s {
+	case syscall.SIGABRT:
+		return "ABRT"
+	case syscall.SIGALRM:
+		return "ALRM"
+	case syscall.SIGFPE:
+		return "FPE"
+	case syscall.SIGHUP:
+		return "HUP"
+	case syscall.SIGILL:
+		return "ILL"
+	case syscall.SIGINT:
+		return "INT"
+	case syscall.SIGKILL:
+		return "KILL"
+	case syscall.SIGPIPE:
+		return "PIPE"
+	case syscall.SIGQUIT:
+		return "QUIT"
+	case syscall.SIGSEGV:
+		return "SEGV"
+	case syscall.SIGTERM:
+		return "TERM"
+	case syscall.SIGUSR1:
+		return "USR1"
+	case syscall.SIGUSR2:
+		return "USR2"
+	}
+	return "KILL"
+}
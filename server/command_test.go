@@ -0,0 +1,55 @@
+package server
+
+import (
+	"bufio"
+	"testing"
+	"time"
+
+	"github.com/samuelngs/universe/pkg/bus"
+)
+
+func TestHangupIgnored(t *testing.T) {
+	prev := hangupTimeout
+	hangupTimeout = 100 * time.Millisecond
+	defer func() { hangupTimeout = prev }()
+	s, addr := testServer(t)
+	logs := s.bus.Subscribe(bus.Topics(TraceDisconnect))
+	defer logs.Unsubscribe()
+	conn, err := testDial(t, addr, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name    string
+		pty     bool
+		command string
+	}{
+		{"ignored", false, "trap '' HUP; echo ready; sleep 60"},
+		{"ignored on a pty", true, "trap '' HUP; echo ready; sleep 60"},
+		// a process of its own session keeps the output open
+		{"escaped", false, "setsid sleep 5 & echo ready; trap '' HUP; sleep 60"},
+	} {
+		session, err := conn.NewSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.pty {
+			if err := session.RequestPty("xterm", 24, 80, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		stdout, _ := session.StdoutPipe()
+		if err := session.Start(c.command); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bufio.NewReader(stdout).ReadString('\n'); err != nil {
+			t.Fatal(err)
+		}
+		session.Close()
+		select {
+		case <-logs.C():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: session not closed", c.name)
+		}
+	}
+}
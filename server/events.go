@@ -9,8 +9,19 @@ const (
 	EventServerStarted        = "server-started"
 	EventServerStopped        = "server-stopped"
 	EventReceiveSignal        = "receive-signal"
+	EventServerReload         = "server-reload"
 )
 
+// EventTopics lists every event topic
+var EventTopics = []string{
+	EventServerStart,
+	EventServerStop,
+	EventServerStarted,
+	EventServerStopped,
+	EventReceiveSignal,
+	EventServerReload,
+}
+
 // Event interface for secure shell server
 type Event interface {
 	Topic() string
@@ -6,5 +6,12 @@ const namespace string = "server"
 
 // Error messages
 var (
-	ErrUnauthentized = errors.Unauthorized(namespace, "authorization has been refused")
+	ErrUnauthentized      = errors.Unauthorized(namespace, "authorization has been refused")
+	ErrConnectionNotFound = errors.NotFound(namespace, "connection not found")
+	ErrSessionNotFound    = errors.NotFound(namespace, "session not found")
+	ErrBanNotFound        = errors.NotFound(namespace, "ban not found")
+	ErrNoHostKey          = errors.BadRequest(namespace, "no host key supports the host key algorithms")
+	ErrAccessDenied       = errors.Forbidden(namespace, "access denied")
+	ErrBanned             = errors.Forbidden(namespace, "too many authentication failures, try again later")
+	ErrInvalidThrottle    = errors.BadRequest(namespace, "invalid throttle").Info("limits and durations must not be negative")
 )
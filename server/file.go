@@ -0,0 +1,535 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/samuelngs/universe/errors"
+	"github.com/samuelngs/universe/pkg/crypto"
+
+	"gopkg.in/yaml.v2"
+)
+
+// interval between configuration file modification checks
+const watchInterval = 2 * time.Second
+
+// File is the configuration file, the format is chosen by the extension:
+// .yaml or .yml, .toml and .json. Settings missing from the file keep the
+// value the options had before the file was first applied, also on reload.
+// A new listen_addr only takes effect when the server is
+// started again, the same goes for listeners and audit_log.
+type File struct {
+	ServerID               *string           `json:"server_id" yaml:"server_id" toml:"server_id"`
+	ClientAuth             *bool             `json:"client_auth" yaml:"client_auth" toml:"client_auth"`
+	PasswordAuthentication *bool             `json:"password_authentication" yaml:"password_authentication" toml:"password_authentication"`
+	RSAAuthentication      *bool             `json:"rsa_authentication" yaml:"rsa_authentication" toml:"rsa_authentication"`
+	ListenAddr             *string           `json:"listen_addr" yaml:"listen_addr" toml:"listen_addr"`
+	Listeners              []FileListener    `json:"listeners" yaml:"listeners" toml:"listeners"`
+	Logs                   []FileLogSink     `json:"logs" yaml:"logs" toml:"logs"`
+	Redact                 []string          `json:"redact" yaml:"redact" toml:"redact"`
+	Protocol               *int              `json:"protocol" yaml:"protocol" toml:"protocol"`
+	HostKeys               []string          `json:"host_keys" yaml:"host_keys" toml:"host_keys"`
+	Metadata               map[string]string `json:"metadata" yaml:"metadata" toml:"metadata"`
+	GracePeriod            *string           `json:"grace_period" yaml:"grace_period" toml:"grace_period"`
+	ShutdownMessage        *string           `json:"shutdown_message" yaml:"shutdown_message" toml:"shutdown_message"`
+	SocketActivation       *bool             `json:"socket_activation" yaml:"socket_activation" toml:"socket_activation"`
+	AuditLog               *string           `json:"audit_log" yaml:"audit_log" toml:"audit_log"`
+	MaxAuthTries           *int              `json:"max_auth_tries" yaml:"max_auth_tries" toml:"max_auth_tries"`
+	Throttle               *FileThrottle     `json:"throttle" yaml:"throttle" toml:"throttle"`
+	Access                 *FileAccess       `json:"access" yaml:"access" toml:"access"`
+	Limits                 *FileLimits       `json:"limits" yaml:"limits" toml:"limits"`
+	Algorithms             *FileAlgorithms   `json:"algorithms" yaml:"algorithms" toml:"algorithms"`
+	Banner                 *string           `json:"banner" yaml:"banner" toml:"banner"`
+	MOTD                   *string           `json:"motd" yaml:"motd" toml:"motd"`
+	Groups                 []FileGroup       `json:"groups" yaml:"groups" toml:"groups"`
+
+	keys      []*crypto.PrivateKey
+	grace     time.Duration
+	listeners []Listener
+	sinks     []LogSink
+	redact    []*regexp.Regexp
+	access    *Access
+	groups    []Group
+	algos     Algorithms
+	startups  Startups
+	handshake time.Duration
+}
+
+// FileListener is a listener in the configuration file
+type FileListener struct {
+	// <addr>:<port> or unix:<path>
+	Addr string `json:"addr" yaml:"addr" toml:"addr"`
+	// Name matched against the systemd socket names
+	Name string `json:"name" yaml:"name" toml:"name"`
+	// Authentication methods: password, publickey, keyboard-interactive
+	Auth   []string `json:"auth" yaml:"auth" toml:"auth"`
+	Banner string   `json:"banner" yaml:"banner" toml:"banner"`
+	MOTD   string   `json:"motd" yaml:"motd" toml:"motd"`
+	// Proxies trusted to send a PROXY protocol header
+	TrustedProxies []string `json:"trusted_proxies" yaml:"trusted_proxies" toml:"trusted_proxies"`
+}
+
+// FileLogSink is a log sink in the configuration file
+type FileLogSink struct {
+	// file, syslog or stderr
+	Type string `json:"type" yaml:"type" toml:"type"`
+	// File path, or syslog socket path
+	Path       string `json:"path" yaml:"path" toml:"path"`
+	MaxBytes   int64  `json:"max_bytes" yaml:"max_bytes" toml:"max_bytes"`
+	MaxBackups int    `json:"max_backups" yaml:"max_backups" toml:"max_backups"`
+	// Topics written to the sink, every topic when empty
+	Topics []string `json:"topics" yaml:"topics" toml:"topics"`
+	// Lowest level: debug, info, warn or error
+	Level string `json:"level" yaml:"level" toml:"level"`
+}
+
+// FileThrottle is the throttle of failed authentication attempts in the
+// configuration file, durations use the time.ParseDuration format. Settings
+// missing from the file keep the value set before the file.
+type FileThrottle struct {
+	MaxFailures *int    `json:"max_failures" yaml:"max_failures" toml:"max_failures"`
+	BanUsers    *bool   `json:"ban_users" yaml:"ban_users" toml:"ban_users"`
+	BanDuration *string `json:"ban_duration" yaml:"ban_duration" toml:"ban_duration"`
+	Backoff     *string `json:"backoff" yaml:"backoff" toml:"backoff"`
+	MaxBackoff  *string `json:"max_backoff" yaml:"max_backoff" toml:"max_backoff"`
+	Window      *string `json:"window" yaml:"window" toml:"window"`
+}
+
+// FileAccess is the network access control in the configuration file, the
+// group files are read again whenever the file is reloaded
+type FileAccess struct {
+	Allow  []string            `json:"allow" yaml:"allow" toml:"allow"`
+	Deny   []string            `json:"deny" yaml:"deny" toml:"deny"`
+	Users  map[string][]string `json:"users" yaml:"users" toml:"users"`
+	Groups map[string]string   `json:"groups" yaml:"groups" toml:"groups"`
+}
+
+// FileAlgorithms is the algorithms offered to clients in the configuration
+// file, the lists set override the ones of the preset and the lists left
+// out keep the x/crypto defaults
+type FileAlgorithms struct {
+	// modern, fips or compatibility
+	Preset       string   `json:"preset" yaml:"preset" toml:"preset"`
+	Ciphers      []string `json:"ciphers" yaml:"ciphers" toml:"ciphers"`
+	KeyExchanges []string `json:"key_exchanges" yaml:"key_exchanges" toml:"key_exchanges"`
+	MACs         []string `json:"macs" yaml:"macs" toml:"macs"`
+	HostKeys     []string `json:"host_keys" yaml:"host_keys" toml:"host_keys"`
+}
+
+// FileGroup is a group of users in the configuration file
+type FileGroup struct {
+	Name   string   `json:"name" yaml:"name" toml:"name"`
+	Users  []string `json:"users" yaml:"users" toml:"users"`
+	Banner string   `json:"banner" yaml:"banner" toml:"banner"`
+	MOTD   string   `json:"motd" yaml:"motd" toml:"motd"`
+}
+
+// FileLimits is the limits of the connections and sessions in the
+// configuration file, max_startups is start:rate:full. Settings missing
+// from the file keep their current value.
+type FileLimits struct {
+	MaxConnections      *int    `json:"max_connections" yaml:"max_connections" toml:"max_connections"`
+	MaxConnectionsPerIP *int    `json:"max_connections_per_ip" yaml:"max_connections_per_ip" toml:"max_connections_per_ip"`
+	MaxStartups         *string `json:"max_startups" yaml:"max_startups" toml:"max_startups"`
+	MaxSessions         *int    `json:"max_sessions" yaml:"max_sessions" toml:"max_sessions"`
+	MaxPTYsPerUser      *int    `json:"max_ptys_per_user" yaml:"max_ptys_per_user" toml:"max_ptys_per_user"`
+	HandshakeTimeout    *string `json:"handshake_timeout" yaml:"handshake_timeout" toml:"handshake_timeout"`
+}
+
+// ReadFile reads and validates the configuration file
+func ReadFile(path string) (*File, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := new(File)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(b, f)
+	case ".toml":
+		var md toml.MetaData
+		md, err = toml.Decode(string(b), f)
+		if keys := md.Undecoded(); err == nil && len(keys) > 0 {
+			err = fmt.Errorf("unknown field %q", keys[0].String())
+		}
+	case ".json":
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.DisallowUnknownFields()
+		err = d.Decode(f)
+	default:
+		return nil, errors.BadRequest(namespace, "unsupported configuration file format").Info(path)
+	}
+	if err != nil {
+		return nil, errors.BadRequest(namespace, "invalid configuration file").Info(err)
+	}
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// validate checks every setting and loads the host keys so a bad file is
+// rejected as a whole
+func (v *File) validate() error {
+	invalid := func(key string, s interface{}) error {
+		return errors.BadRequest(namespace, fmt.Sprintf("invalid %s", key)).Info(s)
+	}
+	if v.ServerID != nil && *v.ServerID == "" {
+		return invalid("server_id", "must not be empty")
+	}
+	if v.ListenAddr != nil {
+		if _, _, err := net.SplitHostPort(*v.ListenAddr); err != nil {
+			return invalid("listen_addr", err)
+		}
+	}
+	for _, fl := range v.Listeners {
+		opts := []ListenerOption{ListenerName(fl.Name), ListenerBanner(fl.Banner), ListenerMOTD(fl.MOTD), ListenerProxyProtocol(fl.TrustedProxies...)}
+		for _, s := range fl.Auth {
+			t, err := ParseAuthenticationType(s)
+			if err != nil {
+				return invalid("listeners", err)
+			}
+			opts = append(opts, ListenerAuth(t))
+		}
+		l := NewListener(fl.Addr, opts...)
+		if err := l.validate(); err != nil {
+			return invalid("listeners", err)
+		}
+		v.listeners = append(v.listeners, l)
+	}
+	for _, fs := range v.Logs {
+		level, err := ParseLevel(fs.Level)
+		if err != nil {
+			return invalid("logs", err)
+		}
+		ls := LogSink{
+			Type:       fs.Type,
+			Path:       fs.Path,
+			MaxBytes:   fs.MaxBytes,
+			MaxBackups: fs.MaxBackups,
+			Topics:     fs.Topics,
+			Level:      level,
+		}
+		if err := ls.validate(); err != nil {
+			return invalid("logs", err)
+		}
+		v.sinks = append(v.sinks, ls)
+	}
+	for _, p := range v.Redact {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return invalid("redact", err)
+		}
+		v.redact = append(v.redact, re)
+	}
+	if v.Protocol != nil && *v.Protocol != 2 {
+		return invalid("protocol", *v.Protocol)
+	}
+	for _, path := range v.HostKeys {
+		k, err := crypto.Import(path)
+		if err != nil {
+			return invalid("host_keys", fmt.Sprintf("%s: %v", path, err))
+		}
+		v.keys = append(v.keys, k)
+	}
+	if v.GracePeriod != nil {
+		d, err := time.ParseDuration(*v.GracePeriod)
+		if err != nil || d < 0 {
+			return invalid("grace_period", *v.GracePeriod)
+		}
+		v.grace = d
+	}
+	if v.Throttle != nil {
+		if v.Throttle.MaxFailures != nil && *v.Throttle.MaxFailures < 0 {
+			return invalid("throttle", "max_failures must not be negative")
+		}
+		for key, s := range map[string]*string{
+			"ban_duration": v.Throttle.BanDuration,
+			"backoff":      v.Throttle.Backoff,
+			"max_backoff":  v.Throttle.MaxBackoff,
+			"window":       v.Throttle.Window,
+		} {
+			if s == nil {
+				continue
+			}
+			if d, err := time.ParseDuration(*s); err != nil || d < 0 {
+				return invalid("throttle", fmt.Sprintf("%s: %s", key, *s))
+			}
+		}
+	}
+	if fa := v.Algorithms; fa != nil {
+		if fa.Preset != "" {
+			a, err := Preset(fa.Preset)
+			if err != nil {
+				return invalid("algorithms", err)
+			}
+			v.algos = a
+		}
+		if fa.Ciphers != nil {
+			v.algos.Ciphers = fa.Ciphers
+		}
+		if fa.KeyExchanges != nil {
+			v.algos.KeyExchanges = fa.KeyExchanges
+		}
+		if fa.MACs != nil {
+			v.algos.MACs = fa.MACs
+		}
+		if fa.HostKeys != nil {
+			v.algos.HostKeys = fa.HostKeys
+		}
+		if err := v.algos.validate(); err != nil {
+			return invalid("algorithms", err)
+		}
+	}
+	for key, s := range map[string]*string{"banner": v.Banner, "motd": v.MOTD} {
+		if s == nil {
+			continue
+		}
+		if err := validateTemplates(*s); err != nil {
+			return invalid(key, err)
+		}
+	}
+	for _, fg := range v.Groups {
+		g := Group{Name: fg.Name, Users: fg.Users, Banner: fg.Banner, MOTD: fg.MOTD}
+		if err := g.validate(); err != nil {
+			return invalid("groups", err)
+		}
+		v.groups = append(v.groups, g)
+	}
+	if v.Limits != nil {
+		for key, n := range map[string]*int{
+			"max_connections":        v.Limits.MaxConnections,
+			"max_connections_per_ip": v.Limits.MaxConnectionsPerIP,
+			"max_sessions":           v.Limits.MaxSessions,
+			"max_ptys_per_user":      v.Limits.MaxPTYsPerUser,
+		} {
+			if n != nil && *n < 0 {
+				return invalid("limits", fmt.Sprintf("%s must not be negative", key))
+			}
+		}
+		if v.Limits.MaxStartups != nil {
+			s, err := ParseStartups(*v.Limits.MaxStartups)
+			if err != nil {
+				return invalid("limits", err)
+			}
+			v.startups = s
+		}
+		if v.Limits.HandshakeTimeout != nil {
+			d, err := time.ParseDuration(*v.Limits.HandshakeTimeout)
+			if err != nil || d < 0 {
+				return invalid("limits", fmt.Sprintf("handshake_timeout: %s", *v.Limits.HandshakeTimeout))
+			}
+			v.handshake = d
+		}
+	}
+	if v.Access != nil {
+		a, err := NewAccess(Rules{
+			Allow:  v.Access.Allow,
+			Deny:   v.Access.Deny,
+			Users:  v.Access.Users,
+			Groups: v.Access.Groups,
+		})
+		if err != nil {
+			return invalid("access", err)
+		}
+		v.access = a
+	}
+	return nil
+}
+
+// merge returns the throttle with the settings present in the file
+func (v *FileThrottle) merge(t Throttle) Throttle {
+	duration := func(s *string, d time.Duration) time.Duration {
+		if s == nil {
+			return d
+		}
+		r, _ := time.ParseDuration(*s)
+		return r
+	}
+	if v.MaxFailures != nil {
+		t.MaxFailures = *v.MaxFailures
+	}
+	if v.BanUsers != nil {
+		t.BanUsers = *v.BanUsers
+	}
+	t.BanDuration = duration(v.BanDuration, t.BanDuration)
+	t.Backoff = duration(v.Backoff, t.Backoff)
+	t.MaxBackoff = duration(v.MaxBackoff, t.MaxBackoff)
+	t.Window = duration(v.Window, t.Window)
+	return t
+}
+
+// merge copies the limits present in the file, the startups and handshake
+// timeout parsed by validate
+func (v *FileLimits) merge(l *Limits, startups Startups, handshake time.Duration) {
+	if v.MaxConnections != nil {
+		l.MaxConnections = *v.MaxConnections
+	}
+	if v.MaxConnectionsPerIP != nil {
+		l.MaxConnectionsPerIP = *v.MaxConnectionsPerIP
+	}
+	if v.MaxStartups != nil {
+		l.MaxStartups = startups
+	}
+	if v.MaxSessions != nil {
+		l.MaxSessions = *v.MaxSessions
+	}
+	if v.MaxPTYsPerUser != nil {
+		l.MaxPTYsPerUser = *v.MaxPTYsPerUser
+	}
+	if v.HandshakeTimeout != nil {
+		l.HandshakeTimeout = handshake
+	}
+}
+
+// apply copies the settings present in the file into the options as a
+// single change
+func (v *File) apply(o *Options) {
+	o.Update(v.option)
+}
+
+// reload applies the file on top of the options it was first applied to,
+// as a single change, so the settings removed from the file revert
+func (v *File) reload(o *Options) {
+	o.Update(func(o *Options) { o.reset() }, v.option)
+}
+
+func (v *File) option(o *Options) {
+	if v.ServerID != nil {
+		o.SetServerID(*v.ServerID)
+	}
+	if v.ClientAuth != nil {
+		o.SetClientAuth(*v.ClientAuth)
+	}
+	if v.PasswordAuthentication != nil {
+		o.SetPasswordAuthentication(*v.PasswordAuthentication)
+	}
+	if v.RSAAuthentication != nil {
+		o.SetRSAAuthentication(*v.RSAAuthentication)
+	}
+	if v.ListenAddr != nil {
+		o.SetListenAddr(*v.ListenAddr)
+	}
+	if v.Listeners != nil {
+		o.SetListeners(v.listeners...)
+	}
+	if v.Logs != nil {
+		o.SetLogSinks(v.sinks...)
+	}
+	if v.Redact != nil {
+		o.SetRedactions(v.redact...)
+	}
+	if v.Protocol != nil {
+		o.SetProtocol(*v.Protocol)
+	}
+	if len(v.keys) > 0 {
+		o.SetHostKeys(v.keys...)
+	}
+	if v.Metadata != nil {
+		o.SetMetadata(v.Metadata)
+	}
+	if v.GracePeriod != nil {
+		o.SetGracePeriod(v.grace)
+	}
+	if v.ShutdownMessage != nil {
+		o.SetShutdownMessage(*v.ShutdownMessage)
+	}
+	if v.SocketActivation != nil {
+		o.SetSocketActivation(*v.SocketActivation)
+	}
+	if v.AuditLog != nil {
+		o.SetAuditLog(*v.AuditLog)
+	}
+	if v.MaxAuthTries != nil {
+		o.SetMaxAuthTries(*v.MaxAuthTries)
+	}
+	if v.Access != nil {
+		o.SetAccess(v.access)
+	}
+	if v.Algorithms != nil {
+		o.SetAlgorithms(v.algos)
+	}
+	if v.Banner != nil {
+		o.SetBanner(*v.Banner)
+	}
+	if v.MOTD != nil {
+		o.SetMOTD(*v.MOTD)
+	}
+	if v.Groups != nil {
+		o.SetGroups(v.groups...)
+	}
+	if v.Limits != nil {
+		o.RLock()
+		l := o.Limits
+		o.RUnlock()
+		v.Limits.merge(&l, v.startups, v.handshake)
+		o.SetLimits(l)
+	}
+	if v.Throttle != nil {
+		o.RLock()
+		t := v.Throttle.merge(o.Throttle)
+		o.RUnlock()
+		o.SetThrottle(t)
+	}
+}
+
+// watch reloads the configuration file on SIGHUP or when it is modified,
+// a file that fails to load is reported and the running options are kept
+func (v *server) watch(path string) {
+	defer v.handlers.Done()
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	defer signal.Stop(ch)
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	modified := mtime(path)
+	for {
+		select {
+		case <-v.stopping:
+			return
+		case <-ch:
+		case <-ticker.C:
+			t := mtime(path)
+			if t.Equal(modified) {
+				continue
+			}
+			modified = t
+		}
+		f, err := ReadFile(path)
+		if err != nil {
+			v.log(&trace{
+				topic:   TraceConfig,
+				level:   LevelError,
+				message: fmt.Sprintf("Could not reload %s", path),
+				fields:  Fields{FieldPath: path},
+				err:     err,
+			})
+			continue
+		}
+		f.reload(v.option)
+		v.bus.Publish(&event{
+			topic:   EventServerReload,
+			message: fmt.Sprintf("Reloaded %s", path),
+		})
+	}
+}
+
+// mtime returns the file modification time, zero if it cannot be read
+func mtime(path string) time.Time {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
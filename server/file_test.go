@@ -0,0 +1,54 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/samuelngs/universe/pkg/bus"
+)
+
+func TestReloadRevertsRemovedSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "universe.yaml")
+	write := func(s string, mtime time.Time) {
+		t.Helper()
+		if err := ioutil.WriteFile(path, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("access:\n  deny: [127.0.0.0/8]\nbanner: \"from the file\\n\"\nlimits:\n  max_sessions: 3\n", time.Unix(1000000000, 0))
+	s, addr := testServer(t, Banner("from the flags\n"), ConfigFile(path))
+	reloads := s.bus.Subscribe(bus.Topics(EventServerReload))
+	defer reloads.Unsubscribe()
+	if _, err := testDial(t, addr, "alice"); err == nil {
+		t.Fatal("denied source connected")
+	}
+	if got := s.option.GetBanner(); got != "from the file\n" {
+		t.Fatalf("banner = %q", got)
+	}
+
+	// the deny rule and the banner are removed, the limits edited
+	write("limits:\n  max_connections: 5\n", time.Unix(1100000000, 0))
+	select {
+	case <-reloads.C():
+	case <-time.After(10 * time.Second):
+		t.Fatal("file not reloaded")
+	}
+	if _, err := testDial(t, addr, "alice"); err != nil {
+		t.Fatalf("source still denied: %v", err)
+	}
+	if got := s.option.GetBanner(); got != "from the flags\n" {
+		t.Errorf("banner = %q", got)
+	}
+	if l := s.option.GetLimits(); l.MaxConnections != 5 || l.MaxSessions != 10 {
+		t.Errorf("limits = %+v", l)
+	}
+	if len(s.option.GetHostKeys()) != 1 {
+		t.Errorf("%d host keys", len(s.option.GetHostKeys()))
+	}
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/samuelngs/universe/errors"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Greeting is the data banner and message of the day templates are
+// executed with, such as {{.Hostname}} or {{index .Metadata "region"}}
+type Greeting struct {
+	ServerID   string
+	Hostname   string
+	Metadata   map[string]string
+	User       string
+	RemoteAddr string
+	Listener   string
+	Time       time.Time
+}
+
+// Group of users given their own banner and message of the day
+type Group struct {
+	Name string
+	// Users of the group
+	Users []string
+	// Banner template, the listener or server banner when empty
+	Banner string
+	// Message of the day template, the listener or server one when empty
+	MOTD string
+}
+
+// validate checks the templates of the group
+func (v Group) validate() error {
+	if v.Name == "" {
+		return errors.BadRequest(namespace, "invalid group").Info("name must not be empty")
+	}
+	return validateTemplates(v.Banner, v.MOTD)
+}
+
+// has returns true if the user is in the group
+func (v Group) has(user string) bool {
+	for _, u := range v.Users {
+		if u == user {
+			return true
+		}
+	}
+	return false
+}
+
+// validateTemplates parses the templates
+func validateTemplates(ss ...string) error {
+	for _, s := range ss {
+		if _, err := template.New("").Parse(s); err != nil {
+			return errors.BadRequest(namespace, "invalid template").Info(err)
+		}
+	}
+	return nil
+}
+
+// greeting returns the template data for the user on the listener
+func greeting(s *Snapshot, md ssh.ConnMetadata, l Listener) *Greeting {
+	hostname, _ := os.Hostname()
+	return &Greeting{
+		ServerID:   s.ServerID,
+		Hostname:   hostname,
+		Metadata:   s.Metadata,
+		User:       md.User(),
+		RemoteAddr: md.RemoteAddr().String(),
+		Listener:   l.String(),
+		Time:       time.Now(),
+	}
+}
+
+// pick returns the template of the first group the user is in, otherwise
+// the one of the listener, otherwise the one of the server
+func pick(s *Snapshot, user string, group func(Group) string, listener, server string) string {
+	for _, g := range s.Groups {
+		if t := group(g); t != "" && g.has(user) {
+			return t
+		}
+	}
+	if listener != "" {
+		return listener
+	}
+	return server
+}
+
+// render executes the template, a template that fails is returned as is
+// so a warning is never lost
+func render(text string, g *Greeting) (string, error) {
+	t, err := template.New("").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return text, err
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, g); err != nil {
+		return text, err
+	}
+	return b.String(), nil
+}
+
+// banner returns the banner sent to the user before authentication
+func (v *Configs) banner(md ssh.ConnMetadata, l Listener) string {
+	s := v.opts.Snapshot()
+	text := pick(s, md.User(), func(g Group) string { return g.Banner }, l.Banner, s.Banner)
+	if text == "" {
+		return ""
+	}
+	out, err := render(text, greeting(s, md, l))
+	if err != nil {
+		v.logs(&trace{
+			topic:   TraceConfig,
+			level:   LevelError,
+			message: "Could not render banner",
+			err:     err,
+			fields:  Fields{FieldUser: md.User(), FieldListener: l.String()},
+		})
+	}
+	return out
+}
+
+// motd writes the message of the day to the session channel
+func (v *server) motd(conn *connection, channel ssh.Channel) {
+	s := v.option.Snapshot()
+	text := pick(s, conn.conn.User(), func(g Group) string { return g.MOTD }, conn.listener.MOTD, s.MOTD)
+	if text == "" {
+		return
+	}
+	out, err := render(text, greeting(s, conn.conn, conn.listener))
+	if err != nil {
+		v.log(&trace{
+			topic:   TraceConfig,
+			level:   LevelError,
+			message: "Could not render message of the day",
+			err:     err,
+			fields:  conn.fields(),
+		})
+	}
+	// the client terminal is in raw mode
+	out = strings.Replace(strings.Replace(out, "\r\n", "\n", -1), "\n", "\r\n", -1)
+	if _, err := channel.Write([]byte(out)); err != nil {
+		v.log(&trace{
+			topic:   TraceChannel,
+			level:   LevelDebug,
+			message: "Could not write message of the day",
+			err:     err,
+			fields:  conn.fields(),
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samuelngs/universe/errors"
+)
+
+// Limit names, reported as the reason connections and sessions are refused
+const (
+	LimitConnections      string = "max_connections"
+	LimitConnectionsPerIP        = "max_connections_per_ip"
+	LimitStartups                = "max_startups"
+	LimitSessions                = "max_sessions"
+	LimitPTYsPerUser             = "max_ptys_per_user"
+)
+
+// Startups drops unauthenticated connections early, as MaxStartups does.
+// From Start unauthenticated connections on, new ones are dropped with a
+// probability of Rate percent, rising linearly to every connection at
+// Full. Nothing is dropped when Full is zero.
+type Startups struct {
+	Start int
+	Rate  int
+	Full  int
+}
+
+// ParseStartups reads start:rate:full, a single number drops every
+// connection from that many on
+func ParseStartups(s string) (Startups, error) {
+	parts := strings.Split(s, ":")
+	n := make([]int, 0, len(parts))
+	for _, p := range parts {
+		i, err := strconv.Atoi(p)
+		if err != nil {
+			return Startups{}, errors.BadRequest(namespace, "invalid max startups").Info(s)
+		}
+		n = append(n, i)
+	}
+	var v Startups
+	switch len(n) {
+	case 1:
+		v = Startups{Start: n[0], Rate: 100, Full: n[0]}
+	case 3:
+		v = Startups{Start: n[0], Rate: n[1], Full: n[2]}
+	default:
+		return Startups{}, errors.BadRequest(namespace, "invalid max startups").Info(s)
+	}
+	return v, v.validate()
+}
+
+// String returns start:rate:full
+func (v Startups) String() string {
+	return fmt.Sprintf("%d:%d:%d", v.Start, v.Rate, v.Full)
+}
+
+func (v Startups) validate() error {
+	if v.Start < 0 || v.Full < 0 || v.Rate < 0 || v.Rate > 100 || v.Start > v.Full {
+		return errors.BadRequest(namespace, "invalid max startups").Info(v.String())
+	}
+	return nil
+}
+
+// drop returns true if a new connection is dropped while so many are
+// unauthenticated
+func (v Startups) drop(startups int, r *rand.Rand) bool {
+	switch {
+	case v.Full == 0 || startups < v.Start:
+		return false
+	case startups >= v.Full:
+		return true
+	default:
+		p := v.Rate + (100-v.Rate)*(startups-v.Start)/(v.Full-v.Start)
+		return r.Intn(100) < p
+	}
+}
+
+// Limits of the connections and sessions, zero is unlimited
+type Limits struct {
+	// Connections open at once, authenticated or not
+	MaxConnections int
+	// Connections open at once from a source address
+	MaxConnectionsPerIP int
+	// Early drop of unauthenticated connections
+	MaxStartups Startups
+	// Sessions open at once on a connection
+	MaxSessions int
+	// Sessions open at once by a user, every session is given a pty
+	MaxPTYsPerUser int
+	// Time a connection is given to complete the handshake and
+	// authentication
+	HandshakeTimeout time.Duration
+}
+
+func (v Limits) validate() error {
+	if v.MaxConnections < 0 || v.MaxConnectionsPerIP < 0 || v.MaxSessions < 0 || v.MaxPTYsPerUser < 0 || v.HandshakeTimeout < 0 {
+		return errors.BadRequest(namespace, "invalid limits").Info("limits must not be negative")
+	}
+	return v.MaxStartups.validate()
+}
+
+// slot of an accepted connection
+type slot struct {
+	host    string
+	startup bool
+}
+
+// limiter counts the open connections
+type limiter struct {
+	sync.Mutex
+	conns    int
+	hosts    map[string]int
+	startups int
+	rand     *rand.Rand
+}
+
+func newLimiter() *limiter {
+	return &limiter{
+		hosts: make(map[string]int),
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// acquire takes a slot for the connection, otherwise returns the limit
+// that refused it. Sources other than IP addresses are not limited per
+// address.
+func (v *limiter) acquire(addr net.Addr, l Limits) (*slot, string) {
+	v.Lock()
+	defer v.Unlock()
+	var host string
+	if ip := sourceIP(addr); ip != nil {
+		host = ip.String()
+	}
+	switch {
+	case l.MaxConnections > 0 && v.conns >= l.MaxConnections:
+		return nil, LimitConnections
+	case l.MaxConnectionsPerIP > 0 && host != "" && v.hosts[host] >= l.MaxConnectionsPerIP:
+		return nil, LimitConnectionsPerIP
+	case l.MaxStartups.drop(v.startups, v.rand):
+		return nil, LimitStartups
+	}
+	v.conns++
+	v.startups++
+	if host != "" {
+		v.hosts[host]++
+	}
+	return &slot{host: host, startup: true}, ""
+}
+
+// authenticated no longer counts the connection as a startup
+func (v *limiter) authenticated(s *slot) {
+	v.Lock()
+	defer v.Unlock()
+	if s.startup {
+		s.startup = false
+		v.startups--
+	}
+}
+
+// release frees the slot of a closed connection
+func (v *limiter) release(s *slot) {
+	v.Lock()
+	defer v.Unlock()
+	if s.startup {
+		s.startup = false
+		v.startups--
+	}
+	v.conns--
+	if s.host == "" {
+		return
+	}
+	if v.hosts[s.host]--; v.hosts[s.host] <= 0 {
+		delete(v.hosts, s.host)
+	}
+}
+
+// acquire takes a slot for the connection, refused connections are traced
+// and closed
+func (v *server) acquire(conn net.Conn, l Listener) (*slot, bool) {
+	s, limit := v.limiter.acquire(conn.RemoteAddr(), v.option.GetLimits())
+	if s != nil {
+		return s, true
+	}
+	v.stats.limited.Inc(limit)
+	v.log(&trace{
+		topic:   TraceLimit,
+		level:   LevelWarn,
+		message: fmt.Sprintf("Refused %v, %s reached", conn.RemoteAddr(), limit),
+		fields: Fields{
+			FieldRemoteAddr: conn.RemoteAddr().String(),
+			FieldListener:   l.String(),
+			FieldReason:     limit,
+		},
+	})
+	conn.Close()
+	return nil, false
+}
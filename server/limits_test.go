@@ -0,0 +1,223 @@
+package server
+
+import (
+	"bufio"
+	"math/rand"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseStartups(t *testing.T) {
+	for s, want := range map[string]Startups{
+		"10:30:100": {Start: 10, Rate: 30, Full: 100},
+		"5":         {Start: 5, Rate: 100, Full: 5},
+		"0:0:0":     {},
+	} {
+		if got, err := ParseStartups(s); err != nil || got != want {
+			t.Errorf("%q = %v, %v", s, got, err)
+		}
+	}
+	for _, s := range []string{"", "a", "1:2", "5:101:10", "10:30:5", "-1"} {
+		if _, err := ParseStartups(s); err == nil {
+			t.Errorf("%q accepted", s)
+		}
+	}
+}
+
+func TestStartupsDrop(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	v := Startups{Start: 10, Rate: 30, Full: 100}
+	if v.drop(9, r) || !v.drop(100, r) || (Startups{}).drop(1000, r) {
+		t.Fatal("dropped below start, kept at full or dropped without a limit")
+	}
+	for _, c := range []struct {
+		startups int
+		rate     int
+	}{
+		{10, 30},
+		{55, 65},
+	} {
+		var drops int
+		for i := 0; i < 1000; i++ {
+			if v.drop(c.startups, r) {
+				drops++
+			}
+		}
+		if drops < c.rate*10-70 || drops > c.rate*10+70 {
+			t.Errorf("%d startups: %d of 1000 dropped, want about %d%%", c.startups, drops, c.rate)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	v := newLimiter()
+	l := Limits{MaxConnections: 3, MaxConnectionsPerIP: 2, MaxStartups: Startups{Start: 3, Rate: 100, Full: 3}}
+	a := tcpAddr("192.0.2.1", 40000)
+	s1, _ := v.acquire(a, l)
+	s2, _ := v.acquire(a, l)
+	if _, limit := v.acquire(a, l); limit != LimitConnectionsPerIP {
+		t.Fatalf("limit = %q", limit)
+	}
+	// unix socket peers are not limited per address
+	s3, _ := v.acquire(&net.UnixAddr{Name: "@", Net: "unix"}, l)
+	if _, limit := v.acquire(tcpAddr("192.0.2.2", 40000), l); limit != LimitConnections {
+		t.Fatalf("limit = %q", limit)
+	}
+	l.MaxConnections = 0
+	if _, limit := v.acquire(tcpAddr("192.0.2.2", 40000), l); limit != LimitStartups {
+		t.Fatalf("limit = %q", limit)
+	}
+	v.authenticated(s1)
+	v.authenticated(s1)
+	if v.startups != 2 {
+		t.Fatalf("%d startups", v.startups)
+	}
+	s4, limit := v.acquire(tcpAddr("192.0.2.2", 40000), l)
+	if limit != "" {
+		t.Fatalf("limit = %q after an authentication", limit)
+	}
+	for _, s := range []*slot{s1, s2, s3, s4} {
+		v.release(s)
+	}
+	if v.conns != 0 || v.startups != 0 || len(v.hosts) != 0 {
+		t.Fatalf("%d connections, %d startups, hosts %v left", v.conns, v.startups, v.hosts)
+	}
+}
+
+// banner connects and reads the server version, an error if the server
+// dropped the connection
+func banner(t *testing.T, addr string) (net.Conn, error) {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(c).ReadString('\n')
+	if err == nil && !strings.HasPrefix(line, "SSH-2.0-") {
+		t.Fatalf("banner = %q", line)
+	}
+	return c, err
+}
+
+func TestMaxStartups(t *testing.T) {
+	s, addr := testServer(t, ConnectionLimits(Limits{MaxStartups: Startups{Start: 2, Rate: 100, Full: 2}}))
+	first, err := banner(t, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := banner(t, addr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := banner(t, addr); err == nil {
+		t.Fatal("connection beyond max startups served")
+	}
+	if n := s.stats.limited.Value(LimitStartups); n != 1 {
+		t.Errorf("limited %s = %v", LimitStartups, n)
+	}
+	// a closed startup frees its slot, and authenticated connections no
+	// longer count
+	first.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := testDial(t, addr, "alice"); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("slot of a closed startup not freed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := banner(t, addr); err != nil {
+		t.Fatalf("startup refused next to an authenticated connection: %v", err)
+	}
+	if _, err := banner(t, addr); err == nil {
+		t.Fatal("connection beyond max startups served")
+	}
+}
+
+func TestMaxSessions(t *testing.T) {
+	_, addr := testServer(t, ConnectionLimits(Limits{MaxConnectionsPerIP: 2, MaxSessions: 1}))
+	conn, err := testDial(t, addr, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := conn.OpenChannel("session", nil); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = conn.OpenChannel("session", nil)
+	if e, ok := err.(*ssh.OpenChannelError); !ok || e.Reason != ssh.ResourceShortage || !strings.Contains(e.Message, LimitSessions) {
+		t.Fatalf("second session: %v", err)
+	}
+	if _, err := testDial(t, addr, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := banner(t, addr); err == nil {
+		t.Fatal("third connection from the address served")
+	}
+}
+
+func TestMaxPTYsPerUser(t *testing.T) {
+	s, addr := testServer(t, ConnectionLimits(Limits{MaxPTYsPerUser: 2}))
+	conn, err := testDial(t, addr, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := func() *ssh.Session {
+		t.Helper()
+		session, err := conn.NewSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { session.Close() })
+		return session
+	}
+	var ptys []*ssh.Session
+	for i := 0; i < 2; i++ {
+		p := session()
+		if err := p.RequestPty("xterm", 24, 80, nil); err != nil {
+			t.Fatal(err)
+		}
+		ptys = append(ptys, p)
+	}
+	// commands without a pty are not limited
+	for i := 0; i < 3; i++ {
+		if err := session().Start("sleep 5"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := session().RequestPty("xterm", 24, 80, nil); err == nil {
+		t.Fatal("pty beyond the limit granted")
+	}
+	if err := session().Shell(); err == nil {
+		t.Fatal("shell beyond the limit started")
+	}
+	if n := s.stats.limited.Value(LimitPTYsPerUser); n != 2 {
+		t.Errorf("limited %s = %v", LimitPTYsPerUser, n)
+	}
+	// the limit is per user, and a closed session frees its pty
+	other, err := testDial(t, addr, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := other.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err := p.RequestPty("xterm", 24, 80, nil); err != nil {
+		t.Fatal(err)
+	}
+	ptys[0].Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for session().RequestPty("xterm", 24, 80, nil) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("pty of a closed session not freed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
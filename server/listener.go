@@ -0,0 +1,209 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/samuelngs/universe/errors"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Listener describes an address the server listens on
+type Listener struct {
+	// Name matched against the systemd socket names
+	Name string
+	// Network, tcp, tcp4, tcp6 or unix
+	Network string
+	// Listen <addr>:<port>, or socket path for unix
+	Addr string
+	// Authentication methods allowed on the listener, every method enabled
+	// in the options when empty
+	Auth []AuthenticationType
+	// Banner template sent to clients before authentication, the server
+	// banner when empty
+	Banner string
+	// Message of the day template written to sessions before the shell
+	// starts, the server one when empty
+	MOTD string
+	// Proxies, as CIDRs or addresses, trusted to send a PROXY protocol
+	// header before the handshake. The header is not read when empty.
+	TrustedProxies []string
+}
+
+// ListenerOption func
+type ListenerOption func(*Listener)
+
+// ListenerAuth option
+func ListenerAuth(methods ...AuthenticationType) ListenerOption {
+	return func(l *Listener) {
+		l.Auth = append(l.Auth, methods...)
+	}
+}
+
+// ListenerBanner option
+func ListenerBanner(s string) ListenerOption {
+	return func(l *Listener) {
+		l.Banner = s
+	}
+}
+
+// ListenerMOTD option
+func ListenerMOTD(s string) ListenerOption {
+	return func(l *Listener) {
+		l.MOTD = s
+	}
+}
+
+// ListenerName option
+func ListenerName(s string) ListenerOption {
+	return func(l *Listener) {
+		l.Name = s
+	}
+}
+
+// ListenerProxyProtocol option
+func ListenerProxyProtocol(trusted ...string) ListenerOption {
+	return func(l *Listener) {
+		l.TrustedProxies = append(l.TrustedProxies, trusted...)
+	}
+}
+
+// NewListener parses the address, either <addr>:<port> optionally
+// prefixed by tcp4: or tcp6:, or unix:<path>
+func NewListener(addr string, opts ...ListenerOption) Listener {
+	l := Listener{Network: "tcp", Addr: addr}
+	for _, network := range []string{"tcp4", "tcp6", "tcp", "unix"} {
+		if strings.HasPrefix(addr, network+":") && (network == "unix" || strings.Count(addr, ":") > 1) {
+			l.Network = network
+			l.Addr = strings.TrimPrefix(addr, network+":")
+			break
+		}
+	}
+	for _, opt := range opts {
+		opt(&l)
+	}
+	return l
+}
+
+// String returns the listener address, unix sockets are prefixed by unix:
+func (v Listener) String() string {
+	if v.Network == "tcp" {
+		return v.Addr
+	}
+	return v.Network + ":" + v.Addr
+}
+
+// allows returns true if the authentication method may be used
+func (v Listener) allows(t AuthenticationType) bool {
+	if len(v.Auth) == 0 {
+		return true
+	}
+	for _, a := range v.Auth {
+		if a == t {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks the listener network and address
+func (v Listener) validate() error {
+	switch v.Network {
+	case "tcp", "tcp4", "tcp6":
+		if _, _, err := net.SplitHostPort(v.Addr); err != nil {
+			return errors.BadRequest(namespace, "invalid listen address").Info(err)
+		}
+	case "unix":
+		if v.Addr == "" {
+			return errors.BadRequest(namespace, "invalid listen address").Info("empty socket path")
+		}
+	default:
+		return errors.BadRequest(namespace, "invalid listen network").Info(v.Network)
+	}
+	for _, s := range v.TrustedProxies {
+		if cidr(s) == nil {
+			return errors.BadRequest(namespace, "invalid trusted proxy").Info(s)
+		}
+	}
+	return validateTemplates(v.Banner, v.MOTD)
+}
+
+// trusted returns true if the PROXY protocol header should be read from
+// the address, unix socket peers are trusted whenever proxies are set
+func (v Listener) trusted(addr net.Addr) bool {
+	if len(v.TrustedProxies) == 0 {
+		return false
+	}
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return v.Network == "unix"
+	}
+	for _, s := range v.TrustedProxies {
+		if n := cidr(s); n != nil && n.Contains(tcp.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// cidr parses a network or a single address, nil if invalid
+func cidr(s string) *net.IPNet {
+	if _, n, err := net.ParseCIDR(s); err == nil {
+		return n
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// listen binds the listener, a stale unix socket left by a previous run
+// is removed first
+func (v Listener) listen() (net.Listener, error) {
+	if err := v.validate(); err != nil {
+		return nil, err
+	}
+	if v.Network == "unix" {
+		if fi, err := os.Lstat(v.Addr); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			if c, err := net.Dial("unix", v.Addr); err == nil {
+				c.Close()
+				return nil, errors.BadRequest(namespace, "socket is in use").Info(v.Addr)
+			}
+			os.Remove(v.Addr)
+		}
+	}
+	return net.Listen(v.Network, v.Addr)
+}
+
+// config applies the listener auth methods to the server config
+func (v Listener) config(base *ssh.ServerConfig) *ssh.ServerConfig {
+	conf := *base
+	if !v.allows(AuthenticationPassword) {
+		conf.PasswordCallback = nil
+	}
+	if !v.allows(AuthenticationPublicKey) {
+		conf.PublicKeyCallback = nil
+	}
+	return &conf
+}
+
+// ParseAuthenticationType returns the authentication type by name
+func ParseAuthenticationType(s string) (AuthenticationType, error) {
+	switch s {
+	case "password":
+		return AuthenticationPassword, nil
+	case "rsa", "publickey":
+		return AuthenticationPublicKey, nil
+	case "keyboard-interactive":
+		return AuthenticationKeyboardInteractive, nil
+	default:
+		return 0, errors.BadRequest(namespace, fmt.Sprintf("unknown authentication method %q", s))
+	}
+}
@@ -1,6 +1,13 @@
 package server
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
 
 // Log topics
 const (
@@ -12,20 +19,149 @@ const (
 	TraceChannel                                  = "channel"
 	TraceConnect                                  = "connect"
 	TraceDisconnect                               = "disconnect"
+	TraceConfig                                   = "config"
+	TraceSystemd                                  = "systemd"
+	TraceAudit                                    = "audit"
+	TraceAccess                                   = "access"
+	TraceLimit                                    = "limit"
+)
+
+// TraceTopics lists every trace log topic
+var TraceTopics = []string{
+	TraceAuthentication,
+	TracePasswordAuthentication,
+	TraceRSAAuthentication,
+	TraceKeyboardInteractiveAuthentication,
+	TraceHandshake,
+	TraceChannel,
+	TraceConnect,
+	TraceDisconnect,
+	TraceConfig,
+	TraceSystemd,
+	TraceAudit,
+	TraceAccess,
+	TraceLimit,
+}
+
+// Log fields
+const (
+	FieldUser          string = "user"
+	FieldRemoteAddr           = "remote_addr"
+	FieldLocalAddr            = "local_addr"
+	FieldClientVersion        = "client_version"
+	FieldListener             = "listener"
+	FieldConnectionID         = "connection_id"
+	FieldSessionID            = "session_id"
+	FieldChannelType          = "channel_type"
+	FieldMethod               = "method"
+	FieldFingerprint          = "fingerprint"
+	FieldResult               = "result"
+	FieldReason               = "reason"
+	FieldRule                 = "rule"
+	FieldPath                 = "path"
+	FieldSeq                  = "seq"
+	FieldHash                 = "hash"
+)
+
+// Level of a trace log
+type Level int
+
+// Log levels
+const (
+	LevelDebug Level = iota - 1
+	LevelInfo
+	LevelWarn
+	LevelError
 )
 
+// String returns the level name
+func (v Level) String() string {
+	switch v {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return fmt.Sprintf("level(%d)", int(v))
+	}
+}
+
+// MarshalText encodes the level name
+func (v Level) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// UnmarshalText decodes the level name
+func (v *Level) UnmarshalText(b []byte) error {
+	l, err := ParseLevel(string(b))
+	if err != nil {
+		return err
+	}
+	*v = l
+	return nil
+}
+
+// ParseLevel returns the level by name
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
+// Fields of a trace log
+type Fields map[string]interface{}
+
+// with returns a copy of the fields with the key set
+func (v Fields) with(k string, val interface{}) Fields {
+	f := make(Fields, len(v)+1)
+	for key, val := range v {
+		f[key] = val
+	}
+	f[k] = val
+	return f
+}
+
 // Log interface
 type Log interface {
 	Topic() string
 	Error() error
 	Message() string
 	String() string
+	Level() Level
+	Time() time.Time
+	Fields() Fields
 }
 
 // secure shell trace log
 type trace struct {
 	topic, message string
 	err            error
+	level          Level
+	fields         Fields
+	time           time.Time
+}
+
+// Redacted replaces the secrets scrubbed from trace logs
+const Redacted = "[REDACTED]"
+
+// traceError is an error read back by ParseLog
+type traceError string
+
+func (v traceError) Error() string {
+	return string(v)
 }
 
 // Topic returns trace log topic
@@ -43,27 +179,112 @@ func (v *trace) Message() string {
 	return v.message
 }
 
+// Level returns trace log level
+func (v *trace) Level() Level {
+	return v.level
+}
+
+// Time returns the time the trace log was published
+func (v *trace) Time() time.Time {
+	return v.time
+}
+
+// Fields returns trace log fields
+func (v *trace) Fields() Fields {
+	return v.fields
+}
+
 // String returns trace log object in string format
 func (v *trace) String() string {
 	o := map[string]interface{}{
 		"topic": v.topic,
+		"level": v.level,
+	}
+	if !v.time.IsZero() {
+		o["time"] = v.time
 	}
 	if v.message != "" {
 		o["message"] = v.message
 	}
 	if v.err != nil {
-		o["error"] = v.err
+		o["error"] = v.err.Error()
+	}
+	if len(v.fields) > 0 {
+		o["fields"] = v.fields
 	}
 	b, _ := json.Marshal(o)
 	return string(b[:])
 }
 
+// redact scrubs the patterns from the message, the error and the string
+// fields, the fields are copied as they may be shared between traces
+func (v *trace) redact(res []*regexp.Regexp) {
+	scrub := func(s string) string {
+		for _, re := range res {
+			s = re.ReplaceAllString(s, Redacted)
+		}
+		return s
+	}
+	v.message = scrub(v.message)
+	if v.err != nil {
+		if s := scrub(v.err.Error()); s != v.err.Error() {
+			v.err = traceError(s)
+		}
+	}
+	fields := make(Fields, len(v.fields))
+	for k, val := range v.fields {
+		if s, ok := val.(string); ok {
+			val = scrub(s)
+		}
+		fields[k] = val
+	}
+	v.fields = fields
+}
+
+// text returns the trace log as a single line of text, the fields are
+// sorted by name
+func text(l Log) string {
+	parts := []string{strings.ToUpper(l.Level().String()), "[" + l.Topic() + "]"}
+	if msg := l.Message(); msg != "" {
+		parts = append(parts, msg)
+	}
+	fields := l.Fields()
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%v", k, fields[k]))
+	}
+	if err := l.Error(); err != nil {
+		parts = append(parts, fmt.Sprintf("error=%q", err.Error()))
+	}
+	return strings.Join(parts, " ")
+}
+
 // ParseLog message and return trace object
 func ParseLog(s string) Log {
 	o := new(trace)
-	err := json.Unmarshal([]byte(s), o)
-	if err != nil {
+	var v struct {
+		Topic   string    `json:"topic"`
+		Level   Level     `json:"level"`
+		Time    time.Time `json:"time"`
+		Message string    `json:"message"`
+		Error   string    `json:"error"`
+		Fields  Fields    `json:"fields"`
+	}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
 		o.err = err
+		return o
+	}
+	o.topic = v.Topic
+	o.level = v.Level
+	o.time = v.Time
+	o.message = v.Message
+	o.fields = v.Fields
+	if v.Error != "" {
+		o.err = traceError(v.Error)
 	}
 	return o
 }
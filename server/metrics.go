@@ -0,0 +1,110 @@
+package server
+
+import "github.com/samuelngs/universe/pkg/metrics"
+
+// instruments of the server
+type instruments struct {
+	handshakes        *metrics.Counter
+	handshakeFailures *metrics.Counter
+	handshakeLatency  *metrics.Histogram
+	auths             *metrics.Counter
+	bans              *metrics.Counter
+	limited           *metrics.Counter
+	channels          *metrics.Counter
+	rejected          *metrics.Counter
+	connections       *metrics.Gauge
+	sessions          *metrics.Gauge
+	sessionDuration   *metrics.Histogram
+	requests          *metrics.Counter
+}
+
+func newInstruments(r *metrics.Registry) *instruments {
+	return &instruments{
+		handshakes: r.Counter(
+			"universe_handshakes_total",
+			"Secure shell handshakes attempted.",
+		),
+		handshakeFailures: r.Counter(
+			"universe_handshake_failures_total",
+			"Secure shell handshakes that failed.",
+		),
+		handshakeLatency: r.Histogram(
+			"universe_handshake_duration_seconds",
+			"Time taken by secure shell handshakes, including authentication.",
+			metrics.DefBuckets,
+		),
+		auths: r.Counter(
+			"universe_auth_attempts_total",
+			"Authentication attempts by method and result.",
+			"method", "result",
+		),
+		bans: r.Counter(
+			"universe_auth_bans_total",
+			"Source addresses and users banned after failed authentications, by type.",
+			"type",
+		),
+		limited: r.Counter(
+			"universe_limit_rejections_total",
+			"Connections and sessions refused by the limit reached.",
+			"limit",
+		),
+		channels: r.Counter(
+			"universe_channels_total",
+			"Channels opened by type.",
+			"type",
+		),
+		rejected: r.Counter(
+			"universe_channels_rejected_total",
+			"Channels rejected by type.",
+			"type",
+		),
+		connections: r.Gauge(
+			"universe_connections",
+			"Active secure shell connections.",
+		),
+		sessions: r.Gauge(
+			"universe_sessions",
+			"Active sessions.",
+		),
+		sessionDuration: r.Histogram(
+			"universe_session_duration_seconds",
+			"Time sessions stayed open.",
+			[]float64{1, 5, 15, 60, 300, 900, 1800, 3600, 14400, 86400},
+		),
+		requests: r.Counter(
+			"universe_session_requests_total",
+			"Session requests by type.",
+			"type",
+		),
+	}
+}
+
+// Label values clients choose are kept to these, anything else is counted
+// as other so a client cannot grow the series without bound
+var (
+	channelTypes = allow("session", "direct-tcpip", "forwarded-tcpip", "x11", "auth-agent@openssh.com")
+	requestTypes = allow("pty-req", "x11-req", "env", "shell", "exec", "subsystem", "window-change", "xon-xoff", "signal", "break", "auth-agent-req@openssh.com")
+	authMethods  = allow("none", "password", "publickey", "keyboard-interactive", "hostbased", "gssapi-with-mic")
+)
+
+// labelOther is the label value of values missing from an allow-list
+const labelOther = "other"
+
+// allowed label values
+type allowed map[string]bool
+
+func allow(values ...string) allowed {
+	v := make(allowed, len(values))
+	for _, s := range values {
+		v[s] = true
+	}
+	return v
+}
+
+// label returns the value if allowed, other otherwise
+func (v allowed) label(s string) string {
+	if v[s] {
+		return s
+	}
+	return labelOther
+}
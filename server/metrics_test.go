@@ -0,0 +1,68 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMetricsLabelsBounded(t *testing.T) {
+	s, addr := testServer(t)
+	conn, err := testDial(t, addr, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if _, _, err := conn.OpenChannel(fmt.Sprintf("custom-%d", i), nil); err == nil {
+			t.Fatal("custom channel accepted")
+		}
+	}
+	channel, _, err := conn.OpenChannel("session", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		channel.SendRequest(fmt.Sprintf("custom-%d", i), true, nil)
+	}
+	channel.SendRequest("env", true, nil)
+	channel.Close()
+
+	if n := s.stats.rejected.Value(labelOther); n != 20 {
+		t.Errorf("rejected other = %v", n)
+	}
+	if n := s.stats.requests.Value(labelOther); n != 20 {
+		t.Errorf("requests other = %v", n)
+	}
+	if n := s.stats.requests.Value("env"); n != 1 {
+		t.Errorf("requests env = %v", n)
+	}
+	if n := s.stats.auths.Value("password", "success"); n != 1 {
+		t.Errorf("password successes = %v", n)
+	}
+	var b bytes.Buffer
+	s.Metrics().WriteTo(&b)
+	if strings.Contains(b.String(), "custom-") {
+		t.Errorf("client chosen label exported:\n%s", b.String())
+	}
+}
+
+func TestAllowedLabel(t *testing.T) {
+	for _, c := range []struct {
+		allowed allowed
+		value   string
+		label   string
+	}{
+		{channelTypes, "session", "session"},
+		{channelTypes, "direct-tcpip", "direct-tcpip"},
+		{channelTypes, "anything", labelOther},
+		{requestTypes, "exec", "exec"},
+		{requestTypes, "", labelOther},
+		{authMethods, "publickey", "publickey"},
+		{authMethods, "made-up", labelOther},
+	} {
+		if got := c.allowed.label(c.value); got != c.label {
+			t.Errorf("label(%q) = %q, want %q", c.value, got, c.label)
+		}
+	}
+}
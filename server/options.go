@@ -2,8 +2,12 @@ package server
 
 import (
 	"log"
+	"regexp"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/samuelngs/universe/errors"
 	"github.com/samuelngs/universe/pkg/crypto"
 	"github.com/samuelngs/universe/pkg/uuid"
 )
@@ -11,7 +15,9 @@ import (
 // Option func
 type Option func(*Options)
 
-// Options for Secure Shell
+// Options for Secure Shell, fields are guarded by the embedded lock and
+// every change is published as a new Snapshot. Read settings through the
+// getters or Snapshot.
 type Options struct {
 	sync.RWMutex
 	// Server Id
@@ -23,8 +29,14 @@ type Options struct {
 	PasswordAuthentication bool
 	// Enable rsa key authentication
 	RSAAuthentication bool
-	// Secure Shell server listen addr
+	// Secure Shell server listen addr, used when no listeners are set
 	ListenAddr string
+	// Listeners, each with its own auth methods and banner
+	Listeners []Listener
+	// Sinks the trace logs are written to
+	LogSinks []LogSink
+	// Patterns scrubbed from every trace log
+	Redactions []*regexp.Regexp
 	// Secure Shell protocol version
 	Protocol int
 	// HostKeys
@@ -33,8 +45,49 @@ type Options struct {
 	Metadata map[string]string
 	// Middlewares
 	Middlewares []Handler
-	// change observer
-	observer chan struct{}
+	// Time connected sessions are given to exit when the server stops
+	GracePeriod time.Duration
+	// Message written to connected sessions when the server stops
+	ShutdownMessage string
+	// Configuration file, reloaded on SIGHUP or when modified
+	ConfigFile string
+	// Authentication attempts allowed per connection, zero uses the
+	// default of 6 and a negative number removes the limit
+	MaxAuthTries int
+	// Throttle of failed authentication attempts
+	Throttle Throttle
+	// Network access control, every source is allowed when nil
+	Access *Access
+	// Limits of the connections and sessions
+	Limits Limits
+	// Algorithms offered to clients
+	Algorithms Algorithms
+	// Banner template sent to clients before authentication
+	Banner string
+	// Message of the day template written to sessions before the shell
+	// starts
+	MOTD string
+	// Groups of users given their own banner and message of the day, the
+	// first group of the user setting a template applies
+	Groups []Group
+	// Audit log path, checkpoints are signed with the first host key
+	AuditLog string
+	// Use the sockets passed by systemd instead of the listeners when the
+	// server is socket activated
+	SocketActivation bool
+	// configuration file load error, reported when the server runs
+	fault error
+	// settings before the configuration file was applied, reloads start
+	// from them
+	baseline *Snapshot
+	// current snapshot
+	snapshot atomic.Value
+	// pending changes are committed once the batch is done
+	batch int
+	// change subscribers
+	subscribers map[chan *Diff]struct{}
+	// changes of the middlewares
+	middlewares uint64
 }
 
 // newOptions creates new option
@@ -48,17 +101,33 @@ func newOptions(opts ...Option) *Options {
 		Protocol:               2,
 		HostKeys:               make([]*crypto.PrivateKey, 0),
 		Metadata:               make(map[string]string, 0),
-		observer:               make(chan struct{}),
+		GracePeriod:            30 * time.Second,
+		ShutdownMessage:        "Server is shutting down",
+		SocketActivation:       true,
+		MaxAuthTries:           6,
+		Throttle: Throttle{
+			MaxFailures: 10,
+			BanDuration: 15 * time.Minute,
+			Backoff:     250 * time.Millisecond,
+			MaxBackoff:  5 * time.Second,
+			Window:      15 * time.Minute,
+		},
+		Limits: Limits{
+			MaxStartups:      Startups{Start: 10, Rate: 30, Full: 100},
+			MaxSessions:      10,
+			HandshakeTimeout: 2 * time.Minute,
+		},
+		subscribers: make(map[chan *Diff]struct{}),
 	}
-	for _, opt := range opts {
-		opt(o)
-	}
-	if len(o.HostKeys) == 0 {
-		k, err := crypto.Generate()
-		if err != nil {
-			log.Fatal(err)
+	o.Update(opts...)
+	if len(o.GetHostKeys()) == 0 {
+		for _, typ := range []string{crypto.KeyEd25519, crypto.KeyECDSAP256, crypto.KeyRSA} {
+			k, err := crypto.GenerateKey(typ)
+			if err != nil {
+				log.Fatal(err)
+			}
+			o.AddHostKey(k)
 		}
-		o.AddHostKey(k)
 	}
 	return o
 }
@@ -98,6 +167,38 @@ func ListenAddr(s string) Option {
 	}
 }
 
+// Listen option, addr is <addr>:<port> or unix:<path>
+func Listen(addr string, opts ...ListenerOption) Option {
+	return func(o *Options) {
+		o.AddListener(NewListener(addr, opts...))
+	}
+}
+
+// Logs option
+func Logs(ls ...LogSink) Option {
+	return func(o *Options) {
+		o.AddLogSink(ls...)
+	}
+}
+
+// Redact option, the patterns are scrubbed from every trace log
+func Redact(patterns ...string) Option {
+	return func(o *Options) {
+		res := make([]*regexp.Regexp, 0, len(patterns))
+		for _, p := range patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				o.Lock()
+				o.fault = errors.BadRequest(namespace, "invalid redaction pattern").Info(err)
+				o.Unlock()
+				return
+			}
+			res = append(res, re)
+		}
+		o.AddRedaction(res...)
+	}
+}
+
 // Protocol option
 func Protocol(v int) Option {
 	return func(o *Options) {
@@ -115,130 +216,829 @@ func HostKey(k *crypto.PrivateKey) Option {
 // Metadata option
 func Metadata(m map[string]string) Option {
 	return func(o *Options) {
+		o.AddMetadata(m)
+	}
+}
+
+// GracePeriod option
+func GracePeriod(d time.Duration) Option {
+	return func(o *Options) {
+		o.SetGracePeriod(d)
+	}
+}
+
+// ConfigFile option, the file is applied on top of the options before it
+// and reloaded while the server runs
+func ConfigFile(path string) Option {
+	return func(o *Options) {
+		f, err := ReadFile(path)
+		if err != nil {
+			o.Lock()
+			o.fault = err
+			o.Unlock()
+			return
+		}
 		o.Lock()
-		defer o.Unlock()
-		for k, v := range m {
-			o.Metadata[k] = v
+		if o.baseline == nil {
+			o.baseline = o.settings()
+		}
+		o.Unlock()
+		f.apply(o)
+		o.SetConfigFile(path)
+	}
+}
+
+// SocketActivation option
+func SocketActivation(b bool) Option {
+	return func(o *Options) {
+		o.SetSocketActivation(b)
+	}
+}
+
+// AuditLog option
+func AuditLog(path string) Option {
+	return func(o *Options) {
+		o.SetAuditLog(path)
+	}
+}
+
+// MaxAuthTries option
+func MaxAuthTries(n int) Option {
+	return func(o *Options) {
+		o.SetMaxAuthTries(n)
+	}
+}
+
+// Throttling option
+func Throttling(t Throttle) Option {
+	return func(o *Options) {
+		if err := t.validate(); err != nil {
+			o.Lock()
+			o.fault = err
+			o.Unlock()
+			return
+		}
+		o.SetThrottle(t)
+	}
+}
+
+// AccessControl option
+func AccessControl(r Rules) Option {
+	return func(o *Options) {
+		a, err := NewAccess(r)
+		if err != nil {
+			o.Lock()
+			o.fault = err
+			o.Unlock()
+			return
+		}
+		o.SetAccess(a)
+	}
+}
+
+// ConnectionLimits option
+func ConnectionLimits(l Limits) Option {
+	return func(o *Options) {
+		if err := l.validate(); err != nil {
+			o.Lock()
+			o.fault = err
+			o.Unlock()
+			return
+		}
+		o.SetLimits(l)
+	}
+}
+
+// AlgorithmPreset option, the lists set by later options override the
+// ones of the preset
+func AlgorithmPreset(name string) Option {
+	return func(o *Options) {
+		a, err := Preset(name)
+		if err != nil {
+			o.Lock()
+			o.fault = err
+			o.Unlock()
+			return
 		}
+		o.SetAlgorithms(a)
 	}
 }
 
+// Ciphers option
+func Ciphers(names ...string) Option {
+	return algorithms(func(a *Algorithms) { a.Ciphers = names })
+}
+
+// KeyExchanges option
+func KeyExchanges(names ...string) Option {
+	return algorithms(func(a *Algorithms) { a.KeyExchanges = names })
+}
+
+// MACs option
+func MACs(names ...string) Option {
+	return algorithms(func(a *Algorithms) { a.MACs = names })
+}
+
+// HostKeyAlgorithms option
+func HostKeyAlgorithms(names ...string) Option {
+	return algorithms(func(a *Algorithms) { a.HostKeys = names })
+}
+
+// algorithms returns an option replacing one of the algorithm lists
+func algorithms(f func(*Algorithms)) Option {
+	return func(o *Options) {
+		o.RLock()
+		a := o.Algorithms.clone()
+		o.RUnlock()
+		f(&a)
+		if err := a.validate(); err != nil {
+			o.Lock()
+			o.fault = err
+			o.Unlock()
+			return
+		}
+		o.SetAlgorithms(a)
+	}
+}
+
+// Banner option
+func Banner(s string) Option {
+	return func(o *Options) {
+		if err := validateTemplates(s); err != nil {
+			o.Lock()
+			o.fault = err
+			o.Unlock()
+			return
+		}
+		o.SetBanner(s)
+	}
+}
+
+// MOTD option
+func MOTD(s string) Option {
+	return func(o *Options) {
+		if err := validateTemplates(s); err != nil {
+			o.Lock()
+			o.fault = err
+			o.Unlock()
+			return
+		}
+		o.SetMOTD(s)
+	}
+}
+
+// UserGroup option
+func UserGroup(g Group) Option {
+	return func(o *Options) {
+		if err := g.validate(); err != nil {
+			o.Lock()
+			o.fault = err
+			o.Unlock()
+			return
+		}
+		o.AddGroup(g)
+	}
+}
+
+// ShutdownMessage option
+func ShutdownMessage(s string) Option {
+	return func(o *Options) {
+		o.SetShutdownMessage(s)
+	}
+}
+
+// Update applies the options as a single change, subscribers receive one
+// diff covering all of them
+func (v *Options) Update(opts ...Option) *Options {
+	v.Lock()
+	v.batch++
+	v.Unlock()
+	for _, opt := range opts {
+		opt(v)
+	}
+	v.Lock()
+	defer v.Unlock()
+	v.batch--
+	v.commit()
+	return v
+}
+
 // SetClientAuth to enable or disable client authentication [true => enable]
 func (v *Options) SetClientAuth(enable bool) *Options {
+	v.Lock()
+	defer v.Unlock()
 	v.NoClientAuth = !enable
-	go v.notify()
+	v.commit()
 	return v
 }
 
 // SetPasswordAuthentication to enable or disable password authentication
 func (v *Options) SetPasswordAuthentication(enable bool) *Options {
+	v.Lock()
+	defer v.Unlock()
 	v.PasswordAuthentication = enable
-	go v.notify()
+	v.commit()
 	return v
 }
 
 // SetRSAAuthentication to enable or disable rsa key authentication
 func (v *Options) SetRSAAuthentication(enable bool) *Options {
+	v.Lock()
+	defer v.Unlock()
 	v.RSAAuthentication = enable
-	go v.notify()
+	v.commit()
 	return v
 }
 
-// SetListenAddr to set listen port
+// SetListenAddr to set listen address
 func (v *Options) SetListenAddr(addr string) *Options {
+	v.Lock()
+	defer v.Unlock()
 	if len(addr) > 0 {
 		v.ListenAddr = addr
-		go v.notify()
+		v.commit()
+	}
+	return v
+}
+
+// AddListener to add listeners
+func (v *Options) AddListener(ls ...Listener) *Options {
+	v.Lock()
+	defer v.Unlock()
+	if len(ls) > 0 {
+		v.Listeners = append(v.Listeners, ls...)
+		v.commit()
+	}
+	return v
+}
+
+// SetListeners to replace listeners
+func (v *Options) SetListeners(ls ...Listener) *Options {
+	v.Lock()
+	defer v.Unlock()
+	v.Listeners = append([]Listener(nil), ls...)
+	v.commit()
+	return v
+}
+
+// AddLogSink to add log sinks
+func (v *Options) AddLogSink(ls ...LogSink) *Options {
+	v.Lock()
+	defer v.Unlock()
+	if len(ls) > 0 {
+		v.LogSinks = append(v.LogSinks, ls...)
+		v.commit()
 	}
 	return v
 }
 
-// SetProtocol to set secure shell protocol
+// SetLogSinks to replace log sinks
+func (v *Options) SetLogSinks(ls ...LogSink) *Options {
+	v.Lock()
+	defer v.Unlock()
+	v.LogSinks = append([]LogSink(nil), ls...)
+	v.commit()
+	return v
+}
+
+// AddRedaction to add redaction patterns
+func (v *Options) AddRedaction(res ...*regexp.Regexp) *Options {
+	v.Lock()
+	defer v.Unlock()
+	if len(res) > 0 {
+		v.Redactions = append(v.Redactions, res...)
+		v.commit()
+	}
+	return v
+}
+
+// SetRedactions to replace redaction patterns
+func (v *Options) SetRedactions(res ...*regexp.Regexp) *Options {
+	v.Lock()
+	defer v.Unlock()
+	v.Redactions = append([]*regexp.Regexp(nil), res...)
+	v.commit()
+	return v
+}
+
+// SetProtocol to set protocol version
 func (v *Options) SetProtocol(protocol int) *Options {
+	v.Lock()
+	defer v.Unlock()
 	if protocol > 0 {
 		v.Protocol = protocol
-		go v.notify()
+		v.commit()
 	}
 	return v
 }
 
 // AddHostKey to set host private key
 func (v *Options) AddHostKey(k *crypto.PrivateKey) *Options {
+	v.Lock()
+	defer v.Unlock()
 	v.HostKeys = append(v.HostKeys, k)
-	go v.notify()
+	v.commit()
 	return v
 }
 
+// SetHostKeys to replace host private keys
+func (v *Options) SetHostKeys(keys ...*crypto.PrivateKey) *Options {
+	v.Lock()
+	defer v.Unlock()
+	if len(keys) > 0 {
+		v.HostKeys = append([]*crypto.PrivateKey(nil), keys...)
+		v.commit()
+	}
+	return v
+}
+
+// AddMetadata to add metadata entries
+func (v *Options) AddMetadata(m map[string]string) *Options {
+	v.Lock()
+	defer v.Unlock()
+	for k, s := range m {
+		v.Metadata[k] = s
+	}
+	v.commit()
+	return v
+}
+
+// SetMetadata to replace metadata
+func (v *Options) SetMetadata(m map[string]string) *Options {
+	v.Lock()
+	defer v.Unlock()
+	v.Metadata = make(map[string]string, len(m))
+	for k, s := range m {
+		v.Metadata[k] = s
+	}
+	v.commit()
+	return v
+}
+
+// ReloadHostKeys to import host keys again from the files they were loaded
+// from, generated keys are kept as is
+func (v *Options) ReloadHostKeys() error {
+	v.Lock()
+	defer v.Unlock()
+	keys := make([]*crypto.PrivateKey, 0, len(v.HostKeys))
+	for _, k := range v.HostKeys {
+		if path := k.Path(); path != "" {
+			r, err := crypto.Import(path)
+			if err != nil {
+				return err
+			}
+			k = r
+		}
+		keys = append(keys, k)
+	}
+	v.HostKeys = keys
+	v.commit()
+	return nil
+}
+
 // AddMiddleware to add auth middleware
 func (v *Options) AddMiddleware(fs ...Handler) *Options {
-	for _, f := range fs {
-		v.Middlewares = append(v.Middlewares, f)
-		go v.notify()
+	v.Lock()
+	defer v.Unlock()
+	if len(fs) > 0 {
+		v.Middlewares = append(v.Middlewares, fs...)
+		v.middlewares++
+		v.commit()
 	}
 	return v
 }
 
 // SetServerID to set server reference id
 func (v *Options) SetServerID(s string) *Options {
+	v.Lock()
+	defer v.Unlock()
 	if len(s) > 0 {
 		v.ServerID = s
-		go v.notify()
+		v.commit()
+	}
+	return v
+}
+
+// SetGracePeriod to set shutdown grace period
+func (v *Options) SetGracePeriod(d time.Duration) *Options {
+	v.Lock()
+	defer v.Unlock()
+	if d >= 0 {
+		v.GracePeriod = d
+		v.commit()
+	}
+	return v
+}
+
+// SetShutdownMessage to set message sent to sessions on shutdown
+func (v *Options) SetShutdownMessage(s string) *Options {
+	v.Lock()
+	defer v.Unlock()
+	v.ShutdownMessage = s
+	v.commit()
+	return v
+}
+
+// SetConfigFile to set configuration file path
+func (v *Options) SetConfigFile(path string) *Options {
+	v.Lock()
+	defer v.Unlock()
+	v.ConfigFile = path
+	v.commit()
+	return v
+}
+
+// SetAuditLog to set the audit log path, it takes effect the next time the
+// server is started
+func (v *Options) SetAuditLog(path string) *Options {
+	v.Lock()
+	defer v.Unlock()
+	v.AuditLog = path
+	v.commit()
+	return v
+}
+
+// SetSocketActivation to enable or disable systemd socket activation
+func (v *Options) SetSocketActivation(enable bool) *Options {
+	v.Lock()
+	defer v.Unlock()
+	v.SocketActivation = enable
+	v.commit()
+	return v
+}
+
+// SetMaxAuthTries to set authentication attempts allowed per connection
+func (v *Options) SetMaxAuthTries(n int) *Options {
+	v.Lock()
+	defer v.Unlock()
+	v.MaxAuthTries = n
+	v.commit()
+	return v
+}
+
+// SetThrottle to set the throttle of failed authentication attempts,
+// negative limits or durations are ignored
+func (v *Options) SetThrottle(t Throttle) *Options {
+	v.Lock()
+	defer v.Unlock()
+	if t.validate() == nil {
+		v.Throttle = t
+		v.commit()
+	}
+	return v
+}
+
+// SetAccess to replace the network access control, nil allows every source
+func (v *Options) SetAccess(a *Access) *Options {
+	v.Lock()
+	defer v.Unlock()
+	v.Access = a
+	v.commit()
+	return v
+}
+
+// SetLimits to set the limits of the connections and sessions, invalid
+// limits are ignored
+func (v *Options) SetLimits(l Limits) *Options {
+	v.Lock()
+	defer v.Unlock()
+	if l.validate() == nil {
+		v.Limits = l
+		v.commit()
+	}
+	return v
+}
+
+// SetAlgorithms to set the algorithms offered to clients, algorithms with
+// unknown names are ignored
+func (v *Options) SetAlgorithms(a Algorithms) *Options {
+	v.Lock()
+	defer v.Unlock()
+	if a.validate() == nil {
+		v.Algorithms = a.clone()
+		v.commit()
 	}
 	return v
 }
 
+// SetBanner to set the banner template
+func (v *Options) SetBanner(s string) *Options {
+	v.Lock()
+	defer v.Unlock()
+	v.Banner = s
+	v.commit()
+	return v
+}
+
+// SetMOTD to set the message of the day template
+func (v *Options) SetMOTD(s string) *Options {
+	v.Lock()
+	defer v.Unlock()
+	v.MOTD = s
+	v.commit()
+	return v
+}
+
+// AddGroup to add user groups
+func (v *Options) AddGroup(gs ...Group) *Options {
+	v.Lock()
+	defer v.Unlock()
+	if len(gs) > 0 {
+		v.Groups = append(v.Groups, gs...)
+		v.commit()
+	}
+	return v
+}
+
+// SetGroups to replace user groups
+func (v *Options) SetGroups(gs ...Group) *Options {
+	v.Lock()
+	defer v.Unlock()
+	v.Groups = append([]Group(nil), gs...)
+	v.commit()
+	return v
+}
+
+// Snapshot returns the current options snapshot
+func (v *Options) Snapshot() *Snapshot {
+	return v.snapshot.Load().(*Snapshot)
+}
+
 // GetServerID to return server id
 func (v *Options) GetServerID() string {
-	return v.ServerID
+	return v.Snapshot().ServerID
 }
 
 // GetClientAuth to return client auth settings
 func (v *Options) GetClientAuth() bool {
-	return !v.NoClientAuth
+	return !v.Snapshot().NoClientAuth
 }
 
 // GetPasswordAuthentication to return password authentication setting
 func (v *Options) GetPasswordAuthentication() bool {
-	return v.PasswordAuthentication
+	return v.Snapshot().PasswordAuthentication
 }
 
 // GetRSAAuthentication to return rsa authentication setting
 func (v *Options) GetRSAAuthentication() bool {
-	return v.RSAAuthentication
+	return v.Snapshot().RSAAuthentication
 }
 
 // GetListenAddr to return listen address
 func (v *Options) GetListenAddr() string {
-	return v.ListenAddr
+	return v.Snapshot().ListenAddr
+}
+
+// GetRedactions to return redaction patterns
+func (v *Options) GetRedactions() []*regexp.Regexp {
+	return v.Snapshot().Redactions
+}
+
+// GetLogSinks to return log sinks
+func (v *Options) GetLogSinks() []LogSink {
+	return v.Snapshot().LogSinks
+}
+
+// GetListeners to return listeners, a tcp listener on the listen address
+// when none are set
+func (v *Options) GetListeners() []Listener {
+	s := v.Snapshot()
+	if len(s.Listeners) == 0 {
+		return []Listener{{Network: "tcp", Addr: s.ListenAddr}}
+	}
+	return s.Listeners
 }
 
 // GetProtocol to return protocol version
 func (v *Options) GetProtocol() int {
-	return v.Protocol
+	return v.Snapshot().Protocol
 }
 
 // GetHostKeys to return host private key
 func (v *Options) GetHostKeys() []*crypto.PrivateKey {
-	return v.HostKeys
+	return v.Snapshot().HostKeys
 }
 
 // GetMetadata to return metadata data
 func (v *Options) GetMetadata(k string) string {
-	v.RLock()
-	defer v.RUnlock()
-	return v.Metadata[k]
+	return v.Snapshot().Metadata[k]
+}
+
+// GetMetadataMap to return a copy of every metadata entry
+func (v *Options) GetMetadataMap() map[string]string {
+	metadata := v.Snapshot().Metadata
+	m := make(map[string]string, len(metadata))
+	for k, s := range metadata {
+		m[k] = s
+	}
+	return m
+}
+
+// GetConfigFile to return configuration file path
+func (v *Options) GetConfigFile() string {
+	return v.Snapshot().ConfigFile
+}
+
+// GetAuditLog to return the audit log path
+func (v *Options) GetAuditLog() string {
+	return v.Snapshot().AuditLog
+}
+
+// GetSocketActivation to return systemd socket activation setting
+func (v *Options) GetSocketActivation() bool {
+	return v.Snapshot().SocketActivation
+}
+
+// GetMaxAuthTries to return authentication attempts allowed per connection
+func (v *Options) GetMaxAuthTries() int {
+	return v.Snapshot().MaxAuthTries
+}
+
+// GetThrottle to return the throttle of failed authentication attempts
+func (v *Options) GetThrottle() Throttle {
+	return v.Snapshot().Throttle
+}
+
+// GetAccess to return the network access control
+func (v *Options) GetAccess() *Access {
+	return v.Snapshot().Access
+}
+
+// GetLimits to return the limits of the connections and sessions
+func (v *Options) GetLimits() Limits {
+	return v.Snapshot().Limits
+}
+
+// GetAlgorithms to return the algorithms offered to clients
+func (v *Options) GetAlgorithms() Algorithms {
+	return v.Snapshot().Algorithms
+}
+
+// GetBanner to return the banner template
+func (v *Options) GetBanner() string {
+	return v.Snapshot().Banner
+}
+
+// GetMOTD to return the message of the day template
+func (v *Options) GetMOTD() string {
+	return v.Snapshot().MOTD
+}
+
+// GetGroups to return user groups
+func (v *Options) GetGroups() []Group {
+	return v.Snapshot().Groups
 }
 
 // GetMiddlewares to return middlewares
 func (v *Options) GetMiddlewares() []Handler {
-	return v.Middlewares
+	return v.Snapshot().Middlewares
+}
+
+// GetGracePeriod to return shutdown grace period
+func (v *Options) GetGracePeriod() time.Duration {
+	return v.Snapshot().GracePeriod
+}
+
+// GetShutdownMessage to return shutdown message
+func (v *Options) GetShutdownMessage() string {
+	return v.Snapshot().ShutdownMessage
+}
+
+// Subscribe returns a channel receiving a diff for every change and a func
+// to cancel the subscription. Diffs not yet received are merged, so a slow
+// subscriber never blocks setters and still ends up at the latest
+// snapshot.
+func (v *Options) Subscribe() (<-chan *Diff, func()) {
+	ch := make(chan *Diff, 1)
+	v.Lock()
+	v.subscribers[ch] = struct{}{}
+	v.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			v.Lock()
+			defer v.Unlock()
+			delete(v.subscribers, ch)
+			close(ch)
+		})
+	}
+}
+
+// failure returns the configuration file load error
+func (v *Options) failure() error {
+	v.RLock()
+	defer v.RUnlock()
+	return v.fault
 }
 
-func (v *Options) notify() {
-	v.observer <- struct{}{}
+// commit publishes the fields as a new snapshot, the caller must hold the
+// lock
+func (v *Options) commit() {
+	if v.batch > 0 {
+		return
+	}
+	s := v.settings()
+	prev, _ := v.snapshot.Load().(*Snapshot)
+	if prev == nil {
+		v.snapshot.Store(s)
+		return
+	}
+	d := diff(prev, s)
+	if len(d.Fields) == 0 {
+		return
+	}
+	s.Version = prev.Version + 1
+	v.snapshot.Store(s)
+	for ch := range v.subscribers {
+		select {
+		case ch <- d:
+		default:
+			// only commit sends, so once the pending diff is taken out
+			// the merged one fits
+			select {
+			case pending := <-ch:
+				ch <- merge(pending, d)
+			default:
+				ch <- d
+			}
+		}
+	}
 }
 
-// Changes observer
-func (v *Options) Changes() <-chan struct{} {
-	return v.observer
+// settings returns the fields as an unversioned snapshot, the caller must
+// hold the lock
+func (v *Options) settings() *Snapshot {
+	s := &Snapshot{
+		ServerID:               v.ServerID,
+		NoClientAuth:           v.NoClientAuth,
+		PasswordAuthentication: v.PasswordAuthentication,
+		RSAAuthentication:      v.RSAAuthentication,
+		ListenAddr:             v.ListenAddr,
+		Listeners:              append([]Listener(nil), v.Listeners...),
+		LogSinks:               append([]LogSink(nil), v.LogSinks...),
+		Redactions:             append([]*regexp.Regexp(nil), v.Redactions...),
+		Protocol:               v.Protocol,
+		HostKeys:               append([]*crypto.PrivateKey(nil), v.HostKeys...),
+		Metadata:               make(map[string]string, len(v.Metadata)),
+		Middlewares:            append([]Handler(nil), v.Middlewares...),
+		GracePeriod:            v.GracePeriod,
+		ShutdownMessage:        v.ShutdownMessage,
+		ConfigFile:             v.ConfigFile,
+		SocketActivation:       v.SocketActivation,
+		AuditLog:               v.AuditLog,
+		MaxAuthTries:           v.MaxAuthTries,
+		Throttle:               v.Throttle,
+		Access:                 v.Access,
+		Limits:                 v.Limits,
+		Algorithms:             v.Algorithms,
+		Banner:                 v.Banner,
+		MOTD:                   v.MOTD,
+		Groups:                 append([]Group(nil), v.Groups...),
+		middlewares:            v.middlewares,
+	}
+	for k, m := range v.Metadata {
+		s.Metadata[k] = m
+	}
+	return s
+}
+
+// reset sets the fields back to the baseline taken before the
+// configuration file was applied. A server needs host keys, the current
+// ones are kept when the baseline has none.
+func (v *Options) reset() {
+	v.Lock()
+	defer v.Unlock()
+	b := v.baseline
+	if b == nil {
+		return
+	}
+	v.ServerID = b.ServerID
+	v.NoClientAuth = b.NoClientAuth
+	v.PasswordAuthentication = b.PasswordAuthentication
+	v.RSAAuthentication = b.RSAAuthentication
+	v.ListenAddr = b.ListenAddr
+	v.Listeners = append([]Listener(nil), b.Listeners...)
+	v.LogSinks = append([]LogSink(nil), b.LogSinks...)
+	v.Redactions = append([]*regexp.Regexp(nil), b.Redactions...)
+	v.Protocol = b.Protocol
+	if len(b.HostKeys) > 0 {
+		v.HostKeys = append([]*crypto.PrivateKey(nil), b.HostKeys...)
+	}
+	v.Metadata = make(map[string]string, len(b.Metadata))
+	for k, m := range b.Metadata {
+		v.Metadata[k] = m
+	}
+	v.GracePeriod = b.GracePeriod
+	v.ShutdownMessage = b.ShutdownMessage
+	v.SocketActivation = b.SocketActivation
+	v.AuditLog = b.AuditLog
+	v.MaxAuthTries = b.MaxAuthTries
+	v.Throttle = b.Throttle
+	v.Access = b.Access
+	v.Limits = b.Limits
+	v.Algorithms = b.Algorithms
+	v.Banner = b.Banner
+	v.MOTD = b.MOTD
+	v.Groups = append([]Group(nil), b.Groups...)
+	v.commit()
 }
@@ -0,0 +1,336 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/samuelngs/universe/pkg/uuid"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Connection describes an established secure shell connection
+type Connection struct {
+	// Connection Id
+	ID string
+	// Authenticated user
+	User string
+	// Remote <addr>:<port>
+	RemoteAddr string
+	// Local <addr>:<port>
+	LocalAddr string
+	// Listener the connection was accepted on
+	Listener string
+	// Client version reported during handshake
+	ClientVersion string
+	// Time the connection was established
+	Started time.Time
+	// Bytes received from the client
+	BytesIn int64
+	// Bytes sent to the client
+	BytesOut int64
+	// Sessions opened on the connection
+	Sessions []*Session
+}
+
+// String returns connection object in string format
+func (v *Connection) String() string {
+	sessions := make([]map[string]interface{}, 0, len(v.Sessions))
+	for _, s := range v.Sessions {
+		sessions = append(sessions, s.object())
+	}
+	o := map[string]interface{}{
+		"id":             v.ID,
+		"user":           v.User,
+		"remote_addr":    v.RemoteAddr,
+		"local_addr":     v.LocalAddr,
+		"listener":       v.Listener,
+		"client_version": v.ClientVersion,
+		"started":        v.Started,
+		"bytes_in":       v.BytesIn,
+		"bytes_out":      v.BytesOut,
+		"sessions":       sessions,
+	}
+	b, _ := json.Marshal(o)
+	return string(b[:])
+}
+
+// Session describes a channel opened on a connection
+type Session struct {
+	// Session Id
+	ID string
+	// Session type, the channel type until a shell, exec or subsystem
+	// request is made
+	Type string
+	// Time the channel was opened
+	Started time.Time
+}
+
+// String returns session object in string format
+func (v *Session) String() string {
+	b, _ := json.Marshal(v.object())
+	return string(b[:])
+}
+
+func (v *Session) object() map[string]interface{} {
+	return map[string]interface{}{
+		"id":      v.ID,
+		"type":    v.Type,
+		"started": v.Started,
+	}
+}
+
+// counter counts bytes passing through a connection
+type counter struct {
+	net.Conn
+	in, out int64
+}
+
+func (v *counter) Read(b []byte) (int, error) {
+	n, err := v.Conn.Read(b)
+	atomic.AddInt64(&v.in, int64(n))
+	return n, err
+}
+
+func (v *counter) Write(b []byte) (int, error) {
+	n, err := v.Conn.Write(b)
+	atomic.AddInt64(&v.out, int64(n))
+	return n, err
+}
+
+// registered connection
+type connection struct {
+	id       string
+	conn     *ssh.ServerConn
+	counter  *counter
+	listener Listener
+	started  time.Time
+	sessions map[string]*session
+}
+
+// fields returns the trace log fields identifying the connection
+func (v *connection) fields() Fields {
+	return Fields{
+		FieldConnectionID: v.id,
+		FieldUser:         v.conn.User(),
+		FieldRemoteAddr:   v.conn.RemoteAddr().String(),
+	}
+}
+
+// registered session
+type session struct {
+	id      string
+	typ     string
+	channel ssh.Channel
+	started time.Time
+	// given a pty, counted against MaxPTYsPerUser
+	pty bool
+}
+
+// registry of connections and their sessions
+type registry struct {
+	sync.RWMutex
+	conns    map[string]*connection
+	sessions map[string]*connection
+}
+
+func newRegistry() *registry {
+	return &registry{
+		conns:    make(map[string]*connection),
+		sessions: make(map[string]*connection),
+	}
+}
+
+// add registers a connection
+func (v *registry) add(sshconn *ssh.ServerConn, c *counter, l Listener) *connection {
+	v.Lock()
+	defer v.Unlock()
+	conn := &connection{
+		id:       uuid.MustV4(),
+		conn:     sshconn,
+		counter:  c,
+		listener: l,
+		started:  time.Now(),
+		sessions: make(map[string]*session),
+	}
+	v.conns[conn.id] = conn
+	return conn
+}
+
+// remove unregisters a connection and its sessions
+func (v *registry) remove(conn *connection) {
+	v.Lock()
+	defer v.Unlock()
+	for id := range conn.sessions {
+		delete(v.sessions, id)
+	}
+	delete(v.conns, conn.id)
+}
+
+// exceeded returns the limit another session on the connection would
+// exceed, if any
+func (v *registry) exceeded(conn *connection, l Limits) string {
+	v.RLock()
+	defer v.RUnlock()
+	return v.limit(conn, l)
+}
+
+// limit returns the limit another session would exceed, the caller must
+// hold the lock
+func (v *registry) limit(conn *connection, l Limits) string {
+	if l.MaxSessions > 0 && len(conn.sessions) >= l.MaxSessions {
+		return LimitSessions
+	}
+	return ""
+}
+
+// pty gives the session a pty, false if the user already has as many as
+// the limit allows
+func (v *registry) pty(conn *connection, s *session, l Limits) bool {
+	v.Lock()
+	defer v.Unlock()
+	if s.pty {
+		return true
+	}
+	if l.MaxPTYsPerUser > 0 {
+		var n int
+		for _, c := range v.conns {
+			if c.conn.User() != conn.conn.User() {
+				continue
+			}
+			for _, cs := range c.sessions {
+				if cs.pty {
+					n++
+				}
+			}
+		}
+		if n >= l.MaxPTYsPerUser {
+			return false
+		}
+	}
+	s.pty = true
+	return true
+}
+
+// open registers a session, false if the connection is gone or a limit
+// was reached since the channel was accepted
+func (v *registry) open(conn *connection, typ string, channel ssh.Channel, l Limits) (*session, bool) {
+	v.Lock()
+	defer v.Unlock()
+	if _, ok := v.conns[conn.id]; !ok {
+		return nil, false
+	}
+	if v.limit(conn, l) != "" {
+		return nil, false
+	}
+	s := &session{
+		id:      uuid.MustV4(),
+		typ:     typ,
+		channel: channel,
+		started: time.Now(),
+	}
+	conn.sessions[s.id] = s
+	v.sessions[s.id] = conn
+	return s, true
+}
+
+// close unregisters a session
+func (v *registry) close(conn *connection, s *session) {
+	v.Lock()
+	defer v.Unlock()
+	delete(conn.sessions, s.id)
+	delete(v.sessions, s.id)
+}
+
+// kind updates the session type
+func (v *registry) kind(s *session, typ string) {
+	v.Lock()
+	defer v.Unlock()
+	s.typ = typ
+}
+
+// connection returns the secure shell connection by id
+func (v *registry) connection(id string) (*ssh.ServerConn, bool) {
+	v.RLock()
+	defer v.RUnlock()
+	conn, ok := v.conns[id]
+	if !ok {
+		return nil, false
+	}
+	return conn.conn, true
+}
+
+// session returns the session channel by id
+func (v *registry) session(id string) (ssh.Channel, bool) {
+	v.RLock()
+	defer v.RUnlock()
+	conn, ok := v.sessions[id]
+	if !ok {
+		return nil, false
+	}
+	return conn.sessions[id].channel, true
+}
+
+// channels returns every open session channel
+func (v *registry) channels() []ssh.Channel {
+	v.RLock()
+	defer v.RUnlock()
+	channels := make([]ssh.Channel, 0, len(v.sessions))
+	for _, conn := range v.conns {
+		for _, s := range conn.sessions {
+			channels = append(channels, s.channel)
+		}
+	}
+	return channels
+}
+
+// connections returns every established secure shell connection
+func (v *registry) connections() []*ssh.ServerConn {
+	v.RLock()
+	defer v.RUnlock()
+	conns := make([]*ssh.ServerConn, 0, len(v.conns))
+	for _, conn := range v.conns {
+		conns = append(conns, conn.conn)
+	}
+	return conns
+}
+
+// list returns a snapshot of every connection, oldest first
+func (v *registry) list() []*Connection {
+	v.RLock()
+	defer v.RUnlock()
+	list := make([]*Connection, 0, len(v.conns))
+	for _, conn := range v.conns {
+		c := &Connection{
+			ID:            conn.id,
+			User:          conn.conn.User(),
+			RemoteAddr:    conn.conn.RemoteAddr().String(),
+			LocalAddr:     conn.conn.LocalAddr().String(),
+			Listener:      conn.listener.String(),
+			ClientVersion: string(conn.conn.ClientVersion()),
+			Started:       conn.started,
+			BytesIn:       atomic.LoadInt64(&conn.counter.in),
+			BytesOut:      atomic.LoadInt64(&conn.counter.out),
+			Sessions:      make([]*Session, 0, len(conn.sessions)),
+		}
+		for _, s := range conn.sessions {
+			c.Sessions = append(c.Sessions, &Session{
+				ID:      s.id,
+				Type:    s.typ,
+				Started: s.started,
+			})
+		}
+		sort.Slice(c.Sessions, func(i, j int) bool {
+			return c.Sessions[i].Started.Before(c.Sessions[j].Started)
+		})
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Started.Before(list[j].Started)
+	})
+	return list
+}
@@ -1,162 +1,480 @@
 package server
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"io"
 	"net"
 	"os"
 	"os/exec"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 
-	"github.com/kr/pty"
+	"github.com/samuelngs/universe/pkg/audit"
+	"github.com/samuelngs/universe/pkg/bus"
+	"github.com/samuelngs/universe/pkg/metrics"
+	"github.com/samuelngs/universe/pkg/proxyproto"
+	"github.com/samuelngs/universe/pkg/systemd"
 
 	"golang.org/x/crypto/ssh"
 )
 
+// time a trusted proxy is given to send the PROXY protocol header
+const proxyHeaderTimeout = 10 * time.Second
+
 // Server daemon for Secure Shell
 type Server interface {
 	Use(...Handler)
 	Run() error
-	Stop() error
+	Stop(context.Context) error
 	Started() bool
 	Option() *Options
 	Subscribe() <-chan Event
 	Logging() <-chan Log
+	Bus() bus.Bus
+	Connections() []*Connection
+	Disconnect(string) error
+	Kill(string) error
+	Metrics() *metrics.Registry
+	Audit(string, map[string]string)
+	Bans() []*Ban
+	Unban(string) error
 }
 
 // New create secure shell server
 func New(opts ...Option) Server {
 	ser := new(server)
-	ser.events = make(chan Event)
-	ser.logger = make(chan Log)
+	ser.bus = bus.New()
+	// the compatibility streams buffer from the start so a consumer
+	// subscribing after Run does not miss the first events
+	ser.eventsub = ser.bus.Subscribe(bus.Topics(EventTopics...))
+	ser.logsub = ser.bus.Subscribe(bus.Topics(TraceTopics...))
 	ser.option = newOptions(opts...)
-	ser.config = newConfigs(ser.option)
-	// ser.config = &ssh.ServerConfig{
-	// 	AuthLogCallback: func(md ssh.ConnMetadata, method string, err error) {
-	// 		switch {
-	// 		case err != nil:
-	// 			ser.logger <- &trace{
-	// 				topic:   TraceAuthentication,
-	// 				message: fmt.Sprintf("Reject connection from %s@%s, %s (%s)", md.User(), md.LocalAddr(), md.RemoteAddr(), md.ClientVersion()),
-	// 				err:     err,
-	// 			}
-	// 		default:
-	// 			ser.logger <- &trace{
-	// 				topic:   TraceAuthentication,
-	// 				message: fmt.Sprintf("Accept connection from %s@%s, %s (%s)", md.User(), md.LocalAddr(), md.RemoteAddr(), md.ClientVersion()),
-	// 			}
-	// 		}
-	// 	},
-	// }
+	ser.registry = newRegistry()
+	ser.stopping = make(chan struct{})
+	ser.done = make(chan struct{})
+	ser.metrics = metrics.NewRegistry()
+	ser.stats = newInstruments(ser.metrics)
+	ser.limiter = newLimiter()
+	ser.config = newConfigs(ser.option, ser.stats, ser.log)
 	return ser
 }
 
 // internal server
 type server struct {
-	option  *Options
-	config  *Configs
-	events  chan Event
-	logger  chan Log
-	started bool
+	sync.Mutex
+	option    *Options
+	config    *Configs
+	bus       bus.Bus
+	eventsub  bus.Subscription
+	logsub    bus.Subscription
+	events    chan Event
+	logger    chan Log
+	subscribe sync.Once
+	logging   sync.Once
+	smu       sync.Mutex
+	sinks     []*routed
+	drains    sync.WaitGroup
+	auditor   audit.Log
+	listeners []net.Listener
+	registry  *registry
+	metrics   *metrics.Registry
+	stats     *instruments
+	limiter   *limiter
+	sessions  sync.WaitGroup
+	handlers  sync.WaitGroup
+	started   bool
+	stopping  chan struct{}
+	done      chan struct{}
+	once      sync.Once
+	err       error
 }
 
-func (v *server) observe(listener net.Listener) {
-	v.started = true
+func (v *server) observe(listener net.Listener, l Listener) {
+	defer v.handlers.Done()
+	var delay time.Duration
 	for {
 		tcpconn, err := listener.Accept()
+		var ok bool
 		if err != nil {
+			select {
+			case <-v.stopping:
+				return
+			default:
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// back off on other errors such as running out of file
+			// descriptors instead of spinning
+			switch {
+			case delay == 0:
+				delay = 5 * time.Millisecond
+			case delay < time.Second:
+				delay *= 2
+			}
+			v.log(&trace{
+				topic:   TraceConnect,
+				level:   LevelError,
+				message: fmt.Sprintf("Could not accept connection, retrying in %s", delay),
+				err:     err,
+				fields:  Fields{FieldListener: l.String()},
+			})
+			select {
+			case <-v.stopping:
+				return
+			case <-time.After(delay):
+			}
 			continue
 		}
-		sshconn, chans, reqs, err := ssh.NewServerConn(tcpconn, v.config.conf)
+		delay = 0
+		// the source of proxied connections is only known once the
+		// PROXY protocol header is read
+		var s *slot
+		if !l.trusted(tcpconn.RemoteAddr()) {
+			if !v.allowed(tcpconn, l) {
+				continue
+			}
+			if s, ok = v.acquire(tcpconn, l); !ok {
+				continue
+			}
+		}
+		v.handlers.Add(1)
+		go v.accept(tcpconn, l, s)
+	}
+}
+
+func (v *server) accept(tcpconn net.Conn, l Listener, s *slot) {
+	defer v.handlers.Done()
+	if s == nil {
+		conn, err := proxyproto.NewConn(tcpconn, proxyHeaderTimeout)
 		if err != nil {
-			v.logger <- &trace{
+			v.log(&trace{
 				topic:   TraceHandshake,
-				message: fmt.Sprintf("Failed to handshake %v", tcpconn.RemoteAddr()),
+				level:   LevelWarn,
+				message: fmt.Sprintf("Invalid PROXY protocol header from %v", tcpconn.RemoteAddr()),
 				err:     err,
-			}
-			continue
+				fields: Fields{
+					FieldRemoteAddr: tcpconn.RemoteAddr().String(),
+					FieldListener:   l.String(),
+				},
+			})
+			tcpconn.Close()
+			return
 		}
-		v.logger <- &trace{
-			topic:   TraceConnect,
-			message: fmt.Sprintf("New connection from %s (%s)", sshconn.RemoteAddr(), sshconn.ClientVersion()),
+		tcpconn = conn
+		if !v.allowed(tcpconn, l) {
+			return
 		}
-		go ssh.DiscardRequests(reqs)
-		go v.receiver(chans)
+		var ok bool
+		if s, ok = v.acquire(tcpconn, l); !ok {
+			return
+		}
+	}
+	defer v.limiter.release(s)
+	if b, ok := v.config.throttle.banned(tcpconn.RemoteAddr(), ""); ok {
+		v.log(&trace{
+			topic:   TraceHandshake,
+			level:   LevelDebug,
+			message: fmt.Sprintf("Dropped %v, banned until %s", tcpconn.RemoteAddr(), b.Until.Format(time.RFC3339)),
+			fields: Fields{
+				FieldRemoteAddr: tcpconn.RemoteAddr().String(),
+				FieldListener:   l.String(),
+			},
+		})
+		tcpconn.Close()
+		return
+	}
+	counter := &counter{Conn: tcpconn}
+	start := time.Now()
+	v.stats.handshakes.Inc()
+	if d := v.option.GetLimits().HandshakeTimeout; d > 0 {
+		tcpconn.SetDeadline(start.Add(d))
+	}
+	auth := &authenticator{server: v}
+	sshconn, chans, reqs, err := ssh.NewServerConn(counter, auth.wrap(v.config.listener(l)))
+	v.stats.handshakeLatency.Observe(time.Since(start).Seconds())
+	if err != nil {
+		v.stats.handshakeFailures.Inc()
+		v.log(&trace{
+			topic:   TraceHandshake,
+			level:   LevelWarn,
+			message: fmt.Sprintf("Failed to handshake %v", tcpconn.RemoteAddr()),
+			err:     err,
+			fields: Fields{
+				FieldRemoteAddr: tcpconn.RemoteAddr().String(),
+				FieldListener:   l.String(),
+			},
+		})
+		return
 	}
+	tcpconn.SetDeadline(time.Time{})
+	v.limiter.authenticated(s)
+	conn, ok := v.track(sshconn, counter, l)
+	if !ok {
+		sshconn.Close()
+		return
+	}
+	defer v.registry.remove(conn)
+	v.stats.connections.Inc()
+	defer v.stats.connections.Dec()
+	fields := conn.fields()
+	fields[FieldLocalAddr] = sshconn.LocalAddr().String()
+	fields[FieldClientVersion] = string(sshconn.ClientVersion())
+	fields[FieldListener] = l.String()
+	if sshconn.Permissions != nil {
+		for _, k := range []string{FieldMethod, FieldFingerprint} {
+			if s, ok := sshconn.Permissions.Extensions[k]; ok {
+				fields[k] = s
+			}
+		}
+	}
+	v.log(&trace{
+		topic:   TraceConnect,
+		message: fmt.Sprintf("New connection from %s (%s)", sshconn.RemoteAddr(), sshconn.ClientVersion()),
+		fields:  fields,
+	})
+	go v.globalRequests(conn, reqs)
+	v.receiver(conn, chans)
 }
 
-func (v *server) receiver(chans <-chan ssh.NewChannel) {
+// allowed returns true if the access control lets the source connect,
+// refused connections are closed before the handshake
+func (v *server) allowed(conn net.Conn, l Listener) bool {
+	rule, ok := v.option.GetAccess().Check(conn.RemoteAddr())
+	if ok {
+		return true
+	}
+	v.log(&trace{
+		topic:   TraceAccess,
+		level:   LevelWarn,
+		message: fmt.Sprintf("Refused %v, matched %s", conn.RemoteAddr(), rule),
+		fields: Fields{
+			FieldRemoteAddr: conn.RemoteAddr().String(),
+			FieldListener:   l.String(),
+			FieldRule:       rule,
+		},
+	})
+	conn.Close()
+	return false
+}
+
+// track registers an established connection, false if the server is
+// stopping and the connection should be dropped
+func (v *server) track(sshconn *ssh.ServerConn, c *counter, l Listener) (*connection, bool) {
+	v.Lock()
+	defer v.Unlock()
+	select {
+	case <-v.stopping:
+		return nil, false
+	default:
+	}
+	return v.registry.add(sshconn, c, l), true
+}
+
+func (v *server) receiver(conn *connection, chans <-chan ssh.NewChannel) {
+	var wg sync.WaitGroup
 	for channel := range chans {
-		go v.handle(channel)
+		wg.Add(1)
+		go func(channel ssh.NewChannel) {
+			defer wg.Done()
+			v.handle(conn, channel)
+		}(channel)
 	}
+	wg.Wait()
 }
 
-func (v *server) handle(channel ssh.NewChannel) {
+func (v *server) handle(conn *connection, channel ssh.NewChannel) {
 	if typ := channel.ChannelType(); typ != "session" {
 		s := fmt.Sprintf("Unknown channel type: %s", typ)
 		channel.Reject(ssh.UnknownChannelType, s)
-		v.logger <- &trace{
+		v.stats.rejected.Inc(channelTypes.label(typ))
+		v.recordForwardChannel(conn, channel, false)
+		v.log(&trace{
 			topic:   TraceChannel,
+			level:   LevelWarn,
 			message: s,
-		}
+			fields:  conn.fields().with(FieldChannelType, typ),
+		})
+		return
+	}
+	limits := v.option.GetLimits()
+	if limit := v.registry.exceeded(conn, limits); limit != "" {
+		v.refuse(conn, channel, limit)
 		return
 	}
 	connection, requests, err := channel.Accept()
 	if err != nil {
-		v.logger <- &trace{
+		v.log(&trace{
 			topic:   TraceChannel,
+			level:   LevelError,
 			message: "Could not accept channel",
 			err:     err,
-		}
+			fields:  conn.fields(),
+		})
+		return
 	}
-	go v.process(connection, requests)
-}
-
-func (v *server) process(channel ssh.Channel, reqs <-chan *ssh.Request) {
-	var once sync.Once
-	shell := exec.Command("sh", "-c", "$SHELL")
-	close := func() {
-		channel.Close()
-		shell.Process.Wait()
-		v.logger <- &trace{topic: TraceDisconnect, message: "Session closed"}
+	v.Lock()
+	s, ok := v.registry.open(conn, channel.ChannelType(), connection, limits)
+	if ok {
+		v.sessions.Add(1)
 	}
-	fi, err := pty.Start(shell)
-	if err != nil {
-		v.logger <- &trace{topic: TraceChannel, message: "Pty initialization failure"}
-		close()
+	v.Unlock()
+	if !ok {
+		connection.Close()
 		return
 	}
-	v.logger <- &trace{topic: TraceChannel, message: "Pty initialized"}
-	go func() {
-		io.Copy(channel, fi)
-		once.Do(close)
+	v.stats.channels.Inc(channelTypes.label(channel.ChannelType()))
+	v.stats.sessions.Inc()
+	fields := conn.record()
+	fields[FieldSessionID] = s.id
+	v.Audit(audit.TypeSessionStart, fields)
+	defer func() {
+		fields := conn.record()
+		fields[FieldSessionID] = s.id
+		fields["duration"] = time.Since(s.started).String()
+		v.Audit(audit.TypeSessionEnd, fields)
+		v.registry.close(conn, s)
+		v.stats.sessions.Dec()
+		v.stats.sessionDuration.Observe(time.Since(s.started).Seconds())
+		v.sessions.Done()
 	}()
-	go func() {
-		io.Copy(fi, channel)
-		once.Do(close)
+	v.process(conn, s, connection, requests)
+}
+
+// refuse rejects the channel as the limit is reached
+func (v *server) refuse(conn *connection, channel ssh.NewChannel, limit string) {
+	channel.Reject(ssh.ResourceShortage, fmt.Sprintf("%s reached", limit))
+	v.stats.rejected.Inc(channelTypes.label(channel.ChannelType()))
+	v.stats.limited.Inc(limit)
+	v.log(&trace{
+		topic:   TraceLimit,
+		level:   LevelWarn,
+		message: fmt.Sprintf("Refused %s channel, %s reached", channel.ChannelType(), limit),
+		fields:  conn.fields().with(FieldChannelType, channel.ChannelType()).with(FieldReason, limit),
+	})
+}
+
+// allocate gives the session a pty, refusing the request when the user
+// reached the limit
+func (v *server) allocate(conn *connection, s *session, req *ssh.Request) bool {
+	if v.registry.pty(conn, s, v.option.GetLimits()) {
+		return true
+	}
+	req.Reply(false, nil)
+	v.stats.limited.Inc(LimitPTYsPerUser)
+	v.log(&trace{
+		topic:   TraceLimit,
+		level:   LevelWarn,
+		message: fmt.Sprintf("Refused %s request, %s reached", req.Type, LimitPTYsPerUser),
+		fields:  conn.fields().with(FieldSessionID, s.id).with(FieldReason, LimitPTYsPerUser),
+	})
+	return false
+}
+
+func (v *server) process(conn *connection, s *session, channel ssh.Channel, reqs <-chan *ssh.Request) {
+	fields := conn.fields().with(FieldSessionID, s.id)
+	var (
+		cmd  *command
+		size *Winsize
+	)
+	defer func() {
+		if cmd != nil {
+			// the client closed the channel, hang up the command in
+			// case it is still running
+			cmd.hangup()
+		} else {
+			channel.Close()
+		}
+		v.log(&trace{topic: TraceDisconnect, message: "Session closed", fields: fields})
 	}()
 	for req := range reqs {
+		v.stats.requests.Inc(requestTypes.label(req.Type))
+		switch req.Type {
+		case "shell", "exec", "subsystem":
+			var payload struct{ Command string }
+			ssh.Unmarshal(req.Payload, &payload)
+			fields := conn.record()
+			fields[FieldSessionID] = s.id
+			fields["request"] = req.Type
+			fields["command"] = payload.Command
+			v.Audit(audit.TypeExec, fields)
+		}
 		switch req.Type {
-		case "shell":
-			if len(req.Payload) == 0 {
-				req.Reply(true, nil)
+		case "shell", "exec":
+			if cmd != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			shell := exec.Command("sh", "-c", "$SHELL")
+			if req.Type == "exec" {
+				var payload struct{ Command string }
+				if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+					req.Reply(false, nil)
+					continue
+				}
+				shell = exec.Command("sh", "-c", payload.Command)
+			} else {
+				// an interactive shell is always given a pty
+				if !v.allocate(conn, s, req) {
+					continue
+				}
+				if size == nil {
+					size = &Winsize{Width: 80, Height: 24}
+				}
+				v.motd(conn, channel)
 			}
+			c, err := start(shell, channel, size)
+			if err != nil {
+				v.log(&trace{topic: TraceChannel, level: LevelError, message: "Command initialization failure", err: err, fields: fields})
+				req.Reply(false, nil)
+				continue
+			}
+			cmd = c
+			v.registry.kind(s, req.Type)
+			req.Reply(true, nil)
+			v.log(&trace{topic: TraceChannel, level: LevelDebug, message: fmt.Sprintf("Started %s", req.Type), fields: fields})
 		case "window-change":
+			if len(req.Payload) < 8 {
+				req.Reply(false, nil)
+				continue
+			}
 			w := binary.BigEndian.Uint32(req.Payload)
 			h := binary.BigEndian.Uint32(req.Payload[4:])
-			setWinsize(fi.Fd(), w, h)
+			if size != nil {
+				size.Width, size.Height = uint16(w), uint16(h)
+			}
+			if cmd != nil {
+				cmd.resize(w, h)
+			}
 			req.Reply(true, nil)
-			v.logger <- &trace{topic: TraceChannel, message: "Pty resized"}
+			v.log(&trace{topic: TraceChannel, level: LevelDebug, message: "Pty resized", fields: fields})
 		case "pty-req":
-			l := req.Payload[3]
-			w := binary.BigEndian.Uint32(req.Payload[l+4:])
-			h := binary.BigEndian.Uint32(req.Payload[l+4:][4:])
-			setWinsize(fi.Fd(), w, h)
+			var payload struct {
+				Term          string
+				Width, Height uint32
+				PixelWidth    uint32
+				PixelHeight   uint32
+				Modes         string
+			}
+			if cmd != nil || ssh.Unmarshal(req.Payload, &payload) != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			if !v.allocate(conn, s, req) {
+				continue
+			}
+			size = &Winsize{Width: uint16(payload.Width), Height: uint16(payload.Height)}
 			req.Reply(true, nil)
-			v.logger <- &trace{topic: TraceChannel, message: "Pty request"}
+			v.log(&trace{topic: TraceChannel, level: LevelDebug, message: "Pty request", fields: fields})
+		default:
+			// subsystems such as sftp are not served, refusing them lets
+			// clients fall back or fail instead of waiting
+			req.Reply(false, nil)
 		}
 	}
 }
@@ -165,50 +483,175 @@ func (v *server) Use(fs ...Handler) {
 	v.option.AddMiddleware(fs...)
 }
 
+// Run listens for connections and blocks until the server is stopped,
+// either by a signal or by Stop, and every session has been drained
 func (v *server) Run() error {
-	v.events <- &event{
+	select {
+	case <-v.stopping:
+		<-v.done
+		return v.err
+	default:
+	}
+	if err := v.option.failure(); err != nil {
+		return err
+	}
+	if err := v.route(v.option.GetLogSinks()); err != nil {
+		return err
+	}
+	if err := v.openAudit(); err != nil {
+		v.route(nil)
+		return err
+	}
+	v.bus.Publish(&event{
 		topic:   EventServerStart,
 		message: "Starting server",
+	})
+	listeners, ls, err := v.bind()
+	if err != nil {
+		v.closeAudit()
+		v.route(nil)
+		return err
 	}
-	listener, err := net.Listen("tcp", v.option.ListenAddr)
+	interval, err := systemd.Watchdog()
 	if err != nil {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+		v.closeAudit()
+		v.route(nil)
 		return err
 	}
-	v.events <- &event{
+	addrs := make([]string, 0, len(ls))
+	for _, listener := range listeners {
+		addr := listener.Addr()
+		if addr.Network() == "unix" {
+			addrs = append(addrs, "unix:"+addr.String())
+		} else {
+			addrs = append(addrs, addr.String())
+		}
+	}
+	v.Lock()
+	select {
+	case <-v.stopping:
+		v.Unlock()
+		for _, listener := range listeners {
+			listener.Close()
+		}
+		v.closeAudit()
+		<-v.done
+		return v.err
+	default:
+	}
+	v.listeners = listeners
+	v.started = true
+	v.handlers.Add(len(listeners))
+	if path := v.option.GetConfigFile(); path != "" {
+		v.handlers.Add(1)
+		go v.watch(path)
+	}
+	if interval > 0 {
+		v.handlers.Add(1)
+		go v.watchdog(interval)
+	}
+	diffs, cancel := v.option.Subscribe()
+	v.handlers.Add(1)
+	go v.follow(diffs, cancel)
+	v.Unlock()
+	status := fmt.Sprintf("Listening on %s", strings.Join(addrs, ", "))
+	v.bus.Publish(&event{
 		topic:   EventServerStarted,
-		message: fmt.Sprintf("Listening on %s", listener.Addr().String()),
+		message: status,
+	})
+	v.sdnotify("READY=1", "STATUS="+status)
+	for i, listener := range listeners {
+		go v.observe(listener, ls[i])
 	}
-	defer listener.Close()
-	go v.observe(listener)
 	ch := make(chan os.Signal, 1)
 	signal.Notify(
 		ch,
 		syscall.SIGTERM,
 		syscall.SIGINT,
-		syscall.SIGKILL,
 	)
-	v.events <- &event{
-		topic:   EventReceiveSignal,
-		message: fmt.Sprintf("Received signal %s", <-ch),
+	defer signal.Stop(ch)
+	select {
+	case sig := <-ch:
+		v.bus.Publish(&event{
+			topic:   EventReceiveSignal,
+			message: fmt.Sprintf("Received signal %s", sig),
+		})
+		return v.Stop(context.Background())
+	case <-v.done:
+		return v.err
 	}
-	return v.Stop()
 }
 
-func (v *server) Stop() error {
-	v.events <- &event{
+// Stop stops accepting connections, notifies connected sessions and waits
+// up to the grace period, or until the context is done, for them to exit
+// before closing the remaining connections. It is safe to call Stop from
+// multiple goroutines, every call returns once the server is drained.
+func (v *server) Stop(ctx context.Context) error {
+	v.once.Do(func() {
+		v.err = v.shutdown(ctx)
+		close(v.done)
+	})
+	<-v.done
+	return v.err
+}
+
+func (v *server) shutdown(ctx context.Context) error {
+	v.bus.Publish(&event{
 		topic:   EventServerStop,
 		message: "Stopping server",
+	})
+	v.sdnotify("STOPPING=1", "STATUS=Stopping server")
+	v.Lock()
+	close(v.stopping)
+	for _, listener := range v.listeners {
+		listener.Close()
+	}
+	v.Unlock()
+	if msg := v.option.GetShutdownMessage(); msg != "" {
+		for _, channel := range v.registry.channels() {
+			channel.Write([]byte("\r\n" + msg + "\r\n"))
+		}
+	}
+
+	var err error
+	drained := make(chan struct{})
+	go func() {
+		v.sessions.Wait()
+		close(drained)
+	}()
+	grace := time.NewTimer(v.option.GetGracePeriod())
+	defer grace.Stop()
+	select {
+	case <-drained:
+	case <-grace.C:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	for _, sshconn := range v.registry.connections() {
+		sshconn.Close()
 	}
+	v.handlers.Wait()
+	v.closeAudit()
+
+	v.Lock()
 	v.started = false
-	v.events <- &event{
+	v.Unlock()
+	v.bus.Publish(&event{
 		topic: EventServerStopped,
-	}
-	defer close(v.events)
-	defer close(v.logger)
-	return nil
+	})
+	v.config.close()
+	v.bus.Close()
+	v.drains.Wait()
+	return err
 }
 
 func (v *server) Started() bool {
+	v.Lock()
+	defer v.Unlock()
 	return v.started
 }
 
@@ -216,10 +659,108 @@ func (v *server) Option() *Options {
 	return v.option
 }
 
+// log stamps the trace log and publishes it
+func (v *server) log(t *trace) {
+	t.time = time.Now()
+	if res := v.option.GetRedactions(); len(res) > 0 {
+		t.redact(res)
+	}
+	v.bus.Publish(t)
+}
+
+// Subscribe returns the server events, the channel is shared by every
+// caller and closed once the server is stopped
 func (v *server) Subscribe() <-chan Event {
+	v.subscribe.Do(func() {
+		events := make(chan Event)
+		go func() {
+			defer close(events)
+			for m := range v.eventsub.C() {
+				events <- m.(Event)
+			}
+		}()
+		v.events = events
+	})
 	return v.events
 }
 
+// Logging returns the server trace logs, the channel is shared by every
+// caller and closed once the server is stopped
 func (v *server) Logging() <-chan Log {
+	v.logging.Do(func() {
+		logger := make(chan Log)
+		go func() {
+			defer close(logger)
+			for m := range v.logsub.C() {
+				logger <- m.(Log)
+			}
+		}()
+		v.logger = logger
+	})
 	return v.logger
 }
+
+// Bus returns the bus server events and trace logs are published on
+func (v *server) Bus() bus.Bus {
+	return v.bus
+}
+
+// Connections returns every established connection and its sessions
+func (v *server) Connections() []*Connection {
+	return v.registry.list()
+}
+
+// Disconnect closes the connection by id along with its sessions
+func (v *server) Disconnect(id string) error {
+	sshconn, ok := v.registry.connection(id)
+	if !ok {
+		return ErrConnectionNotFound
+	}
+	v.log(&trace{
+		topic:   TraceDisconnect,
+		message: fmt.Sprintf("Disconnecting %s (%s)", id, sshconn.RemoteAddr()),
+		fields: Fields{
+			FieldConnectionID: id,
+			FieldUser:         sshconn.User(),
+			FieldRemoteAddr:   sshconn.RemoteAddr().String(),
+		},
+	})
+	return sshconn.Close()
+}
+
+// Kill closes the session by id, the connection is left open
+func (v *server) Kill(id string) error {
+	channel, ok := v.registry.session(id)
+	if !ok {
+		return ErrSessionNotFound
+	}
+	v.log(&trace{
+		topic:   TraceChannel,
+		message: fmt.Sprintf("Killing session %s", id),
+		fields:  Fields{FieldSessionID: id},
+	})
+	return channel.Close()
+}
+
+// Bans returns the source addresses and users banned after failed
+// authentications
+func (v *server) Bans() []*Ban {
+	return v.config.throttle.list()
+}
+
+// Unban lifts the ban by id, <type>:<value> such as address:192.0.2.1
+func (v *server) Unban(id string) error {
+	if !v.config.throttle.lift(id) {
+		return ErrBanNotFound
+	}
+	v.log(&trace{
+		topic:   TraceAuthentication,
+		message: fmt.Sprintf("Lifted ban %s", id),
+	})
+	return nil
+}
+
+// Metrics returns the registry the server is instrumented with
+func (v *server) Metrics() *metrics.Registry {
+	return v.metrics
+}
@@ -1,77 +1,165 @@
 package server
 
 import (
+	"fmt"
 	"log"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 )
 
-// DebugHandler logging handler
-type DebugHandler func(md ssh.ConnMetadata, method string, err error)
-
 // Configs struct
 type Configs struct {
-	conf *ssh.ServerConfig
-	opts *Options
-	logs DebugHandler
+	conf     atomic.Value
+	opts     *Options
+	logs     func(*trace)
+	stats    *instruments
+	throttle *throttle
+	cancel   func()
 }
 
-func newConfigs(opts *Options) *Configs {
+func newConfigs(opts *Options, stats *instruments, logs func(*trace)) *Configs {
 	c := new(Configs)
 	c.opts = opts
-	c.conf = &ssh.ServerConfig{
-		PasswordCallback:  c.PasswordCallback,
-		PublicKeyCallback: c.PublicKeyCallback,
-		AuthLogCallback:   c.AuthLogCallback,
+	c.stats = stats
+	c.logs = logs
+	c.throttle = newThrottle()
+	diffs, cancel := opts.Subscribe()
+	c.cancel = cancel
+	conf, err := c.build(opts.Snapshot())
+	if err != nil {
+		log.Fatal(err)
+	}
+	c.conf.Store(conf)
+	go c.sync(diffs)
+	return c
+}
+
+// build creates the secure shell config for the snapshot
+func (v *Configs) build(s *Snapshot) (*ssh.ServerConfig, error) {
+	conf := &ssh.ServerConfig{
+		PasswordCallback:  v.PasswordCallback,
+		PublicKeyCallback: v.PublicKeyCallback,
+		AuthLogCallback:   v.AuthLogCallback,
+		BannerCallback:    v.BannerCallback,
+		MaxAuthTries:      s.MaxAuthTries,
 	}
-	for _, key := range opts.GetHostKeys() {
+	conf.Ciphers = s.Algorithms.Ciphers
+	conf.KeyExchanges = s.Algorithms.KeyExchanges
+	conf.MACs = s.Algorithms.MACs
+	var keys int
+	types := make(map[string]bool)
+	for _, key := range s.HostKeys {
 		signer, err := key.Signer()
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
+		}
+		// one key is offered per type, the first one
+		t := signer.PublicKey().Type()
+		if types[t] {
+			continue
+		}
+		types[t] = true
+		signer, ok, err := s.Algorithms.signer(signer)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			conf.AddHostKey(signer)
+			keys++
 		}
-		c.conf.AddHostKey(signer)
 	}
-	go c.sync(opts)
-	return c
+	if keys == 0 {
+		return nil, ErrNoHostKey
+	}
+	return conf, nil
 }
 
-func (v *Configs) sync(opts *Options) {
-	for {
-		select {
-		case <-opts.Changes():
-			v.conf = &ssh.ServerConfig{
-				PasswordCallback:  v.PasswordCallback,
-				PublicKeyCallback: v.PublicKeyCallback,
-				AuthLogCallback:   v.AuthLogCallback,
-			}
-			for _, key := range opts.GetHostKeys() {
-				signer, err := key.Signer()
-				if err != nil {
-					log.Fatal(err)
-				}
-				v.conf.AddHostKey(signer)
-			}
+// sync rebuilds the secure shell config when host keys, algorithms or the
+// attempt limit change, new
+// connections are served with the new config while established ones keep
+// theirs. A config that cannot be built leaves the previous one in place.
+func (v *Configs) sync(diffs <-chan *Diff) {
+	for d := range diffs {
+		if !d.Changed("HostKeys", "Algorithms", "MaxAuthTries") {
+			continue
 		}
+		if conf, err := v.build(d.To); err == nil {
+			v.conf.Store(conf)
+		}
+	}
+}
+
+// current returns the secure shell config for new connections
+func (v *Configs) current() *ssh.ServerConfig {
+	return v.conf.Load().(*ssh.ServerConfig)
+}
+
+// listener returns the secure shell config for new connections on the
+// listener
+func (v *Configs) listener(l Listener) *ssh.ServerConfig {
+	conf := l.config(v.current())
+	conf.BannerCallback = func(md ssh.ConnMetadata) string {
+		return v.banner(md, l)
 	}
+	return conf
+}
+
+// close stops following option changes
+func (v *Configs) close() {
+	v.cancel()
+}
+
+// admit rejects sources and users refused by the access control or banned,
+// and holds the attempt for the backoff of the previous failures
+func (v *Configs) admit(md ssh.ConnMetadata, s *Snapshot) error {
+	if rule, ok := s.Access.CheckUser(md.RemoteAddr(), md.User()); !ok {
+		v.logs(&trace{
+			topic:   TraceAccess,
+			level:   LevelWarn,
+			message: fmt.Sprintf("Refused %s from %s, matched %s", md.User(), md.RemoteAddr(), rule),
+			fields: Fields{
+				FieldUser:       md.User(),
+				FieldRemoteAddr: md.RemoteAddr().String(),
+				FieldRule:       rule,
+			},
+		})
+		return ErrAccessDenied
+	}
+	if _, ok := v.throttle.banned(md.RemoteAddr(), md.User()); ok {
+		return ErrBanned
+	}
+	if d := v.throttle.delay(md.RemoteAddr(), md.User(), s.Throttle); d > 0 {
+		time.Sleep(d)
+	}
+	return nil
 }
 
 // PasswordCallback func
 func (v *Configs) PasswordCallback(md ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+	s := v.opts.Snapshot()
+	if err := v.admit(md, s); err != nil {
+		return nil, err
+	}
+	perms := &ssh.Permissions{
+		Extensions: map[string]string{FieldMethod: "password"},
+	}
 	switch {
-	case v.opts.NoClientAuth:
-		return nil, nil
-	case v.opts.PasswordAuthentication:
+	case s.NoClientAuth:
+		return perms, nil
+	case s.PasswordAuthentication:
 		c := &Context{
 			typ:   AuthenticationPassword,
 			raddr: md.RemoteAddr(),
 			laddr: md.LocalAddr(),
 		}
-		for _, handler := range v.opts.GetMiddlewares() {
+		for _, handler := range s.Middlewares {
 			if err := handler(c); err != nil {
 				return nil, err
 			}
 		}
-		return nil, nil
+		return perms, nil
 	default:
 		return nil, ErrUnauthentized
 	}
@@ -79,29 +167,70 @@ func (v *Configs) PasswordCallback(md ssh.ConnMetadata, pass []byte) (*ssh.Permi
 
 // PublicKeyCallback func
 func (v *Configs) PublicKeyCallback(md ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	s := v.opts.Snapshot()
+	if err := v.admit(md, s); err != nil {
+		return nil, err
+	}
+	perms := &ssh.Permissions{
+		Extensions: map[string]string{
+			FieldMethod:      "publickey",
+			FieldFingerprint: ssh.FingerprintSHA256(key),
+		},
+	}
 	switch {
-	case v.opts.NoClientAuth:
-		return nil, nil
-	case v.opts.RSAAuthentication:
+	case s.NoClientAuth:
+		return perms, nil
+	case s.RSAAuthentication:
 		c := &Context{
 			typ:   AuthenticationPublicKey,
 			raddr: md.RemoteAddr(),
 			laddr: md.LocalAddr(),
 		}
-		for _, handler := range v.opts.GetMiddlewares() {
+		for _, handler := range s.Middlewares {
 			if err := handler(c); err != nil {
 				return nil, err
 			}
 		}
-		return nil, nil
+		return perms, nil
 	default:
 		return nil, ErrUnauthentized
 	}
 }
 
-// AuthLogCallback func
+// BannerCallback func
+func (v *Configs) BannerCallback(md ssh.ConnMetadata) string {
+	return v.banner(md, Listener{})
+}
+
+// AuthLogCallback counts the attempt against the source address and the
+// user, the none method clients start with and rejections of banned ones
+// are not counted
 func (v *Configs) AuthLogCallback(md ssh.ConnMetadata, method string, err error) {
-	if v.logs != nil {
-		v.logs(md, method, err)
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	v.stats.auths.Inc(authMethods.label(method), result)
+	if ke, ok := err.(*keyError); ok {
+		err = ke.err
+	}
+	switch {
+	case method == "none" || err == ErrBanned:
+	case err == nil:
+		v.throttle.succeed(md.RemoteAddr(), md.User())
+	default:
+		for _, b := range v.throttle.fail(md.RemoteAddr(), md.User(), v.opts.GetThrottle()) {
+			v.stats.bans.Inc(b.Type)
+			v.logs(&trace{
+				topic:   TraceAuthentication,
+				level:   LevelWarn,
+				message: fmt.Sprintf("Banned %s %s until %s after %d failures", b.Type, b.Value, b.Until.Format(time.RFC3339), b.Failures),
+				fields: Fields{
+					FieldUser:       md.User(),
+					FieldRemoteAddr: md.RemoteAddr().String(),
+					FieldMethod:     method,
+				},
+			})
+		}
 	}
 }
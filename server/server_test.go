@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/samuelngs/universe/pkg/crypto"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer starts a server on a loopback port accepting any password and
+// returns it with its address, it is stopped when the test ends
+func testServer(t *testing.T, opts ...Option) (*server, string) {
+	key, err := crypto.GenerateKey(crypto.KeyEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts = append([]Option{ListenAddr("127.0.0.1:0"), PasswordAuthentication(true), HostKey(key)}, opts...)
+	s := New(opts...).(*server)
+	addr := make(chan string, 1)
+	go func() {
+		for e := range s.Subscribe() {
+			if e.Topic() == EventServerStarted {
+				addr <- strings.TrimPrefix(e.Message(), "Listening on ")
+			}
+		}
+	}()
+	go func() {
+		for range s.Logging() {
+		}
+	}()
+	done := make(chan error, 1)
+	go func() { done <- s.Run() }()
+	t.Cleanup(func() {
+		s.Stop(context.Background())
+		<-done
+	})
+	select {
+	case a := <-addr:
+		return s, a
+	case err := <-done:
+		t.Fatal(err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("server did not start")
+	}
+	return nil, ""
+}
+
+// testDial authenticates to the server with a password
+func testDial(t *testing.T, addr, user string) (*ssh.Client, error) {
+	conn, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.Password("test")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         10 * time.Second,
+	})
+	if err == nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+	return conn, err
+}
+
+// failingListener fails to accept with each error in turn
+type failingListener struct {
+	net.Listener
+	errs  []error
+	calls int
+}
+
+func (v *failingListener) Accept() (net.Conn, error) {
+	err := v.errs[v.calls]
+	v.calls++
+	return nil, err
+}
+
+func TestObserveAcceptErrors(t *testing.T) {
+	s, _ := testServer(t)
+	l := &failingListener{errs: []error{
+		syscall.EMFILE,
+		&net.OpError{Op: "accept", Net: "tcp", Err: syscall.ECONNABORTED},
+		&net.OpError{Op: "accept", Net: "tcp", Err: net.ErrClosed},
+	}}
+	done := make(chan struct{})
+	s.handlers.Add(1)
+	go func() {
+		s.observe(l, NewListener("127.0.0.1:0"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("accept loop did not return on a closed listener")
+	}
+	if l.calls != 3 {
+		t.Fatalf("%d accepts, want 3", l.calls)
+	}
+}
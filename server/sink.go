@@ -0,0 +1,336 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/samuelngs/universe/errors"
+	"github.com/samuelngs/universe/pkg/bus"
+)
+
+// messages a sink may fall behind before trace logs are dropped
+const sinkBuffer = 1024
+
+// Sink types
+const (
+	SinkFile   string = "file"
+	SinkSyslog        = "syslog"
+	SinkStderr        = "stderr"
+)
+
+// Sink writes trace logs
+type Sink interface {
+	Write(Log) error
+	Close() error
+}
+
+// LogSink routes the trace logs of some topics to a sink
+type LogSink struct {
+	// Sink type, file, syslog or stderr. Ignored when Sink is set.
+	Type string
+	// File path for the file sink, socket path for the syslog sink, the
+	// local syslog daemon is used when empty
+	Path string
+	// Size in bytes the file is rotated at, never rotated when zero
+	MaxBytes int64
+	// Rotated files kept
+	MaxBackups int
+	// Topics written to the sink, every topic when empty
+	Topics []string
+	// Lowest level written to the sink
+	Level Level
+	// Custom sink, closed once no longer configured or when the server stops
+	Sink Sink
+}
+
+// validate checks the sink type and path
+func (v LogSink) validate() error {
+	if v.Sink != nil {
+		return nil
+	}
+	switch v.Type {
+	case SinkFile:
+		if v.Path == "" {
+			return errors.BadRequest(namespace, "invalid log sink").Info("file sink requires a path")
+		}
+	case SinkSyslog, SinkStderr:
+	default:
+		return errors.BadRequest(namespace, "invalid log sink").Info(fmt.Sprintf("unknown sink type %q", v.Type))
+	}
+	if v.MaxBytes < 0 || v.MaxBackups < 0 {
+		return errors.BadRequest(namespace, "invalid log sink").Info("rotation limits must not be negative")
+	}
+	return nil
+}
+
+// open creates the sink
+func (v LogSink) open() (Sink, error) {
+	if err := v.validate(); err != nil {
+		return nil, err
+	}
+	switch {
+	case v.Sink != nil:
+		return v.Sink, nil
+	case v.Type == SinkFile:
+		return NewFileSink(v.Path, v.MaxBytes, v.MaxBackups)
+	case v.Type == SinkSyslog:
+		return NewSyslogSink(v.Path)
+	default:
+		return NewTextSink(os.Stderr), nil
+	}
+}
+
+// file sink, one JSON object per line
+type fileSink struct {
+	sync.Mutex
+	path     string
+	maxBytes int64
+	backups  int
+	file     *os.File
+	size     int64
+}
+
+// NewFileSink writes trace logs as JSON lines, the file is rotated to
+// <path>.1 once it reaches maxBytes and at most backups rotated files are
+// kept
+func NewFileSink(path string, maxBytes int64, backups int) (Sink, error) {
+	v := &fileSink{path: path, maxBytes: maxBytes, backups: backups}
+	if err := v.open(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (v *fileSink) open() error {
+	f, err := os.OpenFile(v.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	v.file = f
+	v.size = fi.Size()
+	return nil
+}
+
+// rotate shifts the rotated files by one and starts a new file
+func (v *fileSink) rotate() error {
+	if err := v.file.Close(); err != nil {
+		return err
+	}
+	if v.backups == 0 {
+		os.Remove(v.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", v.path, v.backups))
+		for i := v.backups - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", v.path, i), fmt.Sprintf("%s.%d", v.path, i+1))
+		}
+		if err := os.Rename(v.path, v.path+".1"); err != nil {
+			return err
+		}
+	}
+	return v.open()
+}
+
+func (v *fileSink) Write(l Log) error {
+	v.Lock()
+	defer v.Unlock()
+	if v.file == nil {
+		return os.ErrClosed
+	}
+	b := []byte(l.String() + "\n")
+	if v.maxBytes > 0 && v.size > 0 && v.size+int64(len(b)) > v.maxBytes {
+		if err := v.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := v.file.Write(b)
+	v.size += int64(n)
+	return err
+}
+
+func (v *fileSink) Close() error {
+	v.Lock()
+	defer v.Unlock()
+	if v.file == nil {
+		return nil
+	}
+	err := v.file.Close()
+	v.file = nil
+	return err
+}
+
+// syslog sink
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+// NewSyslogSink writes trace logs to the syslog socket at path, or to the
+// local syslog daemon when path is empty
+func NewSyslogSink(path string) (Sink, error) {
+	var w *syslog.Writer
+	var err error
+	if path == "" {
+		w, err = syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, "universe")
+	} else {
+		w, err = syslog.Dial("unixgram", path, syslog.LOG_DAEMON|syslog.LOG_INFO, "universe")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{w}, nil
+}
+
+func (v *syslogSink) Write(l Log) error {
+	s := text(l)
+	switch {
+	case l.Level() >= LevelError:
+		return v.w.Err(s)
+	case l.Level() == LevelWarn:
+		return v.w.Warning(s)
+	case l.Level() == LevelInfo:
+		return v.w.Info(s)
+	default:
+		return v.w.Debug(s)
+	}
+}
+
+func (v *syslogSink) Close() error {
+	return v.w.Close()
+}
+
+// text sink
+type textSink struct {
+	sync.Mutex
+	w io.Writer
+}
+
+// NewTextSink writes trace logs as lines of text
+func NewTextSink(w io.Writer) Sink {
+	return &textSink{w: w}
+}
+
+func (v *textSink) Write(l Log) error {
+	v.Lock()
+	defer v.Unlock()
+	_, err := fmt.Fprintf(v.w, "%s %s\n", l.Time().Format(time.RFC3339), text(l))
+	return err
+}
+
+func (v *textSink) Close() error {
+	return nil
+}
+
+// routed sink
+type routed struct {
+	sub  bus.Subscription
+	sink Sink
+	// still routed to after a reroute, not closed when drained
+	keep bool
+}
+
+// same returns true if both are the same custom sink
+func same(a, b Sink) bool {
+	if a == nil || b == nil || reflect.TypeOf(a) != reflect.TypeOf(b) || !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// route writes the trace logs to the sinks, replacing the sinks previously
+// routed. Events are written as info trace logs. Replaced sinks are closed
+// once drained, unless a custom sink is routed to again.
+func (v *server) route(ls []LogSink) error {
+	sinks := make([]Sink, 0, len(ls))
+	for _, l := range ls {
+		sink, err := l.open()
+		if err != nil {
+			// custom sinks may still be routed to
+			for i, sink := range sinks {
+				if ls[i].Sink == nil {
+					sink.Close()
+				}
+			}
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+	v.smu.Lock()
+	defer v.smu.Unlock()
+	for _, r := range v.sinks {
+		for _, sink := range sinks {
+			if same(r.sink, sink) {
+				r.keep = true
+			}
+		}
+		r.sub.Unsubscribe()
+	}
+	v.sinks = make([]*routed, 0, len(ls))
+	for i, l := range ls {
+		r := &routed{
+			sub:  v.bus.Subscribe(bus.Topics(l.Topics...), bus.Buffer(sinkBuffer)),
+			sink: sinks[i],
+		}
+		v.sinks = append(v.sinks, r)
+		v.drains.Add(1)
+		go v.drain(r, l.Level)
+	}
+	return nil
+}
+
+// drain writes the messages of the subscription to the sink until the
+// subscription is closed, the sink is closed afterwards unless kept
+func (v *server) drain(r *routed, level Level) {
+	defer v.drains.Done()
+	sink := r.sink
+	for m := range r.sub.C() {
+		var l Log
+		switch o := m.(type) {
+		case Log:
+			l = o
+		case Event:
+			l = &trace{topic: o.Topic(), message: o.Message(), time: time.Now()}
+		default:
+			continue
+		}
+		if l.Level() >= level {
+			sink.Write(l)
+		}
+	}
+	if !r.keep {
+		sink.Close()
+	}
+}
+
+// follow reroutes the trace logs when the log sinks change, until the
+// server stops
+func (v *server) follow(diffs <-chan *Diff, cancel func()) {
+	defer v.handlers.Done()
+	defer cancel()
+	for {
+		select {
+		case <-v.stopping:
+			return
+		case d := <-diffs:
+			if !d.Changed("LogSinks") {
+				continue
+			}
+			if err := v.route(d.To.LogSinks); err != nil {
+				v.log(&trace{
+					topic:   TraceConfig,
+					level:   LevelError,
+					message: "Could not open log sinks",
+					err:     err,
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordSink records the messages written and whether it was closed
+type recordSink struct {
+	sync.Mutex
+	messages []string
+	closed   bool
+}
+
+func (v *recordSink) Write(l Log) error {
+	v.Lock()
+	defer v.Unlock()
+	v.messages = append(v.messages, l.Message())
+	return nil
+}
+
+func (v *recordSink) Close() error {
+	v.Lock()
+	defer v.Unlock()
+	v.closed = true
+	return nil
+}
+
+func (v *recordSink) state() (int, bool) {
+	v.Lock()
+	defer v.Unlock()
+	return len(v.messages), v.closed
+}
+
+// wait until the sink received n messages
+func (v *recordSink) wait(t *testing.T, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if got, _ := v.state(); got >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("sink received fewer than %d messages", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRouteKeepsCustomSinks(t *testing.T) {
+	kept, removed := &recordSink{}, &recordSink{}
+	s, _ := testServer(t, Logs(LogSink{Sink: kept}, LogSink{Sink: removed}))
+	message := func() {
+		s.log(&trace{topic: TraceConfig, level: LevelInfo, message: "test"})
+	}
+	message()
+	kept.wait(t, 1)
+	removed.wait(t, 1)
+	n, _ := kept.state()
+
+	if err := s.route([]LogSink{{Sink: kept}}); err != nil {
+		t.Fatal(err)
+	}
+	message()
+	kept.wait(t, n+1)
+	if _, closed := kept.state(); closed {
+		t.Fatal("sink still configured was closed")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, closed := removed.state(); closed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("removed sink left open")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// a sink that fails to open leaves the routed custom sinks open
+	if err := s.route([]LogSink{{Sink: kept}, {Type: SinkFile}}); err == nil {
+		t.Fatal("file sink without a path accepted")
+	}
+	if _, closed := kept.state(); closed {
+		t.Fatal("sink closed by a failed reroute")
+	}
+
+	s.Stop(context.Background())
+	if _, closed := kept.state(); !closed {
+		t.Fatal("sink left open after stop")
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"time"
+
+	"github.com/samuelngs/universe/pkg/crypto"
+)
+
+// Snapshot is an immutable copy of the options, every change publishes a
+// new snapshot with a higher version. Snapshots are shared and must not be
+// modified.
+type Snapshot struct {
+	Version                uint64
+	ServerID               string
+	NoClientAuth           bool
+	PasswordAuthentication bool
+	RSAAuthentication      bool
+	ListenAddr             string
+	Listeners              []Listener
+	LogSinks               []LogSink
+	Redactions             []*regexp.Regexp
+	Protocol               int
+	HostKeys               []*crypto.PrivateKey
+	Metadata               map[string]string
+	Middlewares            []Handler
+	GracePeriod            time.Duration
+	ShutdownMessage        string
+	ConfigFile             string
+	SocketActivation       bool
+	AuditLog               string
+	MaxAuthTries           int
+	Throttle               Throttle
+	Access                 *Access
+	Limits                 Limits
+	Algorithms             Algorithms
+	Banner                 string
+	MOTD                   string
+	Groups                 []Group
+	// changes of the middlewares, funcs cannot be compared
+	middlewares uint64
+}
+
+// Diff describes the change between two snapshots
+type Diff struct {
+	From, To *Snapshot
+	// Names of the fields that changed
+	Fields []string
+}
+
+// Changed returns true if any of the fields changed
+func (v *Diff) Changed(fields ...string) bool {
+	for _, f := range fields {
+		for _, c := range v.Fields {
+			if f == c {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// String returns diff object in string format
+func (v *Diff) String() string {
+	o := map[string]interface{}{
+		"from":   v.From.Version,
+		"to":     v.To.Version,
+		"fields": v.Fields,
+	}
+	b, _ := json.Marshal(o)
+	return string(b[:])
+}
+
+// diff compares every exported field but the version, the middlewares by
+// their change count
+func diff(from, to *Snapshot) *Diff {
+	d := &Diff{From: from, To: to, Fields: make([]string, 0)}
+	a, b := reflect.ValueOf(from).Elem(), reflect.ValueOf(to).Elem()
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		switch {
+		case field.Name == "Version" || field.PkgPath != "":
+			continue
+		case field.Name == "Middlewares":
+			if from.middlewares == to.middlewares {
+				continue
+			}
+		case reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()):
+			continue
+		}
+		d.Fields = append(d.Fields, field.Name)
+	}
+	return d
+}
+
+// merge combines two consecutive diffs
+func merge(a, b *Diff) *Diff {
+	return diff(a.From, b.To)
+}
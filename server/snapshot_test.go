@@ -0,0 +1,120 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samuelngs/universe/pkg/crypto"
+)
+
+func testOptions(t *testing.T, opts ...Option) *Options {
+	key, err := crypto.GenerateKey(crypto.KeyEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newOptions(append([]Option{HostKey(key)}, opts...)...)
+}
+
+func TestDiffMiddlewares(t *testing.T) {
+	o := testOptions(t)
+	handler := func(name string) Handler {
+		return func(*Context) error {
+			return fmt.Errorf("%s", name)
+		}
+	}
+	o.AddMiddleware(handler("a"))
+	diffs, cancel := o.Subscribe()
+	defer cancel()
+	// same code, different closure
+	prev := o.Snapshot()
+	o.Lock()
+	o.Middlewares = []Handler{handler("b")}
+	o.middlewares++
+	o.commit()
+	o.Unlock()
+	select {
+	case d := <-diffs:
+		if !d.Changed("Middlewares") || d.From != prev {
+			t.Fatalf("diff = %v", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no diff published for a replaced middleware")
+	}
+	// nothing changed, nothing published
+	o.SetGracePeriod(o.GetGracePeriod())
+	select {
+	case d := <-diffs:
+		t.Fatalf("unexpected diff %v", d)
+	default:
+	}
+}
+
+func TestOptionsConcurrentAccess(t *testing.T) {
+	o := testOptions(t)
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				o.SetServerID(fmt.Sprintf("server-%d-%d", i, n))
+				o.SetGracePeriod(time.Duration(n) * time.Millisecond)
+				o.SetMetadata(map[string]string{"writer": fmt.Sprint(i)})
+				o.AddMiddleware(func(*Context) error { return nil })
+			}
+		}(i)
+	}
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			var last uint64
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				s := o.Snapshot()
+				if s.Version < last {
+					t.Errorf("version went back from %d to %d", last, s.Version)
+					return
+				}
+				last = s.Version
+				_ = s.Metadata["writer"]
+				_ = len(s.Middlewares)
+			}
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			diffs, cancel := o.Subscribe()
+			defer cancel()
+			var last uint64
+			for {
+				select {
+				case <-stop:
+					return
+				case d := <-diffs:
+					if d.To.Version <= last || d.From.Version >= d.To.Version {
+						t.Errorf("diff %d -> %d after %d", d.From.Version, d.To.Version, last)
+						return
+					}
+					last = d.To.Version
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+	if n := len(o.GetMiddlewares()); n != 400 {
+		t.Fatalf("%d middlewares", n)
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/samuelngs/universe/pkg/systemd"
+)
+
+// bind listens on every listener, the sockets passed by systemd are used
+// instead when the server was socket activated
+func (v *server) bind() ([]net.Listener, []Listener, error) {
+	ls := v.option.GetListeners()
+	if v.option.GetSocketActivation() {
+		inherited, err := systemd.Listeners()
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(inherited) > 0 {
+			listeners := make([]net.Listener, 0, len(inherited))
+			configs := make([]Listener, 0, len(inherited))
+			for _, il := range inherited {
+				listeners = append(listeners, il.Listener)
+				configs = append(configs, inherit(ls, il))
+			}
+			return listeners, configs, nil
+		}
+	}
+	listeners := make([]net.Listener, 0, len(ls))
+	for _, l := range ls {
+		listener, err := l.listen()
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+			return nil, nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, ls, nil
+}
+
+// inherit returns the configured listener matching the socket by name or
+// address, a listener with the default settings otherwise
+func inherit(ls []Listener, il *systemd.Listener) Listener {
+	addr := il.Addr()
+	for _, l := range ls {
+		if (l.Name != "" && l.Name == il.Name) || l.Addr == addr.String() {
+			return l
+		}
+	}
+	return Listener{Network: addr.Network(), Addr: addr.String(), Name: il.Name}
+}
+
+// sdnotify sends the states to systemd, nothing is sent when the server
+// was not started by systemd
+func (v *server) sdnotify(states ...string) {
+	if _, err := systemd.Notify(strings.Join(states, "\n")); err != nil {
+		v.log(&trace{
+			topic:   TraceSystemd,
+			level:   LevelWarn,
+			message: "Could not notify service manager",
+			err:     err,
+		})
+	}
+}
+
+// watchdog pings systemd at half the watchdog interval until the server
+// stops
+func (v *server) watchdog(interval time.Duration) {
+	defer v.handlers.Done()
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-v.stopping:
+			return
+		case <-ticker.C:
+			v.sdnotify("WATCHDOG=1", fmt.Sprintf("STATUS=Serving %d connections", len(v.registry.connections())))
+		}
+	}
+}
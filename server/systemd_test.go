@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestNotifyLifecycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+	receive := func() string {
+		b := make([]byte, 4096)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, err := conn.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b[:n])
+	}
+	s, addr := testServer(t)
+	if got := receive(); !strings.HasPrefix(got, "READY=1\nSTATUS=Listening on "+addr) {
+		t.Fatalf("ready = %q", got)
+	}
+	s.Stop(context.Background())
+	if got := receive(); !strings.HasPrefix(got, "STOPPING=1") {
+		t.Fatalf("stopping = %q", got)
+	}
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	s, _ := testServer(t, Listen("127.0.0.1:0", ListenerProxyProtocol("127.0.0.0/8")))
+	var addr string
+	for _, l := range s.listeners {
+		if a := l.Addr().String(); a != "" {
+			addr = a
+		}
+	}
+	for _, header := range []string{
+		"PROXY TCP4 192.0.2.10 127.0.0.1 40000 22\r\n",
+		"",
+	} {
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header != "" {
+			c.Write([]byte(header))
+		}
+		sc, chans, reqs, err := ssh.NewClientConn(c, addr, &ssh.ClientConfig{
+			User:            "test",
+			Auth:            []ssh.AuthMethod{ssh.Password("test")},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+			Timeout:         5 * time.Second,
+		})
+		if header == "" {
+			// a trusted proxy must send the header
+			if err == nil {
+				sc.Close()
+				t.Fatal("connection without a PROXY header accepted")
+			}
+			c.Close()
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := ssh.NewClient(sc, chans, reqs)
+		conns := s.Connections()
+		if len(conns) != 1 || conns[0].RemoteAddr != "192.0.2.10:40000" {
+			t.Fatalf("connections = %v", conns)
+		}
+		client.Close()
+	}
+}
@@ -0,0 +1,245 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// interval between sweeps of forgotten attempts
+const sweepInterval = time.Minute
+
+// Ban types
+const (
+	BanAddress string = "address"
+	BanUser           = "user"
+)
+
+// Throttle of failed authentication attempts, failures are counted per
+// source address, and per user when BanUsers is set
+type Throttle struct {
+	// Failures before the address or user is banned, never banned when zero
+	MaxFailures int
+	// Count failures per user as well. A banned user is refused from every
+	// address, so anyone can lock a user out by failing to log in as them.
+	BanUsers bool
+	// Time a ban lasts
+	BanDuration time.Duration
+	// Delay after the first failure, doubled after every further failure,
+	// attempts are never delayed when zero
+	Backoff time.Duration
+	// Longest delay
+	MaxBackoff time.Duration
+	// Time without failures after which the failures are forgotten
+	Window time.Duration
+}
+
+// validate checks the durations and limits
+func (v Throttle) validate() error {
+	if v.MaxFailures < 0 || v.BanDuration < 0 || v.Backoff < 0 || v.MaxBackoff < 0 || v.Window < 0 {
+		return ErrInvalidThrottle
+	}
+	return nil
+}
+
+// Ban of a source address or user after too many failed authentications
+type Ban struct {
+	// address or user
+	Type     string
+	Value    string
+	Failures int
+	Until    time.Time
+}
+
+// ID returns <type>:<value>, the id a ban is lifted by
+func (v *Ban) ID() string {
+	return v.Type + ":" + v.Value
+}
+
+// String returns ban object in string format
+func (v *Ban) String() string {
+	o := map[string]interface{}{
+		"id":       v.ID(),
+		"type":     v.Type,
+		"value":    v.Value,
+		"failures": v.Failures,
+		"until":    v.Until,
+	}
+	b, _ := json.Marshal(o)
+	return string(b[:])
+}
+
+// attempts of an address or user
+type attempts struct {
+	failures int
+	last     time.Time
+	until    time.Time
+}
+
+// throttle tracks failed authentication attempts
+type throttle struct {
+	sync.Mutex
+	entries map[string]*attempts
+	swept   time.Time
+}
+
+func newThrottle() *throttle {
+	return &throttle{entries: make(map[string]*attempts)}
+}
+
+// keys returns the entry keys of the address and user
+func keys(addr net.Addr, user string) []string {
+	host := addr.String()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	ks := []string{BanAddress + ":" + host}
+	if user != "" {
+		ks = append(ks, BanUser+":"+user)
+	}
+	return ks
+}
+
+// banned returns the ban of the address or user, if any
+func (v *throttle) banned(addr net.Addr, user string) (*Ban, bool) {
+	v.Lock()
+	defer v.Unlock()
+	now := time.Now()
+	for _, k := range keys(addr, user) {
+		if a, ok := v.entries[k]; ok && now.Before(a.until) {
+			return ban(k, a), true
+		}
+	}
+	return nil, false
+}
+
+// delay returns the time the next attempt of the address or user is held
+// for, doubled after every failure
+func (v *throttle) delay(addr net.Addr, user string, t Throttle) time.Duration {
+	if t.Backoff <= 0 {
+		return 0
+	}
+	v.Lock()
+	defer v.Unlock()
+	var failures int
+	for _, k := range keys(addr, user) {
+		if a, ok := v.entries[k]; ok && a.failures > failures && (t.Window == 0 || time.Since(a.last) < t.Window) {
+			failures = a.failures
+		}
+	}
+	if failures == 0 {
+		return 0
+	}
+	d := t.Backoff
+	for i := 1; i < failures; i++ {
+		if t.MaxBackoff > 0 && d >= t.MaxBackoff {
+			break
+		}
+		d *= 2
+	}
+	if t.MaxBackoff > 0 && d > t.MaxBackoff {
+		d = t.MaxBackoff
+	}
+	return d
+}
+
+// fail counts a failure of the address and user, returning the bans it
+// causes
+func (v *throttle) fail(addr net.Addr, user string, t Throttle) []*Ban {
+	v.Lock()
+	defer v.Unlock()
+	now := time.Now()
+	v.sweep(now, t.Window)
+	bans := make([]*Ban, 0)
+	ks := keys(addr, user)
+	if !t.BanUsers {
+		ks = ks[:1]
+	}
+	for _, k := range ks {
+		a, ok := v.entries[k]
+		switch {
+		case !ok:
+			a = new(attempts)
+			v.entries[k] = a
+		case now.Before(a.until):
+			continue
+		case t.Window > 0 && now.Sub(a.last) >= t.Window, !a.until.IsZero():
+			// forgotten, or the ban expired
+			*a = attempts{}
+		}
+		a.failures++
+		a.last = now
+		if t.MaxFailures > 0 && a.failures >= t.MaxFailures {
+			a.until = now.Add(t.BanDuration)
+			bans = append(bans, ban(k, a))
+		}
+	}
+	return bans
+}
+
+// succeed forgets the failures of the address and user
+func (v *throttle) succeed(addr net.Addr, user string) {
+	v.Lock()
+	defer v.Unlock()
+	now := time.Now()
+	for _, k := range keys(addr, user) {
+		if a, ok := v.entries[k]; ok && !now.Before(a.until) {
+			delete(v.entries, k)
+		}
+	}
+}
+
+// sweep drops the entries neither banned nor failed within the window, at
+// most once a minute. The caller must hold the lock.
+func (v *throttle) sweep(now time.Time, window time.Duration) {
+	if now.Sub(v.swept) < sweepInterval {
+		return
+	}
+	v.swept = now
+	for k, a := range v.entries {
+		if now.Before(a.until) {
+			continue
+		}
+		if !a.until.IsZero() || (window > 0 && now.Sub(a.last) >= window) {
+			delete(v.entries, k)
+		}
+	}
+}
+
+// list returns the bans in effect sorted by id
+func (v *throttle) list() []*Ban {
+	v.Lock()
+	defer v.Unlock()
+	now := time.Now()
+	bans := make([]*Ban, 0)
+	for k, a := range v.entries {
+		if now.Before(a.until) {
+			bans = append(bans, ban(k, a))
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].ID() < bans[j].ID()
+	})
+	return bans
+}
+
+// lift removes the ban by id along with the failures, false if there is no
+// such ban
+func (v *throttle) lift(id string) bool {
+	v.Lock()
+	defer v.Unlock()
+	a, ok := v.entries[id]
+	if !ok || !time.Now().Before(a.until) {
+		return false
+	}
+	delete(v.entries, id)
+	return true
+}
+
+func ban(k string, a *attempts) *Ban {
+	i := strings.Index(k, ":")
+	return &Ban{Type: k[:i], Value: k[i+1:], Failures: a.failures, Until: a.until}
+}
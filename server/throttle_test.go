@@ -0,0 +1,143 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func tcpAddr(ip string, port int) net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP(ip), Port: port}
+}
+
+func TestThrottleBackoff(t *testing.T) {
+	v := newThrottle()
+	cfg := Throttle{Backoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond, Window: time.Minute}
+	a := tcpAddr("192.0.2.1", 40000)
+	if d := v.delay(a, "root", cfg); d != 0 {
+		t.Fatalf("delay before a failure = %v", d)
+	}
+	for i, want := range []time.Duration{100, 200, 300, 300} {
+		v.fail(a, "root", cfg)
+		// the port of the source does not matter
+		if d := v.delay(tcpAddr("192.0.2.1", 40001+i), "", cfg); d != want*time.Millisecond {
+			t.Errorf("delay after %d failures = %v, want %v", i+1, d, want*time.Millisecond)
+		}
+	}
+	if d := v.delay(tcpAddr("192.0.2.2", 40000), "root", cfg); d != 0 {
+		t.Errorf("delay of another address = %v", d)
+	}
+	v.succeed(a, "root")
+	if d := v.delay(a, "root", cfg); d != 0 {
+		t.Errorf("delay after a success = %v", d)
+	}
+	if d := v.delay(a, "root", Throttle{}); d != 0 {
+		t.Errorf("delay without backoff = %v", d)
+	}
+}
+
+func TestThrottleWindow(t *testing.T) {
+	v := newThrottle()
+	cfg := Throttle{MaxFailures: 2, BanDuration: time.Hour, Backoff: time.Second, Window: 50 * time.Millisecond}
+	a := tcpAddr("192.0.2.1", 40000)
+	v.fail(a, "", cfg)
+	time.Sleep(100 * time.Millisecond)
+	if d := v.delay(a, "", cfg); d != 0 {
+		t.Errorf("delay after the window = %v", d)
+	}
+	// forgotten, the count starts over
+	if bans := v.fail(a, "", cfg); len(bans) != 0 {
+		t.Errorf("bans = %v", bans)
+	}
+}
+
+func TestThrottleBans(t *testing.T) {
+	cfg := Throttle{MaxFailures: 3, BanDuration: time.Hour}
+	v := newThrottle()
+	// failures for root spread over addresses never ban root
+	for i := 0; i < 5; i++ {
+		if bans := v.fail(tcpAddr(fmt.Sprintf("192.0.2.%d", i+1), 40000), "root", cfg); len(bans) != 0 {
+			t.Fatalf("bans = %v", bans)
+		}
+	}
+	if _, ok := v.banned(tcpAddr("198.51.100.1", 40000), "root"); ok {
+		t.Fatal("root locked out by failures from other addresses")
+	}
+	a := tcpAddr("192.0.2.9", 40000)
+	var bans []*Ban
+	for i := 0; i < 3; i++ {
+		bans = v.fail(a, "root", cfg)
+	}
+	if len(bans) != 1 || bans[0].ID() != "address:192.0.2.9" || bans[0].Failures != 3 {
+		t.Fatalf("bans = %v", bans)
+	}
+	if b, ok := v.banned(tcpAddr("192.0.2.9", 40001), "alice"); !ok || b.ID() != "address:192.0.2.9" {
+		t.Fatal("banned address admitted")
+	}
+	// failures while banned are not counted again
+	if bans := v.fail(a, "root", cfg); len(bans) != 0 {
+		t.Fatalf("bans = %v", bans)
+	}
+	if list := v.list(); len(list) != 1 {
+		t.Fatalf("list = %v", list)
+	}
+	if !v.lift("address:192.0.2.9") || v.lift("address:192.0.2.9") {
+		t.Fatal("lift")
+	}
+	if _, ok := v.banned(a, "root"); ok {
+		t.Fatal("lifted ban still in effect")
+	}
+
+	cfg.BanUsers = true
+	v = newThrottle()
+	for i := 0; i < 3; i++ {
+		bans = v.fail(tcpAddr(fmt.Sprintf("192.0.2.%d", i+1), 40000), "root", cfg)
+	}
+	if len(bans) != 1 || bans[0].ID() != "user:root" {
+		t.Fatalf("bans = %v", bans)
+	}
+	if _, ok := v.banned(tcpAddr("198.51.100.1", 40000), "root"); !ok {
+		t.Fatal("banned user admitted")
+	}
+}
+
+func TestThrottleServer(t *testing.T) {
+	var refuse int32 = 1
+	s, addr := testServer(t, Throttling(Throttle{
+		MaxFailures: 3,
+		BanDuration: time.Hour,
+		Backoff:     10 * time.Millisecond,
+		MaxBackoff:  40 * time.Millisecond,
+		Window:      time.Minute,
+	}), MaxAuthTries(1))
+	s.Use(func(*Context) error {
+		if atomic.LoadInt32(&refuse) == 1 {
+			return ErrUnauthentized
+		}
+		return nil
+	})
+	for i := 0; i < 3; i++ {
+		if _, err := testDial(t, addr, "root"); err == nil {
+			t.Fatal("refused login succeeded")
+		}
+	}
+	bans := s.Bans()
+	if len(bans) != 1 || bans[0].ID() != "address:127.0.0.1" || bans[0].Failures != 3 {
+		t.Fatalf("bans = %v", bans)
+	}
+	atomic.StoreInt32(&refuse, 0)
+	if _, err := testDial(t, addr, "root"); err == nil {
+		t.Fatal("banned address logged in")
+	}
+	if err := s.Unban("address:127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Unban("address:127.0.0.1"); err != ErrBanNotFound {
+		t.Fatalf("second unban: %v", err)
+	}
+	if _, err := testDial(t, addr, "root"); err != nil {
+		t.Fatalf("login after unban: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"github.com/samuelngs/universe/admin"
+	"github.com/samuelngs/universe/clientv1"
+	"github.com/samuelngs/universe/pkg/crypto"
+	"github.com/samuelngs/universe/pkg/uuid"
+	"github.com/samuelngs/universe/proxy"
+	"github.com/samuelngs/universe/server"
+)
+
+// Option func
+type Option func(*Options)
+
+// Options for Service, the shared settings are applied to every component
+type Options struct {
+	// Service Id shared by server and proxy
+	ServiceID string
+	// Key used as server host key and client identity
+	Identity *crypto.PrivateKey
+	// Metadata shared with the server
+	Metadata map[string]string
+	// Server options
+	Server []server.Option
+	// Proxy options, the proxy is only started when upstreams are set
+	Proxy []proxy.Option
+	// Client options for outgoing connections
+	Client []clientv1.Option
+	// Client pool options
+	Pool []clientv1.PoolOption
+	// Admin options, the admin API is only started when set
+	Admin []admin.Option
+}
+
+// newOptions creates new option
+func newOptions(opts ...Option) *Options {
+	o := &Options{
+		ServiceID: uuid.MustV4(),
+		Metadata:  make(map[string]string),
+		Server:    make([]server.Option, 0),
+		Proxy:     make([]proxy.Option, 0),
+		Client:    make([]clientv1.Option, 0),
+		Pool:      make([]clientv1.PoolOption, 0),
+		Admin:     make([]admin.Option, 0),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// ID option
+func ID(s string) Option {
+	return func(o *Options) {
+		if len(s) > 0 {
+			o.ServiceID = s
+		}
+	}
+}
+
+// Identity option
+func Identity(k *crypto.PrivateKey) Option {
+	return func(o *Options) {
+		o.Identity = k
+	}
+}
+
+// Metadata option
+func Metadata(m map[string]string) Option {
+	return func(o *Options) {
+		for k, v := range m {
+			o.Metadata[k] = v
+		}
+	}
+}
+
+// Server option
+func Server(opts ...server.Option) Option {
+	return func(o *Options) {
+		o.Server = append(o.Server, opts...)
+	}
+}
+
+// Proxy option
+func Proxy(opts ...proxy.Option) Option {
+	return func(o *Options) {
+		o.Proxy = append(o.Proxy, opts...)
+	}
+}
+
+// Client option
+func Client(opts ...clientv1.Option) Option {
+	return func(o *Options) {
+		o.Client = append(o.Client, opts...)
+	}
+}
+
+// Pool option
+func Pool(opts ...clientv1.PoolOption) Option {
+	return func(o *Options) {
+		o.Pool = append(o.Pool, opts...)
+	}
+}
+
+// Admin option
+func Admin(opts ...admin.Option) Option {
+	return func(o *Options) {
+		o.Admin = append(o.Admin, opts...)
+	}
+}
+
+// server options with shared settings applied first so explicit server
+// options take precedence
+func (v *Options) server() []server.Option {
+	opts := []server.Option{
+		server.ID(v.ServiceID),
+		server.Metadata(v.Metadata),
+	}
+	if v.Identity != nil {
+		opts = append(opts, server.HostKey(v.Identity))
+	}
+	return append(opts, v.Server...)
+}
+
+func (v *Options) proxy() []proxy.Option {
+	return append([]proxy.Option{proxy.ID(v.ServiceID)}, v.Proxy...)
+}
+
+func (v *Options) pool() []clientv1.PoolOption {
+	client := make([]clientv1.Option, 0)
+	if v.Identity != nil {
+		client = append(client, clientv1.Key(v.Identity))
+	}
+	client = append(client, v.Client...)
+	return append([]clientv1.PoolOption{clientv1.PoolClientOptions(client...)}, v.Pool...)
+}
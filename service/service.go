@@ -1,11 +1,201 @@
 package service
 
-import "github.com/samuelngs/universe/sshd"
+import (
+	"context"
+	"sync"
+
+	"github.com/samuelngs/universe/admin"
+	"github.com/samuelngs/universe/clientv1"
+	"github.com/samuelngs/universe/pkg/bus"
+	"github.com/samuelngs/universe/proxy"
+	"github.com/samuelngs/universe/server"
+)
 
 // Service for Secure Shell
 type Service interface {
 	Run() error
-	Stop() error
-	Server() sshd.Server
-	Client() client.Client
+	Stop(context.Context) error
+	Option() *Options
+	Server() server.Server
+	Proxy() proxy.Proxy
+	Client() *clientv1.Pool
+	Admin() admin.Admin
+	Subscribe() <-chan server.Event
+	Logging() <-chan server.Log
+	Bus() bus.Bus
+}
+
+// New create secure shell service
+func New(opts ...Option) Service {
+	s := new(service)
+	s.option = newOptions(opts...)
+	s.server = server.New(s.option.server()...)
+	// proxy options without upstreams, such as a listen address alone,
+	// do not start a proxy that would fail to run
+	if p := proxy.New(s.option.proxy()...); len(p.Option().GetUpstreams()) > 0 {
+		s.proxy = p
+	}
+	s.client = clientv1.NewPool(s.option.pool()...)
+	if len(s.option.Admin) > 0 {
+		s.admin = admin.New(s.server, s.option.Admin...)
+	}
+	s.bus = bus.New()
+	s.eventsub = s.bus.Subscribe(bus.Topics(append(append([]string{}, server.EventTopics...), proxy.Topics...)...))
+	s.logsub = s.bus.Subscribe(bus.Topics(server.TraceTopics...))
+	return s
+}
+
+// Run creates a service with the options and runs it until stopped
+func Run(opts ...Option) error {
+	return New(opts...).Run()
+}
+
+// internal service
+type service struct {
+	sync.Mutex
+	option    *Options
+	server    server.Server
+	proxy     proxy.Proxy
+	client    *clientv1.Pool
+	admin     admin.Admin
+	bus       bus.Bus
+	eventsub  bus.Subscription
+	logsub    bus.Subscription
+	events    chan server.Event
+	logger    chan server.Log
+	subscribe sync.Once
+	logging   sync.Once
+	stopped   bool
+}
+
+// forward republishes the component messages on the service bus, the
+// service bus is closed once every component bus is closed
+func (v *service) forward() {
+	subs := []bus.Subscription{v.server.Bus().Subscribe()}
+	if v.proxy != nil {
+		subs = append(subs, v.proxy.Bus().Subscribe())
+	}
+	var wg sync.WaitGroup
+	wg.Add(len(subs))
+	for _, sub := range subs {
+		go func(sub bus.Subscription) {
+			defer wg.Done()
+			for m := range sub.C() {
+				v.bus.Publish(m)
+			}
+		}(sub)
+	}
+	go func() {
+		wg.Wait()
+		v.bus.Close()
+	}()
+}
+
+// Run starts every component and blocks until one of them exits, the
+// remaining components are then stopped
+func (v *service) Run() error {
+	v.forward()
+	errs := make(chan error, 3)
+	if v.admin != nil {
+		go func() {
+			errs <- v.admin.Run()
+		}()
+	}
+	if v.proxy != nil {
+		go func() {
+			errs <- v.proxy.Run()
+		}()
+	}
+	go func() {
+		errs <- v.server.Run()
+	}()
+	err := <-errs
+	if e := v.Stop(context.Background()); err == nil {
+		err = e
+	}
+	return err
+}
+
+// Stop stops every component, the server drains its sessions within the
+// context deadline
+func (v *service) Stop(ctx context.Context) error {
+	v.Lock()
+	defer v.Unlock()
+	if v.stopped {
+		return nil
+	}
+	v.stopped = true
+	var err error
+	if v.admin != nil {
+		err = v.admin.Stop(ctx)
+	}
+	if v.proxy != nil {
+		if e := v.proxy.Stop(); err == nil {
+			err = e
+		}
+	}
+	if e := v.server.Stop(ctx); err == nil {
+		err = e
+	}
+	if e := v.client.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+func (v *service) Option() *Options {
+	return v.option
+}
+
+func (v *service) Server() server.Server {
+	return v.server
+}
+
+func (v *service) Proxy() proxy.Proxy {
+	return v.proxy
+}
+
+func (v *service) Client() *clientv1.Pool {
+	return v.client
+}
+
+func (v *service) Admin() admin.Admin {
+	return v.admin
+}
+
+// Subscribe returns the server and proxy events, the channel is shared by
+// every caller and closed once the service is stopped
+func (v *service) Subscribe() <-chan server.Event {
+	v.subscribe.Do(func() {
+		events := make(chan server.Event)
+		go func() {
+			defer close(events)
+			for m := range v.eventsub.C() {
+				events <- m.(server.Event)
+			}
+		}()
+		v.events = events
+	})
+	return v.events
+}
+
+// Logging returns the server trace logs, the channel is shared by every
+// caller and closed once the service is stopped
+func (v *service) Logging() <-chan server.Log {
+	v.logging.Do(func() {
+		logger := make(chan server.Log)
+		go func() {
+			defer close(logger)
+			for m := range v.logsub.C() {
+				logger <- m.(server.Log)
+			}
+		}()
+		v.logger = logger
+	})
+	return v.logger
+}
+
+// Bus returns the bus every component message is republished on
+func (v *service) Bus() bus.Bus {
+	return v.bus
 }
@@ -0,0 +1,16 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/samuelngs/universe/proxy"
+)
+
+func TestProxyStartedWithUpstreams(t *testing.T) {
+	if s := New(Proxy(proxy.ListenAddr("127.0.0.1:0"))); s.Proxy() != nil {
+		t.Fatal("proxy created without upstreams")
+	}
+	if s := New(Proxy(proxy.ListenAddr("127.0.0.1:0"), proxy.Upstream("127.0.0.1:2222"))); s.Proxy() == nil {
+		t.Fatal("proxy not created with upstreams")
+	}
+}